@@ -0,0 +1,357 @@
+package catalog
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+)
+
+// SchemaVersion is the supported catalog zone schema version.
+// https://datatracker.ietf.org/doc/html/rfc9432#section-4.2.1
+const SchemaVersion = "2"
+
+const (
+	labelVersion = "version"
+	labelZones   = "zones"
+	labelGroup   = "group"
+	labelCOO     = "coo"
+)
+
+var (
+	// ErrVersion returns when version property is missing or not supported.
+	ErrVersion = fmt.Errorf("catalog zone schema version is not supported")
+	// ErrInvalidMember returns when member has invalid zone name or unique label.
+	ErrInvalidMember = fmt.Errorf("invalid member")
+	// ErrDuplicateMember returns when same member zone or unique label is used twice.
+	ErrDuplicateMember = fmt.Errorf("duplicate member")
+)
+
+// Member is a member zone of catalog zone.
+type Member struct {
+	// ID is the unique label of member zone (unique-N).
+	ID string
+	// Zone is canonical member zone name.
+	Zone string
+	// Groups is the group property values.
+	Groups []string
+	// COO is the change of ownership property value. If not exist, it is empty.
+	COO string
+}
+
+// Copy returns deep copy of Member.
+func (m *Member) Copy() *Member {
+	res := *m
+	res.Groups = append([]string(nil), m.Groups...)
+	return &res
+}
+
+// Equals returns true when members have same unique label, zone and properties.
+func (m *Member) Equals(o *Member) bool {
+	if m.ID != o.ID || !dnsutils.Equals(m.Zone, o.Zone) || !dnsutils.Equals(m.COO, o.COO) {
+		return false
+	}
+	if len(m.Groups) != len(o.Groups) {
+		return false
+	}
+	a := append([]string(nil), m.Groups...)
+	b := append([]string(nil), o.Groups...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Catalog is parsed catalog zone.
+type Catalog struct {
+	// Zone is canonical catalog zone name.
+	Zone string
+	// Version is the schema version.
+	Version string
+	// Members is the member zones sorted by zone name.
+	Members []*Member
+	// Ignored is the owner names of member nodes which are ignored by parsing.
+	Ignored []string
+}
+
+// GetMember returns member by zone name.
+// If not exist, returns nil.
+func (c *Catalog) GetMember(zone string) *Member {
+	for _, m := range c.Members {
+		if dnsutils.Equals(m.Zone, zone) {
+			return m
+		}
+	}
+	return nil
+}
+
+// NewMemberID returns unique label for member zone.
+// It is the hex encoded SHA-1 of wire format member zone name.
+func NewMemberID(zone string) string {
+	buf := make([]byte, 255)
+	off, err := dns.PackDomainName(dns.CanonicalName(zone), buf, 0, nil, false)
+	if err != nil {
+		sum := sha1.Sum([]byte(dns.CanonicalName(zone)))
+		return hex.EncodeToString(sum[:])
+	}
+	sum := sha1.Sum(buf[:off])
+	return hex.EncodeToString(sum[:])
+}
+
+func zonesName(catalog string) string {
+	return dns.CanonicalName(labelZones + "." + catalog)
+}
+
+// Parse parses catalog zone.
+// It returns ErrVersion when version property is not SchemaVersion.
+// Member nodes which have not exactly one PTR RR, duplicated member zones
+// and broken properties are ignored and reported by Catalog.Ignored.
+func Parse(z dnsutils.ZoneInterface) (*Catalog, error) {
+	c := &Catalog{Zone: z.GetName()}
+	versionNode, ok := z.GetRootNode().GetNameNode(dns.CanonicalName(labelVersion + "." + z.GetName()))
+	if !ok {
+		return nil, ErrVersion
+	}
+	txts, err := dnsutils.GetTyped[*dns.TXT](versionNode, dns.TypeTXT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version property: %w", err)
+	}
+	if len(txts) != 1 || len(txts[0].Txt) != 1 || txts[0].Txt[0] != SchemaVersion {
+		return nil, ErrVersion
+	}
+	c.Version = SchemaVersion
+
+	zonesNode, ok := z.GetRootNode().GetNameNode(zonesName(z.GetName()))
+	if !ok {
+		return c, nil
+	}
+	var (
+		members = map[string]*Member{}
+		owners  = map[string]string{}
+		ignored = map[string]struct{}{}
+	)
+	children := zonesNode.CopyChildNodes()
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	if err := dnsutils.SortNames(names); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		m, ok := parseMember(children[name])
+		if !ok {
+			c.Ignored = append(c.Ignored, name)
+			continue
+		}
+		if _, ok := ignored[m.Zone]; ok {
+			c.Ignored = append(c.Ignored, name)
+			continue
+		}
+		if _, ok := members[m.Zone]; ok {
+			c.Ignored = append(c.Ignored, owners[m.Zone], name)
+			ignored[m.Zone] = struct{}{}
+			delete(members, m.Zone)
+			continue
+		}
+		members[m.Zone] = m
+		owners[m.Zone] = name
+	}
+	for _, m := range members {
+		c.Members = append(c.Members, m)
+	}
+	if err := sortMembers(c.Members); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func parseMember(nni dnsutils.NameNodeInterface) (*Member, bool) {
+	ptrs, err := dnsutils.GetTyped[*dns.PTR](nni, dns.TypePTR)
+	if err != nil || len(ptrs) != 1 {
+		return nil, false
+	}
+	m := &Member{
+		ID:   dns.SplitDomainName(nni.GetName())[0],
+		Zone: dns.CanonicalName(ptrs[0].Ptr),
+	}
+	children := nni.CopyChildNodes()
+	if groupNode, ok := children[dns.CanonicalName(labelGroup+"."+nni.GetName())]; ok {
+		txts, err := dnsutils.GetTyped[*dns.TXT](groupNode, dns.TypeTXT)
+		if err != nil {
+			return nil, false
+		}
+		for _, txt := range txts {
+			if len(txt.Txt) != 1 {
+				return nil, false
+			}
+			m.Groups = append(m.Groups, txt.Txt[0])
+		}
+		sort.Strings(m.Groups)
+	}
+	if cooNode, ok := children[dns.CanonicalName(labelCOO+"."+nni.GetName())]; ok {
+		coos, err := dnsutils.GetTyped[*dns.PTR](cooNode, dns.TypePTR)
+		if err != nil || len(coos) > 1 {
+			return nil, false
+		}
+		if len(coos) == 1 {
+			m.COO = dns.CanonicalName(coos[0].Ptr)
+		}
+	}
+	return m, true
+}
+
+func sortMembers(members []*Member) error {
+	var sortErr error
+	sort.SliceStable(members, func(i, j int) bool {
+		res, err := dnsutils.CompareName(members[i].Zone, members[j].Zone)
+		if err != nil {
+			sortErr = err
+		}
+		return res < 0
+	})
+	return sortErr
+}
+
+// Build creates catalog zone which has SOA, NS (invalid.), version property and members.
+func Build(name string, class dns.Class, soa *dns.SOA, members []*Member, generator dnsutils.Generator) (*dnsutils.Zone, error) {
+	z, err := dnsutils.NewZone(name, class, generator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zone: %w", err)
+	}
+	soa = dns.Copy(soa).(*dns.SOA)
+	soa.Hdr = dns.RR_Header{Name: z.GetName(), Rrtype: dns.TypeSOA, Class: uint16(class), Ttl: soa.Hdr.Ttl}
+	ns := &dns.NS{
+		Hdr: dns.RR_Header{Name: z.GetName(), Rrtype: dns.TypeNS, Class: uint16(class), Ttl: soa.Hdr.Ttl},
+		Ns:  "invalid.",
+	}
+	for _, rr := range []dns.RR{soa, ns} {
+		if err := dnsutils.CreateOrReplaceRRSetFromRRs(z.GetRootNode(), []dns.RR{rr}, z.GetGenerator()); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", dnsutils.ConvertTypeToString(rr.Header().Rrtype), err)
+		}
+	}
+	if err := Update(z, members, z.GetGenerator()); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// Update replaces version property and all members of catalog zone with members.
+// If Member.ID is empty, NewMemberID is used. RRs use TTL of SOA.
+// SOA serial is not changed.
+func Update(z dnsutils.ZoneInterface, members []*Member, generator dnsutils.Generator) error {
+	if generator == nil {
+		generator = &dnsutils.DefaultGenerator{}
+	}
+	soa, err := dnsutils.GetSOA(z)
+	if err != nil {
+		return err
+	}
+	var (
+		ids   = map[string]struct{}{}
+		zones = map[string]struct{}{}
+		rrs   [][]dns.RR
+		zname = zonesName(z.GetName())
+	)
+	newHdr := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: uint16(z.GetClass()), Ttl: soa.Hdr.Ttl}
+	}
+	rrs = append(rrs, []dns.RR{&dns.TXT{
+		Hdr: newHdr(dns.CanonicalName(labelVersion+"."+z.GetName()), dns.TypeTXT),
+		Txt: []string{SchemaVersion},
+	}})
+	for _, m := range members {
+		m = m.Copy()
+		m.Zone = dns.CanonicalName(m.Zone)
+		if m.ID == "" {
+			m.ID = NewMemberID(m.Zone)
+		}
+		if _, ok := dns.IsDomainName(m.Zone); !ok {
+			return fmt.Errorf("%w: bad zone name %s", ErrInvalidMember, m.Zone)
+		}
+		owner := dns.CanonicalName(m.ID + "." + zname)
+		if _, ok := dns.IsDomainName(owner); !ok || dns.CountLabel(owner) != dns.CountLabel(zname)+1 {
+			return fmt.Errorf("%w: bad unique label %s", ErrInvalidMember, m.ID)
+		}
+		if _, ok := ids[owner]; ok {
+			return fmt.Errorf("%w: unique label %s", ErrDuplicateMember, m.ID)
+		}
+		if _, ok := zones[m.Zone]; ok {
+			return fmt.Errorf("%w: zone %s", ErrDuplicateMember, m.Zone)
+		}
+		ids[owner] = struct{}{}
+		zones[m.Zone] = struct{}{}
+		rrs = append(rrs, []dns.RR{&dns.PTR{Hdr: newHdr(owner, dns.TypePTR), Ptr: m.Zone}})
+		if len(m.Groups) > 0 {
+			var groups []dns.RR
+			for _, g := range m.Groups {
+				groups = append(groups, &dns.TXT{Hdr: newHdr(labelGroup+"."+owner, dns.TypeTXT), Txt: []string{g}})
+			}
+			rrs = append(rrs, groups)
+		}
+		if m.COO != "" {
+			rrs = append(rrs, []dns.RR{&dns.PTR{Hdr: newHdr(labelCOO+"."+owner, dns.TypePTR), Ptr: dns.CanonicalName(m.COO)}})
+		}
+	}
+	if err := dnsutils.RemoveNameNode(z.GetRootNode(), zname); err != nil {
+		return fmt.Errorf("failed to remove members: %w", err)
+	}
+	for _, set := range rrs {
+		if err := dnsutils.CreateOrReplaceRRSetFromRRs(z.GetRootNode(), set, generator); err != nil {
+			return fmt.Errorf("failed to set %s: %w", set[0].Header().Name, err)
+		}
+	}
+	return nil
+}
+
+// Delta is the difference between two catalog versions.
+type Delta struct {
+	// Added is members which are added.
+	Added []*Member
+	// Removed is members which are removed.
+	Removed []*Member
+	// Changed is members whose properties are changed. It has new values.
+	Changed []*Member
+}
+
+// IsEmpty returns true when there is no difference.
+func (d *Delta) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff returns delta from prev catalog to cur catalog.
+// prev may be nil, then all members of cur are added.
+// When unique label of a member zone is changed, the member is reported by both
+// Removed and Added, because it means reset of member zone state.
+// https://datatracker.ietf.org/doc/html/rfc9432#section-5.6
+func Diff(prev, cur *Catalog) *Delta {
+	d := &Delta{}
+	if prev == nil {
+		prev = &Catalog{}
+	}
+	for _, nm := range cur.Members {
+		om := prev.GetMember(nm.Zone)
+		switch {
+		case om == nil:
+			d.Added = append(d.Added, nm)
+		case om.ID != nm.ID:
+			d.Removed = append(d.Removed, om)
+			d.Added = append(d.Added, nm)
+		case !om.Equals(nm):
+			d.Changed = append(d.Changed, nm)
+		}
+	}
+	for _, om := range prev.Members {
+		if cur.GetMember(om.Zone) == nil {
+			d.Removed = append(d.Removed, om)
+		}
+	}
+	return d
+}
@@ -0,0 +1,228 @@
+package catalog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/catalog"
+	. "github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCatalog(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "catalog Suite")
+}
+
+var testCatalogZone = []byte(`catalog.invalid. 0 IN SOA invalid. invalid. 1 3600 900 86400 0
+catalog.invalid. 0 IN NS invalid.
+version.catalog.invalid. 0 IN TXT "2"
+a.zones.catalog.invalid. 0 IN PTR example.jp.
+group.a.zones.catalog.invalid. 0 IN TXT "g1"
+group.a.zones.catalog.invalid. 0 IN TXT "g2"
+b.zones.catalog.invalid. 0 IN PTR example.com.
+coo.b.zones.catalog.invalid. 0 IN PTR other.invalid.
+c.zones.catalog.invalid. 0 IN PTR example.net.
+c.zones.catalog.invalid. 0 IN PTR example.org.
+d.zones.catalog.invalid. 0 IN PTR dup.example.
+e.zones.catalog.invalid. 0 IN PTR dup.example.
+`)
+
+func readZone(bs []byte) *dnsutils.Zone {
+	z := &dnsutils.Zone{}
+	Expect(z.Read(bytes.NewBuffer(bs))).To(Succeed())
+	return z
+}
+
+var _ = Describe("catalog", func() {
+	var (
+		err error
+		z   *dnsutils.Zone
+		c   *catalog.Catalog
+	)
+	Context("NewMemberID", func() {
+		It("returns sha1 of wire format name", func() {
+			Expect(catalog.NewMemberID("Example.JP")).To(Equal(catalog.NewMemberID("example.jp.")))
+			Expect(catalog.NewMemberID("example.jp.")).To(HaveLen(40))
+			Expect(catalog.NewMemberID("example.jp.")).NotTo(Equal(catalog.NewMemberID("example.com.")))
+		})
+	})
+	Context("Parse", func() {
+		When("valid catalog zone", func() {
+			BeforeEach(func() {
+				c, err = catalog.Parse(readZone(testCatalogZone))
+			})
+			It("returns members", func() {
+				Expect(err).To(Succeed())
+				Expect(c.Zone).To(Equal("catalog.invalid."))
+				Expect(c.Version).To(Equal(catalog.SchemaVersion))
+				Expect(c.Members).To(Equal([]*catalog.Member{
+					{ID: "b", Zone: "example.com.", COO: "other.invalid."},
+					{ID: "a", Zone: "example.jp.", Groups: []string{"g1", "g2"}},
+				}))
+				Expect(c.Ignored).To(ConsistOf(
+					"c.zones.catalog.invalid.",
+					"d.zones.catalog.invalid.",
+					"e.zones.catalog.invalid.",
+				))
+				Expect(c.GetMember("example.jp.").ID).To(Equal("a"))
+				Expect(c.GetMember("example.org.")).To(BeNil())
+			})
+		})
+		When("version property not exist", func() {
+			BeforeEach(func() {
+				z = readZone(testCatalogZone)
+				Expect(z.GetRootNode().RemoveChildNameNode("version.catalog.invalid.")).To(Succeed())
+				_, err = catalog.Parse(z)
+			})
+			It("returns ErrVersion", func() {
+				Expect(err).To(Equal(catalog.ErrVersion))
+			})
+		})
+		When("version property is not supported", func() {
+			BeforeEach(func() {
+				z = readZone(testCatalogZone)
+				Expect(dnsutils.CreateOrReplaceRRSetFromRRs(z.GetRootNode(), []dns.RR{
+					MustNewRR(`version.catalog.invalid. 0 IN TXT "1"`),
+				}, nil)).To(Succeed())
+				_, err = catalog.Parse(z)
+			})
+			It("returns ErrVersion", func() {
+				Expect(err).To(Equal(catalog.ErrVersion))
+			})
+		})
+	})
+	Context("Build", func() {
+		var (
+			soa     = MustNewRR("hoge. 0 IN SOA invalid. invalid. 1 3600 900 86400 0").(*dns.SOA)
+			members []*catalog.Member
+		)
+		BeforeEach(func() {
+			members = []*catalog.Member{
+				{Zone: "example.jp", Groups: []string{"g1"}},
+				{ID: "b", Zone: "example.com.", COO: "other.invalid."},
+			}
+		})
+		When("valid members", func() {
+			BeforeEach(func() {
+				z, err = catalog.Build("catalog.invalid.", dns.ClassINET, soa, members, nil)
+			})
+			It("creates catalog zone", func() {
+				Expect(err).To(Succeed())
+				Expect(members[0].ID).To(BeEmpty())
+				c, err = catalog.Parse(z)
+				Expect(err).To(Succeed())
+				Expect(c.Members).To(Equal([]*catalog.Member{
+					{ID: "b", Zone: "example.com.", COO: "other.invalid."},
+					{ID: catalog.NewMemberID("example.jp."), Zone: "example.jp.", Groups: []string{"g1"}},
+				}))
+				s, err := dnsutils.GetSOA(z)
+				Expect(err).To(Succeed())
+				Expect(s.Hdr.Name).To(Equal("catalog.invalid."))
+				Expect(z.GetRootNode().GetRRSet(dns.TypeNS).GetRRs()).To(Equal([]dns.RR{
+					MustNewRR("catalog.invalid. 0 IN NS invalid."),
+				}))
+			})
+		})
+		When("member zone is duplicated", func() {
+			BeforeEach(func() {
+				members = append(members, &catalog.Member{Zone: "example.jp."})
+				_, err = catalog.Build("catalog.invalid.", dns.ClassINET, soa, members, nil)
+			})
+			It("returns ErrDuplicateMember", func() {
+				Expect(err).To(MatchError(catalog.ErrDuplicateMember))
+			})
+		})
+		When("unique label is duplicated", func() {
+			BeforeEach(func() {
+				members = append(members, &catalog.Member{ID: "b", Zone: "example.net."})
+				_, err = catalog.Build("catalog.invalid.", dns.ClassINET, soa, members, nil)
+			})
+			It("returns ErrDuplicateMember", func() {
+				Expect(err).To(MatchError(catalog.ErrDuplicateMember))
+			})
+		})
+		When("unique label is invalid", func() {
+			BeforeEach(func() {
+				members = append(members, &catalog.Member{ID: "b.c", Zone: "example.net."})
+				_, err = catalog.Build("catalog.invalid.", dns.ClassINET, soa, members, nil)
+			})
+			It("returns ErrInvalidMember", func() {
+				Expect(err).To(MatchError(catalog.ErrInvalidMember))
+			})
+		})
+	})
+	Context("Update", func() {
+		BeforeEach(func() {
+			z = readZone(testCatalogZone)
+			err = catalog.Update(z, []*catalog.Member{
+				{ID: "a", Zone: "example.jp."},
+				{ID: "x", Zone: "example.org."},
+			}, nil)
+		})
+		It("replaces members", func() {
+			Expect(err).To(Succeed())
+			c, err = catalog.Parse(z)
+			Expect(err).To(Succeed())
+			Expect(c.Members).To(Equal([]*catalog.Member{
+				{ID: "a", Zone: "example.jp."},
+				{ID: "x", Zone: "example.org."},
+			}))
+			Expect(c.Ignored).To(BeEmpty())
+			_, ok := z.GetRootNode().GetNameNode("group.a.zones.catalog.invalid.")
+			Expect(ok).To(BeFalse())
+		})
+	})
+	Context("Diff", func() {
+		var (
+			prev, cur *catalog.Catalog
+			d         *catalog.Delta
+		)
+		BeforeEach(func() {
+			prev = &catalog.Catalog{Members: []*catalog.Member{
+				{ID: "a", Zone: "a.example."},
+				{ID: "b", Zone: "b.example."},
+				{ID: "c", Zone: "c.example."},
+				{ID: "d", Zone: "d.example.", Groups: []string{"g1"}},
+			}}
+			cur = &catalog.Catalog{Members: []*catalog.Member{
+				{ID: "a", Zone: "a.example."},
+				{ID: "c2", Zone: "c.example."},
+				{ID: "d", Zone: "d.example.", Groups: []string{"g2"}},
+				{ID: "e", Zone: "e.example."},
+			}}
+		})
+		When("prev is nil", func() {
+			BeforeEach(func() {
+				d = catalog.Diff(nil, cur)
+			})
+			It("returns all members as added", func() {
+				Expect(d.Added).To(Equal(cur.Members))
+				Expect(d.Removed).To(BeEmpty())
+				Expect(d.Changed).To(BeEmpty())
+			})
+		})
+		When("catalog is changed", func() {
+			BeforeEach(func() {
+				d = catalog.Diff(prev, cur)
+			})
+			It("returns delta", func() {
+				Expect(d.IsEmpty()).To(BeFalse())
+				Expect(d.Added).To(Equal([]*catalog.Member{cur.Members[1], cur.Members[3]}))
+				Expect(d.Removed).To(Equal([]*catalog.Member{prev.Members[2], prev.Members[1]}))
+				Expect(d.Changed).To(Equal([]*catalog.Member{cur.Members[2]}))
+			})
+		})
+		When("catalog is not changed", func() {
+			BeforeEach(func() {
+				d = catalog.Diff(prev, prev)
+			})
+			It("returns empty delta", func() {
+				Expect(d.IsEmpty()).To(BeTrue())
+			})
+		})
+	})
+})
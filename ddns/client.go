@@ -0,0 +1,291 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/dig"
+	"github.com/mimuret/dnsutils/tsig"
+)
+
+var (
+	// ErrInvalidUpdate returns when update message can't be built.
+	ErrInvalidUpdate = fmt.Errorf("invalid update message")
+	// ErrInvalidUpdateResponse returns when update response is not valid.
+	ErrInvalidUpdateResponse = fmt.Errorf("invalid update response")
+
+	// ErrUpdateRcode returns when update response rcode is not NOERROR and it has no typed error.
+	ErrUpdateRcode = fmt.Errorf("update response rcode is not NOERROR")
+	// ErrUpdateFormErr returns when update response rcode is FORMERR.
+	ErrUpdateFormErr = fmt.Errorf("update response rcode is FORMERR")
+	// ErrUpdateServFail returns when update response rcode is SERVFAIL.
+	ErrUpdateServFail = fmt.Errorf("update response rcode is SERVFAIL")
+	// ErrUpdateNXDomain returns when name which should be in use is not in use.
+	ErrUpdateNXDomain = fmt.Errorf("update response rcode is NXDOMAIN")
+	// ErrUpdateNotImp returns when update response rcode is NOTIMP.
+	ErrUpdateNotImp = fmt.Errorf("update response rcode is NOTIMP")
+	// ErrUpdateRefused returns when update response rcode is REFUSED.
+	ErrUpdateRefused = fmt.Errorf("update response rcode is REFUSED")
+	// ErrUpdateYXDomain returns when name which should not be in use is in use.
+	ErrUpdateYXDomain = fmt.Errorf("update response rcode is YXDOMAIN")
+	// ErrUpdateYXRRSet returns when rrset which should not exist exists.
+	ErrUpdateYXRRSet = fmt.Errorf("update response rcode is YXRRSET")
+	// ErrUpdateNXRRSet returns when rrset which should exist does not exist.
+	ErrUpdateNXRRSet = fmt.Errorf("update response rcode is NXRRSET")
+	// ErrUpdateNotAuth returns when update response rcode is NOTAUTH.
+	ErrUpdateNotAuth = fmt.Errorf("update response rcode is NOTAUTH")
+	// ErrUpdateNotZone returns when update response rcode is NOTZONE.
+	ErrUpdateNotZone = fmt.Errorf("update response rcode is NOTZONE")
+)
+
+var rcodeErrors = map[int]error{
+	dns.RcodeFormatError:    ErrUpdateFormErr,
+	dns.RcodeServerFailure:  ErrUpdateServFail,
+	dns.RcodeNameError:      ErrUpdateNXDomain,
+	dns.RcodeNotImplemented: ErrUpdateNotImp,
+	dns.RcodeRefused:        ErrUpdateRefused,
+	dns.RcodeYXDomain:       ErrUpdateYXDomain,
+	dns.RcodeYXRrset:        ErrUpdateYXRRSet,
+	dns.RcodeNXRrset:        ErrUpdateNXRRSet,
+	dns.RcodeNotAuth:        ErrUpdateNotAuth,
+	dns.RcodeNotZone:        ErrUpdateNotZone,
+}
+
+// RcodeToError returns typed error of update response rcode.
+// If rcode is NOERROR, it returns nil.
+func RcodeToError(rcode int) error {
+	if rcode == dns.RcodeSuccess {
+		return nil
+	}
+	if err, ok := rcodeErrors[rcode]; ok {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrUpdateRcode, dns.RcodeToString[rcode])
+}
+
+// UpdateBuilder is fluent builder of RFC 2136 update message.
+// The first error is kept and returned by Msg and Send.
+//
+//	msg, err := NewUpdateBuilder("example.jp.", dns.ClassINET).
+//		NameNotInUse("www.example.jp.").
+//		AddRR(rr).
+//		Msg()
+type UpdateBuilder struct {
+	zone  string
+	class dns.Class
+	msg   *dns.Msg
+	key   *tsig.Key
+	err   error
+}
+
+// NewUpdateBuilder creates UpdateBuilder for zone.
+func NewUpdateBuilder(zone string, class dns.Class) *UpdateBuilder {
+	b := &UpdateBuilder{
+		zone:  dns.CanonicalName(zone),
+		class: class,
+		msg:   &dns.Msg{},
+	}
+	if _, ok := dns.IsDomainName(zone); !ok {
+		b.err = fmt.Errorf("%w: invalid zone name `%s`", ErrInvalidUpdate, zone)
+	}
+	b.msg.SetUpdate(b.zone)
+	b.msg.Question[0].Qclass = uint16(class)
+	return b
+}
+
+func (b *UpdateBuilder) checkName(name string) bool {
+	if b.err != nil {
+		return false
+	}
+	if !dns.IsSubDomain(b.zone, name) {
+		b.err = fmt.Errorf("%w: `%s` is not in zone", ErrInvalidUpdate, name)
+		return false
+	}
+	return true
+}
+
+func (b *UpdateBuilder) checkRRSet(set dnsutils.RRSetInterface) bool {
+	if b.err != nil {
+		return false
+	}
+	if dnsutils.IsEmptyRRSet(set) {
+		b.err = fmt.Errorf("%w: empty rrset", ErrInvalidUpdate)
+		return false
+	}
+	return b.checkName(set.GetName())
+}
+
+func (b *UpdateBuilder) copyRRs(rrs []dns.RR) []dns.RR {
+	res := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		if !b.checkName(rr.Header().Name) {
+			return nil
+		}
+		res = append(res, dns.Copy(rr))
+	}
+	return res
+}
+
+func anyRR(name string, rrtype uint16, class uint16) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{Name: dns.Fqdn(name), Rrtype: rrtype, Class: class}}
+}
+
+// NameInUse adds prerequisite "Name is in use". RFC 2136 section 2.4.4.
+func (b *UpdateBuilder) NameInUse(name string) *UpdateBuilder {
+	if b.checkName(name) {
+		b.msg.Answer = append(b.msg.Answer, anyRR(name, dns.TypeANY, dns.ClassANY))
+	}
+	return b
+}
+
+// NameNotInUse adds prerequisite "Name is not in use". RFC 2136 section 2.4.5.
+func (b *UpdateBuilder) NameNotInUse(name string) *UpdateBuilder {
+	if b.checkName(name) {
+		b.msg.Answer = append(b.msg.Answer, anyRR(name, dns.TypeANY, dns.ClassNONE))
+	}
+	return b
+}
+
+// RRSetExists adds prerequisite "RRset exists (value independent)". RFC 2136 section 2.4.1.
+func (b *UpdateBuilder) RRSetExists(name string, rrtype uint16) *UpdateBuilder {
+	if b.checkName(name) {
+		b.msg.Answer = append(b.msg.Answer, anyRR(name, rrtype, dns.ClassANY))
+	}
+	return b
+}
+
+// RRSetEquals adds prerequisite "RRset exists (value dependent)". RFC 2136 section 2.4.2.
+func (b *UpdateBuilder) RRSetEquals(set dnsutils.RRSetInterface) *UpdateBuilder {
+	if !b.checkRRSet(set) {
+		return b
+	}
+	for _, rr := range b.copyRRs(set.GetRRs()) {
+		rr.Header().Class = uint16(b.class)
+		rr.Header().Ttl = 0
+		b.msg.Answer = append(b.msg.Answer, rr)
+	}
+	return b
+}
+
+// RRSetNotExists adds prerequisite "RRset does not exist". RFC 2136 section 2.4.3.
+func (b *UpdateBuilder) RRSetNotExists(name string, rrtype uint16) *UpdateBuilder {
+	if b.checkName(name) {
+		b.msg.Answer = append(b.msg.Answer, anyRR(name, rrtype, dns.ClassNONE))
+	}
+	return b
+}
+
+// AddRR adds RRs to rrsets. RFC 2136 section 2.5.1.
+func (b *UpdateBuilder) AddRR(rrs ...dns.RR) *UpdateBuilder {
+	for _, rr := range b.copyRRs(rrs) {
+		rr.Header().Class = uint16(b.class)
+		b.msg.Ns = append(b.msg.Ns, rr)
+	}
+	return b
+}
+
+// Add adds all RRs of rrset. RFC 2136 section 2.5.1.
+func (b *UpdateBuilder) Add(set dnsutils.RRSetInterface) *UpdateBuilder {
+	if b.checkRRSet(set) {
+		b.AddRR(set.GetRRs()...)
+	}
+	return b
+}
+
+// RemoveRRSet deletes rrset. RFC 2136 section 2.5.2.
+func (b *UpdateBuilder) RemoveRRSet(name string, rrtype uint16) *UpdateBuilder {
+	if b.checkName(name) {
+		b.msg.Ns = append(b.msg.Ns, anyRR(name, rrtype, dns.ClassANY))
+	}
+	return b
+}
+
+// RemoveName deletes all rrsets of name. RFC 2136 section 2.5.3.
+func (b *UpdateBuilder) RemoveName(name string) *UpdateBuilder {
+	if b.checkName(name) {
+		b.msg.Ns = append(b.msg.Ns, anyRR(name, dns.TypeANY, dns.ClassANY))
+	}
+	return b
+}
+
+// RemoveRR deletes RRs from rrsets. RFC 2136 section 2.5.4.
+func (b *UpdateBuilder) RemoveRR(rrs ...dns.RR) *UpdateBuilder {
+	for _, rr := range b.copyRRs(rrs) {
+		rr.Header().Class = dns.ClassNONE
+		rr.Header().Ttl = 0
+		b.msg.Ns = append(b.msg.Ns, rr)
+	}
+	return b
+}
+
+// Remove deletes all RRs of rrset. RFC 2136 section 2.5.4.
+func (b *UpdateBuilder) Remove(set dnsutils.RRSetInterface) *UpdateBuilder {
+	if b.checkRRSet(set) {
+		b.RemoveRR(set.GetRRs()...)
+	}
+	return b
+}
+
+// TSIG sets TSIG key for signing.
+func (b *UpdateBuilder) TSIG(key *tsig.Key) *UpdateBuilder {
+	if b.err != nil {
+		return b
+	}
+	k := *key
+	if err := k.Validate(); err != nil {
+		b.err = fmt.Errorf("%w: %w", ErrInvalidUpdate, err)
+		return b
+	}
+	b.key = &k
+	return b
+}
+
+// Msg returns update message.
+// If TSIG key is set, message has TSIG RR which is signed when it is sent.
+func (b *UpdateBuilder) Msg() (*dns.Msg, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	msg := b.msg.Copy()
+	if b.key != nil {
+		msg.SetTsig(b.key.Name, b.key.Algorithm, tsig.DefaultFudge, time.Now().Unix())
+	}
+	return msg, nil
+}
+
+// Send sends update message by d and returns response.
+// If d is nil, it uses dig.NewDig. d is not modified.
+// If response rcode is not NOERROR, it returns response and typed error such as ErrUpdateNXRRSet.
+func (b *UpdateBuilder) Send(ctx context.Context, d *dig.Dig, options ...dig.Option) (*dns.Msg, error) {
+	msg, err := b.Msg()
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		d = dig.NewDig()
+	}
+	dd := *d
+	if dd.Client == nil {
+		dd.Client = &dns.Client{}
+	}
+	client := *dd.Client
+	dd.Client = &client
+	if b.key != nil {
+		kr, err := tsig.NewKeyRing(b.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create key ring: %w", err)
+		}
+		client.TsigProvider = kr
+	}
+	resp, err := dd.ExchangeContext(ctx, msg, options...)
+	if err != nil {
+		return resp, fmt.Errorf("failed to exchange: %w", err)
+	}
+	if !resp.Response || resp.Opcode != dns.OpcodeUpdate || resp.Id != msg.Id {
+		return resp, ErrInvalidUpdateResponse
+	}
+	return resp, RcodeToError(resp.Rcode)
+}
@@ -0,0 +1,164 @@
+package ddns_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/ddns"
+	"github.com/mimuret/dnsutils/dig"
+	. "github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/tsig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// startUpdateServer starts udp server which serves update messages by d.
+func startUpdateServer(d *ddns.DDNS, zone dnsutils.ZoneInterface, kr *tsig.KeyRing) (*dns.Server, *dig.Dig) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).To(Succeed())
+	startCh := make(chan struct{})
+	wr := ddns.NewWireRecorder()
+	d.SetWireRecorder(wr)
+	svc := &dns.Server{PacketConn: pc, Net: "udp", NotifyStartedFunc: func() { close(startCh) },
+		MsgAcceptFunc:  ddns.MsgAcceptFunc,
+		DecorateReader: wr.DecorateReader,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			_ = d.ServeUpdateMsg(zone, w, r)
+		}),
+	}
+	if kr != nil {
+		svc.TsigProvider = kr
+	}
+	go svc.ActivateAndServe()
+	<-startCh
+	client := dig.NewDig()
+	client.Target = pc.LocalAddr().String()
+	return svc, client
+}
+
+var _ = Describe("UpdateBuilder", func() {
+	var (
+		b   *ddns.UpdateBuilder
+		msg *dns.Msg
+		err error
+	)
+	BeforeEach(func() {
+		b = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET)
+	})
+	Context("Msg", func() {
+		It("builds prerequisite and update sections", func() {
+			set := dnsutils.NewRRSetFromRRs([]dns.RR{
+				MustNewRR("mail.example.jp. 300 IN A 192.168.1.1"),
+				MustNewRR("mail.example.jp. 300 IN A 192.168.1.2"),
+			})
+			rr := MustNewRR("www.example.jp. 300 IN A 192.168.0.1")
+			msg, err = b.NameInUse("mail.example.jp.").
+				NameNotInUse("www.example.jp.").
+				RRSetExists("mail.example.jp.", dns.TypeA).
+				RRSetNotExists("mail.example.jp.", dns.TypeAAAA).
+				RRSetEquals(set).
+				Add(set).
+				AddRR(rr).
+				RemoveRRSet("help.example.jp.", dns.TypeA).
+				RemoveName("old.example.jp.").
+				Remove(set).
+				Msg()
+			Expect(err).To(Succeed())
+			Expect(msg.Opcode).To(Equal(dns.OpcodeUpdate))
+			Expect(msg.Question).To(Equal([]dns.Question{{Name: "example.jp.", Qtype: dns.TypeSOA, Qclass: dns.ClassINET}}))
+			Expect(msg.Answer).To(Equal([]dns.RR{
+				&dns.ANY{Hdr: dns.RR_Header{Name: "mail.example.jp.", Rrtype: dns.TypeANY, Class: dns.ClassANY}},
+				&dns.ANY{Hdr: dns.RR_Header{Name: "www.example.jp.", Rrtype: dns.TypeANY, Class: dns.ClassNONE}},
+				&dns.ANY{Hdr: dns.RR_Header{Name: "mail.example.jp.", Rrtype: dns.TypeA, Class: dns.ClassANY}},
+				&dns.ANY{Hdr: dns.RR_Header{Name: "mail.example.jp.", Rrtype: dns.TypeAAAA, Class: dns.ClassNONE}},
+				MustNewRR("mail.example.jp. 0 IN A 192.168.1.1"),
+				MustNewRR("mail.example.jp. 0 IN A 192.168.1.2"),
+			}))
+			Expect(msg.Ns).To(Equal([]dns.RR{
+				MustNewRR("mail.example.jp. 300 IN A 192.168.1.1"),
+				MustNewRR("mail.example.jp. 300 IN A 192.168.1.2"),
+				MustNewRR("www.example.jp. 300 IN A 192.168.0.1"),
+				&dns.ANY{Hdr: dns.RR_Header{Name: "help.example.jp.", Rrtype: dns.TypeA, Class: dns.ClassANY}},
+				&dns.ANY{Hdr: dns.RR_Header{Name: "old.example.jp.", Rrtype: dns.TypeANY, Class: dns.ClassANY}},
+				MustNewRR("mail.example.jp. 0 NONE A 192.168.1.1"),
+				MustNewRR("mail.example.jp. 0 NONE A 192.168.1.2"),
+			}))
+			// arguments are not modified
+			Expect(set.GetRRs()[0]).To(Equal(MustNewRR("mail.example.jp. 300 IN A 192.168.1.1")))
+			Expect(rr).To(Equal(MustNewRR("www.example.jp. 300 IN A 192.168.0.1")))
+		})
+		It("adds TSIG RR", func() {
+			msg, err = b.TSIG(&tsig.Key{Name: "key.example.jp", Algorithm: "hmac-sha256", Secret: "c2VjcmV0"}).Msg()
+			Expect(err).To(Succeed())
+			Expect(msg.IsTsig()).NotTo(BeNil())
+			Expect(msg.IsTsig().Hdr.Name).To(Equal("key.example.jp."))
+		})
+		It("returns ErrInvalidUpdate for out of zone name", func() {
+			_, err = b.NameInUse("example.com.").AddRR(MustNewRR("www.example.jp. 300 IN A 192.168.0.1")).Msg()
+			Expect(err).To(MatchError(ddns.ErrInvalidUpdate))
+		})
+		It("returns ErrInvalidUpdate for invalid key", func() {
+			_, err = b.TSIG(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "!!"}).Msg()
+			Expect(err).To(MatchError(ddns.ErrInvalidUpdate))
+			Expect(err).To(MatchError(tsig.ErrInvalidKey))
+		})
+	})
+	Context("RcodeToError", func() {
+		It("returns typed error", func() {
+			Expect(ddns.RcodeToError(dns.RcodeSuccess)).To(Succeed())
+			Expect(ddns.RcodeToError(dns.RcodeYXDomain)).To(Equal(ddns.ErrUpdateYXDomain))
+			Expect(ddns.RcodeToError(dns.RcodeNXRrset)).To(Equal(ddns.ErrUpdateNXRRSet))
+			Expect(ddns.RcodeToError(dns.RcodeBadVers)).To(MatchError(ddns.ErrUpdateRcode))
+		})
+	})
+	Context("Send", func() {
+		var (
+			zone *dnsutils.Zone
+			svc  *dns.Server
+			d    *dig.Dig
+			key  = &tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+			rr   = MustNewRR("new.example.jp. 300 IN A 192.168.0.10")
+		)
+		BeforeEach(func() {
+			zone, err = dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+			Expect(err).To(Succeed())
+			Expect(zone.Read(bytes.NewBuffer(zonefile))).To(Succeed())
+			kr, err := tsig.NewKeyRing(key)
+			Expect(err).To(Succeed())
+			server := ddns.NewDDNS(ddns.NewZoneUpdate(zone, nil))
+			server.SetKeyRing(kr)
+			svc, d = startUpdateServer(server, zone, kr)
+		})
+		AfterEach(func() {
+			svc.Shutdown()
+		})
+		It("updates zone", func() {
+			msg, err = b.NameNotInUse("new.example.jp.").AddRR(rr).TSIG(key).Send(context.Background(), d)
+			Expect(err).To(Succeed())
+			Expect(msg.Rcode).To(Equal(dns.RcodeSuccess))
+			nn, ok := zone.GetRootNode().GetNameNode("new.example.jp.")
+			Expect(ok).To(BeTrue())
+			Expect(nn.GetRRSet(dns.TypeA).GetRRs()).To(HaveLen(1))
+			Expect(nn.GetRRSet(dns.TypeA).GetRRs()[0].String()).To(Equal(rr.String()))
+			Expect(d.Client.TsigProvider).To(BeNil())
+		})
+		It("returns typed error for prerequisite failure", func() {
+			_, err = b.NameNotInUse("www.example.jp.").AddRR(rr).TSIG(key).Send(context.Background(), d)
+			Expect(err).To(Equal(ddns.ErrUpdateYXDomain))
+			_, err = b.RRSetExists("www.example.jp.", dns.TypeA).TSIG(key).Send(context.Background(), d)
+			Expect(err).To(Equal(ddns.ErrUpdateYXDomain))
+			_, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).RRSetExists("www.example.jp.", dns.TypeA).TSIG(key).Send(context.Background(), d)
+			Expect(err).To(Equal(ddns.ErrUpdateNXRRSet))
+			_, ok := zone.GetRootNode().GetNameNode("new.example.jp.")
+			Expect(ok).To(BeFalse())
+		})
+		It("returns ErrUpdateRefused for unsigned request", func() {
+			msg, err = b.AddRR(rr).Send(context.Background(), d)
+			Expect(err).To(Equal(ddns.ErrUpdateRefused))
+			Expect(msg.Rcode).To(Equal(dns.RcodeRefused))
+		})
+	})
+})
@@ -1,8 +1,13 @@
 package ddns
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/miekg/dns"
 	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/tsig"
 )
 
 // UpdateInterface is update zone interface
@@ -45,11 +50,167 @@ func NewDDNS(ui UpdateInterface) *DDNS {
 // DDNS is dynamic update struct
 // It can process update message and It updates zone data using UpdateInterface.
 type DDNS struct {
-	ui UpdateInterface
+	ui         UpdateInterface
+	keyRing    *tsig.KeyRing
+	policy     *UpdatePolicy
+	fmu        sync.RWMutex
+	forwarders map[string]*Forwarder
+	wire       *WireRecorder
+	leases     *Leases
+}
+
+// SetForwarder marks zone as secondary and sets forwarder to primary.
+// Update messages of secondary zone are forwarded to primary instead of being processed.
+// If f is nil, zone is marked as primary.
+func (d *DDNS) SetForwarder(zone string, f *Forwarder) {
+	d.fmu.Lock()
+	defer d.fmu.Unlock()
+	if d.forwarders == nil {
+		d.forwarders = map[string]*Forwarder{}
+	}
+	zone = dns.CanonicalName(zone)
+	if f == nil {
+		delete(d.forwarders, zone)
+		return
+	}
+	d.forwarders[zone] = f
+}
+
+func (d *DDNS) getForwarder(zone dnsutils.ZoneInterface) *Forwarder {
+	if zone == nil {
+		return nil
+	}
+	d.fmu.RLock()
+	defer d.fmu.RUnlock()
+	return d.forwarders[dns.CanonicalName(zone.GetName())]
+}
+
+// SetWireRecorder sets recorder of received wire format.
+// If TSIG is kept by forwarder, the recorded wire format is forwarded instead of re-packed message.
+// Without recorder, name compressed requests signed by clients fail TSIG verification on primary.
+func (d *DDNS) SetWireRecorder(wr *WireRecorder) {
+	d.wire = wr
+}
+
+// SetUpdatePolicy sets update policy.
+// If update policy is set, UpdatePrescan refuses updates which are not granted.
+func (d *DDNS) SetUpdatePolicy(p *UpdatePolicy) {
+	d.policy = p
+}
+
+// SetKeyRing sets TSIG key ring.
+// If key ring is set, ServeUpdateMsg rejects update messages without valid TSIG.
+func (d *DDNS) SetKeyRing(kr *tsig.KeyRing) {
+	d.keyRing = kr
+}
+
+// ServeUpdateMsg processes update message and writes the response.
+// If key ring is set, it checks TSIG of the request before processing and signs the response.
+// If zone is secondary, it forwards the request to primary and writes the response of primary.
+// When TSIG is kept by forwarder, TSIG of the request is checked by primary instead.
+// When TSIG is re-signed by forwarder, the request is forwarded only if its TSIG is verified by key ring.
+func (d *DDNS) ServeUpdateMsg(zone dnsutils.ZoneInterface, w dns.ResponseWriter, r *dns.Msg) error {
+	f := d.getForwarder(zone)
+	if f != nil && d.CheckZoneSection(zone, r) != dns.RcodeSuccess {
+		f = nil
+	}
+	if f != nil && f.Key != nil && d.keyRing == nil {
+		// TSIG of the request can't be verified, so it must not be re-signed.
+		res := &dns.Msg{}
+		res.SetRcode(r, dns.RcodeRefused)
+		return w.WriteMsg(res)
+	}
+	if f == nil || f.Key != nil {
+		if ok, err := d.checkTSIG(w, r); !ok {
+			return err
+		}
+	}
+	var keyName string
+	if d.keyRing != nil {
+		keyName, _ = d.keyRing.KeyName(w, r)
+	}
+	id := NewIdentity(keyName, w.RemoteAddr())
+	var (
+		rcode int
+		err   error
+	)
+	if f != nil {
+		if rcode = d.checkUpdatePolicy(r, id); rcode == dns.RcodeSuccess {
+			return d.forwardMsg(f, w, r)
+		}
+	} else {
+		rcode, err = d.ServeUpdateWithIdentity(zone, r, id)
+	}
+	res := &dns.Msg{}
+	res.SetRcode(r, rcode)
+	d.setLeaseOption(res, r)
+	if keyName != "" {
+		tsig.SetTSIG(res, r, dns.RcodeSuccess)
+	}
+	if werr := w.WriteMsg(res); werr != nil && err == nil {
+		err = werr
+	}
+	return err
+}
+
+// checkTSIG writes error response and returns false when TSIG of the request is not valid.
+func (d *DDNS) checkTSIG(w dns.ResponseWriter, r *dns.Msg) (bool, error) {
+	if d.keyRing == nil {
+		return true, nil
+	}
+	if rcode, tsigErr := d.keyRing.CheckRequest(w, r); rcode != dns.RcodeSuccess {
+		return false, w.WriteMsg(tsig.NewErrorResponse(r, rcode, tsigErr))
+	}
+	return true, nil
+}
+
+// checkUpdatePolicy returns REFUSED when update policy is set and some update RR is not granted to id.
+func (d *DDNS) checkUpdatePolicy(msg *dns.Msg, id *Identity) int {
+	if d.policy == nil {
+		return dns.RcodeSuccess
+	}
+	for _, rr := range msg.Ns {
+		if !d.policy.IsAllowed(id, rr) {
+			return dns.RcodeRefused
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+func (d *DDNS) forwardMsg(f *Forwarder, w dns.ResponseWriter, r *dns.Msg) error {
+	var wire []byte
+	if d.wire != nil && f.Key == nil {
+		wire, _ = d.wire.Get(w, r)
+	}
+	res, raw, err := f.exchange(context.Background(), r, wire)
+	if err != nil {
+		res = &dns.Msg{}
+		res.SetRcode(r, dns.RcodeServerFailure)
+	} else if raw != nil {
+		// the response is signed by primary.
+		_, err = w.Write(raw)
+		return err
+	}
+	if d.keyRing != nil && f.Key != nil {
+		tsig.SetTSIG(res, r, dns.RcodeSuccess)
+	}
+	if werr := w.WriteMsg(res); werr != nil && err == nil {
+		err = werr
+	}
+	return err
 }
 
 // DDNS.ServeUpdate is process update message
 func (d *DDNS) ServeUpdate(zone dnsutils.ZoneInterface, r *dns.Msg) (int, error) {
+	return d.ServeUpdateWithIdentity(zone, r, nil)
+}
+
+// ServeUpdateWithIdentity is process update message by identity.
+// identity is used for update policy.
+// If zone is secondary, it forwards update message to primary and returns rcode of primary.
+// When TSIG is re-signed by forwarder, id must have verified TSIG key name, otherwise it returns REFUSED.
+// It does not serialize updates. Updates of the same zone must be processed one by one by the caller, e.g. Handler.
+func (d *DDNS) ServeUpdateWithIdentity(zone dnsutils.ZoneInterface, r *dns.Msg, id *Identity) (int, error) {
 	// zone not found
 	if zone == nil {
 		return dns.RcodeRefused, nil
@@ -58,7 +219,20 @@ func (d *DDNS) ServeUpdate(zone dnsutils.ZoneInterface, r *dns.Msg) (int, error)
 	if rcode != dns.RcodeSuccess {
 		return rcode, nil
 	}
-	rcode = d.UpdatePrescan(zone, r)
+	if f := d.getForwarder(zone); f != nil {
+		if f.Key != nil && (id == nil || id.KeyName == "") {
+			return dns.RcodeRefused, nil
+		}
+		if rcode := d.checkUpdatePolicy(r, id); rcode != dns.RcodeSuccess {
+			return rcode, nil
+		}
+		res, err := f.Forward(context.Background(), r)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		return res.Rcode, nil
+	}
+	rcode = d.UpdatePrescanWithIdentity(zone, r, id)
 	if rcode != dns.RcodeSuccess {
 		return rcode, nil
 	}
@@ -68,7 +242,7 @@ func (d *DDNS) ServeUpdate(zone dnsutils.ZoneInterface, r *dns.Msg) (int, error)
 		return rcode, nil
 	}
 
-	err := d.UpdateProcessing(zone, r)
+	ops, err := d.processUpdates(zone, r, d.ui)
 	if err != nil {
 		d.ui.UpdateFailedPostProcess(err)
 		return dns.RcodeServerFailure, err
@@ -76,6 +250,10 @@ func (d *DDNS) ServeUpdate(zone dnsutils.ZoneInterface, r *dns.Msg) (int, error)
 	if err := d.ui.UpdatePostProcess(); err != nil {
 		return dns.RcodeServerFailure, err
 	}
+	if d.leases != nil {
+		lease, keyLease, ok := GetUpdateLease(r)
+		d.leases.apply(ops, lease, keyLease, ok, time.Now())
+	}
 
 	return dns.RcodeSuccess, nil
 }
@@ -256,6 +434,12 @@ func (d *DDNS) PrerequisiteProessing(z dnsutils.ZoneInterface, msg *dns.Msg) int
 */
 
 func (d *DDNS) UpdatePrescan(z dnsutils.ZoneInterface, msg *dns.Msg) int {
+	return d.UpdatePrescanWithIdentity(z, msg, nil)
+}
+
+// UpdatePrescanWithIdentity is UpdatePrescan with update policy check.
+// If update policy is set and rr is not granted to identity, it returns REFUSED.
+func (d *DDNS) UpdatePrescanWithIdentity(z dnsutils.ZoneInterface, msg *dns.Msg, id *Identity) int {
 	for _, rr := range msg.Ns {
 		if !dns.IsSubDomain(z.GetName(), rr.Header().Name) {
 			return dns.RcodeNotZone
@@ -296,7 +480,7 @@ func (d *DDNS) UpdatePrescan(z dnsutils.ZoneInterface, msg *dns.Msg) int {
 			}
 		}
 	}
-	return dns.RcodeSuccess
+	return d.checkUpdatePolicy(msg, id)
 }
 
 /*
@@ -342,23 +526,61 @@ func (d *DDNS) UpdatePrescan(z dnsutils.ZoneInterface, msg *dns.Msg) int {
 
 */
 
+// UpdateProcessing processes update section.
+// Update RRs are processed in order, and each RR is checked against the zone
+// which the previous RRs are applied to.
 func (d *DDNS) UpdateProcessing(z dnsutils.ZoneInterface, m *dns.Msg) error {
+	_, err := d.processUpdates(z, m, d.ui)
+	return err
+}
+
+// processUpdates plans update RRs in order and applies the operations to ui.
+// If ui is ZoneUpdate, RRs are checked against its staged zone.
+// Otherwise the changes by previous RRs are tracked by overlay which copies only touched names.
+// If ui is nil, operations are only planned.
+func (d *DDNS) processUpdates(z dnsutils.ZoneInterface, m *dns.Msg, ui UpdateInterface) ([]*PlanOperation, error) {
+	var (
+		overlay     *updateOverlay
+		getNameNode nameNodeGetter
+	)
+	if u, ok := ui.(*ZoneUpdate); ok {
+		getNameNode = u.getNameNode
+	} else {
+		overlay = newUpdateOverlay(z)
+		getNameNode = overlay.getNameNode
+	}
+	ops := []*PlanOperation{}
 	for _, rr := range m.Ns {
-		if rr.Header().Class == m.Question[0].Qclass {
-			if err := d.UpdateAdd(z, rr); err != nil {
-				return err
-			}
+		op := planUpdate(z, getNameNode, m, rr)
+		if op == nil {
+			continue
 		}
-		if rr.Header().Class == dns.ClassANY {
-			if err := d.UpdateRemoveRR(z, rr); err != nil {
-				return err
+		if overlay != nil {
+			if err := overlay.apply(op); err != nil {
+				return ops, err
 			}
 		}
-		if rr.Header().Class == dns.ClassNONE {
-			if err := d.UpdateRemoveRDATA(z, rr); err != nil {
-				return err
+		if ui != nil {
+			if err := applyOperation(ui, op); err != nil {
+				return ops, err
 			}
 		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// nameNodeGetter returns name node of zone.
+type nameNodeGetter func(name string) (dnsutils.NameNodeInterface, bool)
+
+func planUpdate(z dnsutils.ZoneInterface, getNameNode nameNodeGetter, m *dns.Msg, rr dns.RR) *PlanOperation {
+	switch rr.Header().Class {
+	case m.Question[0].Qclass:
+		return planAdd(getNameNode, rr)
+	case dns.ClassANY:
+		return planRemoveRR(z, rr)
+	case dns.ClassNONE:
+		return planRemoveRDATA(z, rr)
 	}
 	return nil
 }
@@ -391,8 +613,12 @@ for zrr in zone_rrset<rr.name, rr.type>
 zone_rrset<rr.name, rr.type> += rr
 */
 func (d *DDNS) UpdateAdd(z dnsutils.ZoneInterface, rr dns.RR) error {
+	return applyOperation(d.ui, planAdd(z.GetRootNode().GetNameNode, rr))
+}
+
+func planAdd(getNameNode nameNodeGetter, rr dns.RR) *PlanOperation {
 	var set dnsutils.RRSetInterface
-	nn, ok := z.GetRootNode().GetNameNode(rr.Header().Name)
+	nn, ok := getNameNode(rr.Header().Name)
 	if !ok {
 		nn = nil
 	} else {
@@ -408,10 +634,10 @@ func (d *DDNS) UpdateAdd(z dnsutils.ZoneInterface, rr dns.RR) error {
 		*/
 		if rr.Header().Rrtype == dns.TypeCNAME {
 			if dnsutils.IsEmptyRRSet(set) && nn.RRSetLen() > 0 {
-				return nil
+				return skipOperation(rr, "name has other rrsets than CNAME")
 			}
 		} else if !dnsutils.IsEmptyRRSet(nn.GetRRSet(dns.TypeCNAME)) {
-			return nil
+			return skipOperation(rr, "name has CNAME")
 		}
 		/*
 			if (rr.type == SOA)
@@ -422,18 +648,18 @@ func (d *DDNS) UpdateAdd(z dnsutils.ZoneInterface, rr dns.RR) error {
 		*/
 		if rr.Header().Rrtype == dns.TypeSOA {
 			if dnsutils.IsEmptyRRSet(set) {
-				return nil
+				return skipOperation(rr, "SOA does not exist")
 			}
-			soa, ok := set.GetRRs()[0].(*dns.SOA)
-			if !ok {
-				return nil
+			soa, err := dnsutils.GetFirstTyped[*dns.SOA](nn, dns.TypeSOA)
+			if err != nil {
+				return skipOperation(rr, "SOA does not exist")
 			}
 			srr, ok := rr.(*dns.SOA)
 			if !ok {
-				return nil
+				return skipOperation(rr, "invalid SOA")
 			}
 			if soa.Serial > srr.Serial {
-				return nil
+				return skipOperation(rr, "SOA serial is older than zone")
 			}
 		}
 		/*
@@ -447,60 +673,66 @@ func (d *DDNS) UpdateAdd(z dnsutils.ZoneInterface, rr dns.RR) error {
 			wks is not supported
 		*/
 		if rr.Header().Rrtype == dns.TypeCNAME || rr.Header().Rrtype == dns.TypeSOA {
-			set := dnsutils.NewRRSetFromRR(rr)
-			if err := d.ui.ReplaceRRSet(set); err != nil {
-				return err
-			}
-			return nil
+			return &PlanOperation{Action: PlanActionReplace, RR: rr}
 		}
 	}
 	/*
 	 zone_rrset<rr.name, rr.type> += rr
 	*/
-	if err := d.ui.AddRR(rr); err != nil {
-		return err
-	}
-	return nil
+	return &PlanOperation{Action: PlanActionAdd, RR: rr}
 }
 
 // process Remove name and rrset
 func (d *DDNS) UpdateRemoveRR(z dnsutils.ZoneInterface, rr dns.RR) error {
+	return applyOperation(d.ui, planRemoveRR(z, rr))
+}
+
+func planRemoveRR(z dnsutils.ZoneInterface, rr dns.RR) *PlanOperation {
 	if rr.Header().Rrtype == dns.TypeANY {
 		// Delete all RRsets from a name
 		if dnsutils.Equals(rr.Header().Name, z.GetName()) {
 			// remove zone apex name rr other than SOA,NS
-			if err := d.ui.RemoveNameApex(rr.Header().Name); err != nil {
-				return err
-			}
-		} else {
-			if err := d.ui.RemoveName(rr.Header().Name); err != nil {
-				return err
-			}
-		}
-	} else {
-		// Delete An RRset
-		if dnsutils.Equals(rr.Header().Name, z.GetName()) && rr.Header().Rrtype == dns.TypeSOA || rr.Header().Rrtype == dns.TypeNS {
-			// can not remove APEX SOA, NS
-			return nil
-		} else {
-			if err := d.ui.RemoveRRSet(rr.Header().Name, rr.Header().Rrtype); err != nil {
-				return err
-			}
+			return &PlanOperation{Action: PlanActionRemoveNameApex, RR: rr}
 		}
+		return &PlanOperation{Action: PlanActionRemoveName, RR: rr}
 	}
-	return nil
+	// Delete An RRset
+	if dnsutils.Equals(rr.Header().Name, z.GetName()) && (rr.Header().Rrtype == dns.TypeSOA || rr.Header().Rrtype == dns.TypeNS) {
+		// can not remove APEX SOA, NS
+		return skipOperation(rr, "zone apex SOA and NS can't be removed")
+	}
+	return &PlanOperation{Action: PlanActionRemoveRRSet, RR: rr}
 }
 
 // process remove RR
 func (d *DDNS) UpdateRemoveRDATA(z dnsutils.ZoneInterface, rr dns.RR) error {
+	return applyOperation(d.ui, planRemoveRDATA(z, rr))
+}
+
+func planRemoveRDATA(z dnsutils.ZoneInterface, rr dns.RR) *PlanOperation {
 	if rr.Header().Rrtype == dns.TypeSOA {
-		return nil
+		return skipOperation(rr, "SOA can't be removed")
 	}
 	if dnsutils.Equals(rr.Header().Name, z.GetName()) && rr.Header().Rrtype == dns.TypeNS {
-		return nil
+		return skipOperation(rr, "zone apex NS can't be removed")
 	}
-	if err := d.ui.RemoveRR(rr); err != nil {
-		return err
+	return &PlanOperation{Action: PlanActionRemoveRR, RR: rr}
+}
+
+func applyOperation(ui UpdateInterface, op *PlanOperation) error {
+	switch op.Action {
+	case PlanActionAdd:
+		return ui.AddRR(op.RR)
+	case PlanActionReplace:
+		return ui.ReplaceRRSet(dnsutils.NewRRSetFromRR(op.RR))
+	case PlanActionRemoveNameApex:
+		return ui.RemoveNameApex(op.RR.Header().Name)
+	case PlanActionRemoveName:
+		return ui.RemoveName(op.RR.Header().Name)
+	case PlanActionRemoveRRSet:
+		return ui.RemoveRRSet(op.RR.Header().Name, op.RR.Header().Rrtype)
+	case PlanActionRemoveRR:
+		return ui.RemoveRR(op.RR)
 	}
 	return nil
 }
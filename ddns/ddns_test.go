@@ -5,10 +5,12 @@ import (
 	_ "embed"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/mimuret/dnsutils"
 	"github.com/mimuret/dnsutils/ddns"
 	. "github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/tsig"
 
 	"github.com/miekg/dns"
 	. "github.com/onsi/ginkgo"
@@ -123,7 +125,7 @@ var _ = Describe("DDNS", func() {
 	BeforeEach(func() {
 		var err error
 		msg = &dns.Msg{}
-		msg.SetUpdate("example.jp")
+		msg.SetUpdate("example.jp.")
 		gi = NewTestUpdate()
 		ui = NewTestUpdate()
 		d = ddns.NewDDNS(ui)
@@ -195,6 +197,96 @@ var _ = Describe("DDNS", func() {
 			Expect(rc).Should(Equal(dns.RcodeSuccess))
 		})
 	})
+	Context("Test for ServeUpdateMsg", func() {
+		var (
+			w   *ResponseWriter
+			err error
+		)
+		BeforeEach(func() {
+			w = &ResponseWriter{}
+		})
+		When("key ring is not set", func() {
+			It("writes response without TSIG", func() {
+				err = d.ServeUpdateMsg(zone, w, msg)
+				Expect(err).To(Succeed())
+				Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+				Expect(w.Msg.IsTsig()).To(BeNil())
+			})
+		})
+		When("key ring is set", func() {
+			var kr *tsig.KeyRing
+			BeforeEach(func() {
+				kr, err = tsig.NewKeyRing(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})
+				Expect(err).To(Succeed())
+				d.SetKeyRing(kr)
+			})
+			It("refuses request without TSIG", func() {
+				err = d.ServeUpdateMsg(zone, w, msg)
+				Expect(err).To(Succeed())
+				Expect(w.Msg.Rcode).To(Equal(dns.RcodeRefused))
+				Expect(ui.addRRs).To(BeEmpty())
+			})
+			It("returns BADKEY for unknown key", func() {
+				msg.Insert([]dns.RR{MustNewRR("help.example.jp. 3600 IN A 192.168.2.2")})
+				msg.SetTsig("unknown.example.jp.", dns.HmacSHA256, 300, 0)
+				err = d.ServeUpdateMsg(zone, w, msg)
+				Expect(err).To(Succeed())
+				Expect(w.Msg.Rcode).To(Equal(dns.RcodeNotAuth))
+				Expect(w.Msg.IsTsig().Error).To(Equal(uint16(dns.RcodeBadKey)))
+				Expect(ui.addRRs).To(BeEmpty())
+			})
+			It("returns BADSIG for invalid MAC", func() {
+				msg.SetTsig("key.example.jp.", dns.HmacSHA256, 300, 0)
+				w.ErrTsigStatus = dns.ErrSig
+				err = d.ServeUpdateMsg(zone, w, msg)
+				Expect(err).To(Succeed())
+				Expect(w.Msg.Rcode).To(Equal(dns.RcodeNotAuth))
+				Expect(w.Msg.IsTsig().Error).To(Equal(uint16(dns.RcodeBadSig)))
+			})
+			It("processes request with valid TSIG", func() {
+				msg.Insert([]dns.RR{MustNewRR("help.example.jp. 3600 IN A 192.168.2.2")})
+				msg.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+				err = d.ServeUpdateMsg(zone, w, MustSignMsg(msg, kr))
+				Expect(err).To(Succeed())
+				Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+				Expect(w.Msg.IsTsig()).NotTo(BeNil())
+				Expect(w.Msg.IsTsig().Error).To(Equal(uint16(dns.RcodeSuccess)))
+				Expect(ui.addRRs).To(HaveLen(1))
+			})
+		})
+	})
+	Context("Test for ServeUpdateWithIdentity", func() {
+		BeforeEach(func() {
+			p, err := ddns.NewUpdatePolicy(&ddns.PolicyRule{Action: ddns.PolicyActionGrant, Key: "key.example.jp.", MatchType: ddns.PolicyMatchSubdomain, Name: "example.jp."})
+			Expect(err).To(Succeed())
+			d.SetUpdatePolicy(p)
+			msg.Insert([]dns.RR{MustNewRR("help.example.jp. 3600 IN A 192.168.2.2")})
+		})
+		It("refuses update which is not granted", func() {
+			rc, err := d.ServeUpdateWithIdentity(zone, msg, ddns.NewIdentity("other.example.jp.", nil))
+			Expect(err).To(Succeed())
+			Expect(rc).To(Equal(dns.RcodeRefused))
+			Expect(ui.addRRs).To(BeEmpty())
+			rc, err = d.ServeUpdate(zone, msg)
+			Expect(err).To(Succeed())
+			Expect(rc).To(Equal(dns.RcodeRefused))
+		})
+		It("processes granted update", func() {
+			rc, err := d.ServeUpdateWithIdentity(zone, msg, ddns.NewIdentity("key.example.jp.", nil))
+			Expect(err).To(Succeed())
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			Expect(ui.addRRs).To(HaveLen(1))
+		})
+		It("uses TSIG key name of ServeUpdateMsg", func() {
+			kr, err := tsig.NewKeyRing(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})
+			Expect(err).To(Succeed())
+			d.SetKeyRing(kr)
+			msg.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+			w := &ResponseWriter{}
+			Expect(d.ServeUpdateMsg(zone, w, MustSignMsg(msg, kr))).To(Succeed())
+			Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+		})
+	})
 	Context("Test for DDNS.CheckZoneSection", func() {
 		It("can not request multiple zone section records", func() {
 			msg.Question = append(msg.Question, dns.Question{Name: "example.jp.", Qtype: dns.TypeSOA, Qclass: dns.ClassINET})
@@ -565,6 +657,17 @@ var _ = Describe("DDNS", func() {
 				})
 			})
 		})
+		Context("Delete and add in one message", func() {
+			It("checks add against the zone which delete is applied to", func() {
+				msg.RemoveName([]dns.RR{MustNewRR("www.example.jp. 0 IN A 0.0.0.0")})
+				rr := MustNewRR("www.example.jp. 300 IN A 192.168.0.1")
+				msg.Insert([]dns.RR{rr})
+				err := d.UpdateProcessing(zone, msg)
+				Expect(err).To(Succeed())
+				Expect(ui.removeName).To(Equal([]string{"www.example.jp."}))
+				Expect(ui.addRRs).To(Equal([]dns.RR{rr}))
+			})
+		})
 		Context("Delete An RRset", func() {
 			It("can remove rrset", func() {
 				rrs := []dns.RR{
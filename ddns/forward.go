@@ -0,0 +1,252 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils/tsig"
+)
+
+var (
+	// DefaultForwardTimeout is default timeout of forwarding.
+	DefaultForwardTimeout = 5 * time.Second
+
+	// ErrForward returns when update message can't be forwarded to primary.
+	ErrForward = fmt.Errorf("failed to forward update message")
+)
+
+// Forwarder forwards update messages of secondary zone to primary server.
+// RFC 2136 section 6.
+type Forwarder struct {
+	// Primary is address of primary server. e.g. 192.168.0.1:53
+	Primary string
+	// Client is used for forwarding. If nil, it uses udp client with DefaultForwardTimeout.
+	Client *dns.Client
+	// Key re-signs forwarded messages.
+	// If nil, TSIG of the request is kept and the response of primary is passed back as is.
+	Key *tsig.Key
+}
+
+// GetClient returns client for forwarding.
+func (f *Forwarder) GetClient() *dns.Client {
+	if f.Client == nil {
+		return &dns.Client{Net: "udp", Timeout: DefaultForwardTimeout}
+	}
+	return f.Client
+}
+
+// Forward sends update message to primary and returns the response.
+// The response has the same ID as r.
+// If Key is set, TSIG of r is replaced by new one and TSIG of the response is verified and removed.
+// If the response of primary is truncated, it is sent again by TCP.
+func (f *Forwarder) Forward(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
+	res, _, err := f.exchange(ctx, r, nil)
+	return res, err
+}
+
+// exchange returns the response and its wire format when TSIG is kept.
+// wire is the received wire format of r. If TSIG is kept and wire is not nil, wire is sent as is.
+func (f *Forwarder) exchange(ctx context.Context, r *dns.Msg, wire []byte) (*dns.Msg, []byte, error) {
+	client := f.GetClient()
+	res, raw, err := f.exchangeClient(ctx, client, r, wire)
+	if err != nil || !res.Truncated || strings.HasPrefix(client.Net, "tcp") {
+		return res, raw, err
+	}
+	// rfc2136#section-6: the response is truncated, so the request is sent again by TCP.
+	tcp := &dns.Client{
+		Net:     "tcp" + strings.TrimPrefix(client.Net, "udp"),
+		Timeout: client.Timeout,
+		Dialer:  client.Dialer,
+	}
+	return f.exchangeClient(ctx, tcp, r, wire)
+}
+
+func (f *Forwarder) exchangeClient(ctx context.Context, client *dns.Client, r *dns.Msg, wire []byte) (*dns.Msg, []byte, error) {
+	req := r.Copy()
+	var kr *tsig.KeyRing
+	if f.Key != nil {
+		var err error
+		if kr, err = tsig.NewKeyRing(f.Key); err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrForward, err)
+		}
+		req.Extra = removeTSIG(req.Extra)
+		key, _ := kr.Get(f.Key.Name)
+		req.SetTsig(key.Name, key.Algorithm, tsig.DefaultFudge, time.Now().Unix())
+	}
+	conn, err := client.DialContext(ctx, f.Primary)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to connect primary: %w", ErrForward, err)
+	}
+	defer conn.Close()
+	if kr != nil {
+		conn.TsigProvider = kr
+	}
+	timeout := client.Timeout
+	if timeout == 0 {
+		timeout = DefaultForwardTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrForward, err)
+	}
+	if f.Key != nil {
+		if err := conn.WriteMsg(req); err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to write message: %w", ErrForward, err)
+		}
+		res, err := conn.ReadMsg()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to read response: %w", ErrForward, err)
+		}
+		if res.Id != req.Id {
+			return nil, nil, fmt.Errorf("%w: %w", ErrForward, dns.ErrId)
+		}
+		res.Extra = removeTSIG(res.Extra)
+		return res, nil, nil
+	}
+	// The request is already signed by the client, so it is written without signing.
+	// Packed message may differ from the signed one (e.g. name compression), so the received wire format is preferred.
+	buf := wire
+	if buf == nil {
+		if buf, err = req.Pack(); err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to pack message: %w", ErrForward, err)
+		}
+	}
+	if _, err := conn.Write(buf); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to write message: %w", ErrForward, err)
+	}
+	p, err := conn.ReadMsgHeader(nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to read response: %w", ErrForward, err)
+	}
+	res := &dns.Msg{}
+	if err := res.Unpack(p); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to parse response: %w", ErrForward, err)
+	}
+	if res.Id != req.Id {
+		return nil, nil, fmt.Errorf("%w: %w", ErrForward, dns.ErrId)
+	}
+	return res, p, nil
+}
+
+func removeTSIG(rrs []dns.RR) []dns.RR {
+	var res []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype != dns.TypeTSIG {
+			res = append(res, rr)
+		}
+	}
+	return res
+}
+
+// wireLifetime is the time to keep wire format of received messages.
+const wireLifetime = time.Minute
+
+// WireRecorder keeps wire format of received UPDATE messages.
+// DDNS forwards the kept wire format when TSIG of the request is kept by Forwarder,
+// because the MAC can't be verified with re-packed message.
+// It is used as dns.Server.DecorateReader, and it is set to DDNS by SetWireRecorder.
+type WireRecorder struct {
+	mu        sync.Mutex
+	msgs      map[string]wireMsg
+	nextSweep time.Time
+}
+
+type wireMsg struct {
+	bs     []byte
+	expire time.Time
+}
+
+// NewWireRecorder creates WireRecorder.
+func NewWireRecorder() *WireRecorder {
+	return &WireRecorder{msgs: map[string]wireMsg{}}
+}
+
+// DecorateReader is dns.DecorateReader which records UPDATE messages read by r.
+func (wr *WireRecorder) DecorateReader(r dns.Reader) dns.Reader {
+	return &wireReader{Reader: r, wr: wr}
+}
+
+func wireKey(addr net.Addr, id uint16) string {
+	return fmt.Sprintf("%s/%d", addr.String(), id)
+}
+
+func (wr *WireRecorder) record(addr net.Addr, bs []byte) {
+	if addr == nil || len(bs) < 12 || int(bs[2]>>3)&0xF != dns.OpcodeUpdate {
+		return
+	}
+	now := time.Now()
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	if wr.msgs == nil {
+		wr.msgs = map[string]wireMsg{}
+	}
+	if now.After(wr.nextSweep) {
+		for k, m := range wr.msgs {
+			if now.After(m.expire) {
+				delete(wr.msgs, k)
+			}
+		}
+		wr.nextSweep = now.Add(time.Second)
+	}
+	id := uint16(bs[0])<<8 | uint16(bs[1])
+	wr.msgs[wireKey(addr, id)] = wireMsg{bs: append([]byte(nil), bs...), expire: now.Add(wireLifetime)}
+}
+
+// Get returns wire format of r which is received from remote address of w, and forgets it.
+func (wr *WireRecorder) Get(w dns.ResponseWriter, r *dns.Msg) ([]byte, bool) {
+	key := wireKey(w.RemoteAddr(), r.Id)
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	m, ok := wr.msgs[key]
+	if !ok {
+		return nil, false
+	}
+	delete(wr.msgs, key)
+	if time.Now().After(m.expire) {
+		return nil, false
+	}
+	return m.bs, true
+}
+
+var _ dns.PacketConnReader = &wireReader{}
+
+type wireReader struct {
+	dns.Reader
+	wr *WireRecorder
+}
+
+func (r *wireReader) ReadTCP(conn net.Conn, timeout time.Duration) ([]byte, error) {
+	bs, err := r.Reader.ReadTCP(conn, timeout)
+	if err == nil {
+		r.wr.record(conn.RemoteAddr(), bs)
+	}
+	return bs, err
+}
+
+func (r *wireReader) ReadUDP(conn *net.UDPConn, timeout time.Duration) ([]byte, *dns.SessionUDP, error) {
+	bs, s, err := r.Reader.ReadUDP(conn, timeout)
+	if err == nil && s != nil {
+		r.wr.record(s.RemoteAddr(), bs)
+	}
+	return bs, s, err
+}
+
+func (r *wireReader) ReadPacketConn(conn net.PacketConn, timeout time.Duration) ([]byte, net.Addr, error) {
+	pr, ok := r.Reader.(dns.PacketConnReader)
+	if !ok {
+		return nil, nil, fmt.Errorf("PacketConnReader is not implemented")
+	}
+	bs, addr, err := pr.ReadPacketConn(conn, timeout)
+	if err == nil {
+		r.wr.record(addr, bs)
+	}
+	return bs, addr, err
+}
@@ -0,0 +1,248 @@
+package ddns_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/ddns"
+	"github.com/mimuret/dnsutils/dig"
+	. "github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/tsig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Forwarder", func() {
+	var (
+		primaryZone, secondaryZone *dnsutils.Zone
+		primarySvc, secondarySvc   *dns.Server
+		primary, secondary         *dig.Dig
+		secondaryDDNS              *ddns.DDNS
+		secondaryKR                *tsig.KeyRing
+		primaryKey                 = &tsig.Key{Name: "primary.example.jp.", Algorithm: dns.HmacSHA256, Secret: "cHJpbWFyeQ=="}
+		clientKey                  = &tsig.Key{Name: "client.example.jp.", Algorithm: dns.HmacSHA256, Secret: "Y2xpZW50"}
+		rr                         = MustNewRR("new.example.jp. 300 IN A 192.168.0.10")
+		msg                        *dns.Msg
+		err                        error
+	)
+	newZone := func() *dnsutils.Zone {
+		z, err := dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+		Expect(err).To(Succeed())
+		Expect(z.Read(bytes.NewBuffer(zonefile))).To(Succeed())
+		return z
+	}
+	hasNewRR := func(z *dnsutils.Zone) bool {
+		_, ok := z.GetRootNode().GetNameNode("new.example.jp.")
+		return ok
+	}
+	BeforeEach(func() {
+		primaryZone = newZone()
+		kr, err := tsig.NewKeyRing(primaryKey, clientKey)
+		Expect(err).To(Succeed())
+		d := ddns.NewDDNS(ddns.NewZoneUpdate(primaryZone, nil))
+		d.SetKeyRing(kr)
+		primarySvc, primary = startUpdateServer(d, primaryZone, kr)
+
+		secondaryZone = newZone()
+		secondaryDDNS = ddns.NewDDNS(ddns.NewZoneUpdate(secondaryZone, nil))
+		secondaryKR = nil
+	})
+	JustBeforeEach(func() {
+		secondarySvc, secondary = startUpdateServer(secondaryDDNS, secondaryZone, secondaryKR)
+	})
+	AfterEach(func() {
+		secondarySvc.Shutdown()
+		primarySvc.Shutdown()
+	})
+	When("TSIG is kept", func() {
+		BeforeEach(func() {
+			secondaryDDNS.SetForwarder("example.jp", &ddns.Forwarder{Primary: primary.Target})
+		})
+		It("passes back the response of primary", func() {
+			msg, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).TSIG(clientKey).Send(context.Background(), secondary)
+			Expect(err).To(Succeed())
+			Expect(msg.IsTsig()).NotTo(BeNil())
+			Expect(hasNewRR(primaryZone)).To(BeTrue())
+			Expect(hasNewRR(secondaryZone)).To(BeFalse())
+		})
+		It("forwards name compressed request as is", func() {
+			// nsupdate compresses names, so the packed message differs from the signed one.
+			req, err := ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).AddRR(MustNewRR("new.example.jp. 300 IN A 192.168.0.11")).Msg()
+			Expect(err).To(Succeed())
+			req.Compress = true
+			req.SetTsig(clientKey.Name, clientKey.Algorithm, tsig.DefaultFudge, time.Now().Unix())
+			kr, err := tsig.NewKeyRing(clientKey)
+			Expect(err).To(Succeed())
+			wire, _, err := dns.TsigGenerateWithProvider(req, kr, "", false)
+			Expect(err).To(Succeed())
+			unpacked := &dns.Msg{}
+			Expect(unpacked.Unpack(wire)).To(Succeed())
+			repacked, err := unpacked.Pack()
+			Expect(err).To(Succeed())
+			Expect(repacked).NotTo(Equal(wire))
+
+			conn, err := net.Dial("udp", secondary.Target)
+			Expect(err).To(Succeed())
+			defer conn.Close()
+			_, err = conn.Write(wire)
+			Expect(err).To(Succeed())
+			Expect(conn.SetReadDeadline(time.Now().Add(2 * time.Second))).To(Succeed())
+			buf := make([]byte, dns.MaxMsgSize)
+			n, err := conn.Read(buf)
+			Expect(err).To(Succeed())
+			msg = &dns.Msg{}
+			Expect(msg.Unpack(buf[:n])).To(Succeed())
+			Expect(msg.Rcode).To(Equal(dns.RcodeSuccess))
+			Expect(hasNewRR(primaryZone)).To(BeTrue())
+		})
+		It("passes back error of primary", func() {
+			msg, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).NameNotInUse("www.example.jp.").AddRR(rr).TSIG(clientKey).Send(context.Background(), secondary)
+			Expect(err).To(Equal(ddns.ErrUpdateYXDomain))
+			msg, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).Send(context.Background(), secondary)
+			Expect(err).To(Equal(ddns.ErrUpdateRefused))
+			Expect(hasNewRR(primaryZone)).To(BeFalse())
+		})
+	})
+	When("TSIG is re-signed", func() {
+		BeforeEach(func() {
+			secondaryKR, err = tsig.NewKeyRing(clientKey)
+			Expect(err).To(Succeed())
+			secondaryDDNS.SetKeyRing(secondaryKR)
+			secondaryDDNS.SetForwarder("example.jp.", &ddns.Forwarder{Primary: primary.Target, Key: primaryKey})
+		})
+		It("signs the response by client key", func() {
+			msg, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).TSIG(clientKey).Send(context.Background(), secondary)
+			Expect(err).To(Succeed())
+			Expect(msg.IsTsig().Hdr.Name).To(Equal("client.example.jp."))
+			Expect(hasNewRR(primaryZone)).To(BeTrue())
+		})
+		It("refuses request without TSIG", func() {
+			_, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).Send(context.Background(), secondary)
+			Expect(err).To(Equal(ddns.ErrUpdateRefused))
+			Expect(hasNewRR(primaryZone)).To(BeFalse())
+		})
+		It("refuses request with TSIG of unknown key", func() {
+			_, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).TSIG(primaryKey).Send(context.Background(), secondary)
+			Expect(err).To(HaveOccurred())
+			Expect(hasNewRR(primaryZone)).To(BeFalse())
+		})
+		It("forwards by ServeUpdateWithIdentity with verified key name", func() {
+			msg, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).Msg()
+			Expect(err).To(Succeed())
+			rc, err := secondaryDDNS.ServeUpdateWithIdentity(secondaryZone, msg, ddns.NewIdentity("client.example.jp.", nil))
+			Expect(err).To(Succeed())
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			Expect(hasNewRR(primaryZone)).To(BeTrue())
+		})
+		It("refuses ServeUpdate without identity", func() {
+			msg, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).Msg()
+			Expect(err).To(Succeed())
+			rc, err := secondaryDDNS.ServeUpdate(secondaryZone, msg)
+			Expect(err).To(Succeed())
+			Expect(rc).To(Equal(dns.RcodeRefused))
+			Expect(hasNewRR(primaryZone)).To(BeFalse())
+		})
+		When("update policy is set", func() {
+			BeforeEach(func() {
+				p, err := ddns.NewUpdatePolicy(&ddns.PolicyRule{Action: ddns.PolicyActionGrant, Key: "client.example.jp.", MatchType: ddns.PolicyMatchName, Name: "www.example.jp."})
+				Expect(err).To(Succeed())
+				secondaryDDNS.SetUpdatePolicy(p)
+			})
+			It("refuses update which is not granted without forwarding", func() {
+				_, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).TSIG(clientKey).Send(context.Background(), secondary)
+				Expect(err).To(Equal(ddns.ErrUpdateRefused))
+				Expect(hasNewRR(primaryZone)).To(BeFalse())
+				rc, err := secondaryDDNS.ServeUpdateWithIdentity(secondaryZone, msg, ddns.NewIdentity("client.example.jp.", nil))
+				Expect(err).To(Succeed())
+				Expect(rc).To(Equal(dns.RcodeRefused))
+				Expect(hasNewRR(primaryZone)).To(BeFalse())
+			})
+		})
+	})
+	When("TSIG is re-signed but key ring is not set", func() {
+		BeforeEach(func() {
+			secondaryDDNS.SetForwarder("example.jp.", &ddns.Forwarder{Primary: primary.Target, Key: primaryKey})
+		})
+		It("refuses request", func() {
+			_, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).Send(context.Background(), secondary)
+			Expect(err).To(Equal(ddns.ErrUpdateRefused))
+			_, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).TSIG(clientKey).Send(context.Background(), secondary)
+			Expect(err).To(HaveOccurred())
+			Expect(hasNewRR(primaryZone)).To(BeFalse())
+		})
+	})
+	When("response of primary is truncated", func() {
+		var (
+			udpSvc, tcpSvc *dns.Server
+			addr           string
+		)
+		BeforeEach(func() {
+			pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+			Expect(err).To(Succeed())
+			addr = pc.LocalAddr().String()
+			l, err := net.Listen("tcp", addr)
+			Expect(err).To(Succeed())
+			handler := func(truncated bool) dns.Handler {
+				return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+					res := &dns.Msg{}
+					res.SetReply(r)
+					res.Truncated = truncated
+					if truncated {
+						res.Rcode = dns.RcodeServerFailure
+					}
+					w.WriteMsg(res)
+				})
+			}
+			udpStarted, tcpStarted := make(chan struct{}), make(chan struct{})
+			udpSvc = &dns.Server{PacketConn: pc, MsgAcceptFunc: ddns.MsgAcceptFunc, Handler: handler(true), NotifyStartedFunc: func() { close(udpStarted) }}
+			tcpSvc = &dns.Server{Listener: l, MsgAcceptFunc: ddns.MsgAcceptFunc, Handler: handler(false), NotifyStartedFunc: func() { close(tcpStarted) }}
+			go udpSvc.ActivateAndServe()
+			go tcpSvc.ActivateAndServe()
+			<-udpStarted
+			<-tcpStarted
+		})
+		AfterEach(func() {
+			udpSvc.Shutdown()
+			tcpSvc.Shutdown()
+		})
+		It("retries by TCP", func() {
+			f := &ddns.Forwarder{Primary: addr}
+			req, err := ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).Msg()
+			Expect(err).To(Succeed())
+			res, err := f.Forward(context.Background(), req)
+			Expect(err).To(Succeed())
+			Expect(res.Truncated).To(BeFalse())
+			Expect(res.Rcode).To(Equal(dns.RcodeSuccess))
+			Expect(res.Id).To(Equal(req.Id))
+		})
+	})
+	When("primary is not reachable", func() {
+		BeforeEach(func() {
+			pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+			Expect(err).To(Succeed())
+			addr := pc.LocalAddr().String()
+			pc.Close()
+			secondaryDDNS.SetForwarder("example.jp.", &ddns.Forwarder{Primary: addr, Client: &dns.Client{Net: "udp", Timeout: 200 * time.Millisecond}})
+		})
+		It("returns SERVFAIL", func() {
+			_, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).Send(context.Background(), secondary)
+			Expect(err).To(Equal(ddns.ErrUpdateServFail))
+		})
+	})
+	When("forwarder is removed", func() {
+		BeforeEach(func() {
+			secondaryDDNS.SetForwarder("example.jp.", &ddns.Forwarder{Primary: primary.Target})
+			secondaryDDNS.SetForwarder("example.jp.", nil)
+		})
+		It("processes update", func() {
+			_, err = ddns.NewUpdateBuilder("example.jp.", dns.ClassINET).AddRR(rr).Send(context.Background(), secondary)
+			Expect(err).To(Succeed())
+			Expect(hasNewRR(secondaryZone)).To(BeTrue())
+			Expect(hasNewRR(primaryZone)).To(BeFalse())
+		})
+	})
+})
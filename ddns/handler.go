@@ -0,0 +1,205 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/tsig"
+)
+
+var _ dns.Handler = &Handler{}
+
+// MsgAcceptFunc is dns.MsgAcceptFunc which accepts UPDATE.
+// dns.DefaultMsgAcceptFunc rejects UPDATE as not implemented.
+func MsgAcceptFunc(dh dns.Header) dns.MsgAcceptAction {
+	if opcode := int(dh.Bits>>11) & 0xF; opcode == dns.OpcodeUpdate {
+		if dh.Bits&(1<<15) != 0 {
+			return dns.MsgIgnore
+		}
+		if dh.Qdcount != 1 {
+			return dns.MsgReject
+		}
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
+}
+
+type handlerZone struct {
+	mu   *sync.Mutex
+	zone dnsutils.ZoneInterface
+	ddns *DDNS
+}
+
+// Handler is dns.Handler for dynamic updates.
+// Updates of the same zone are processed one by one.
+// dns.Server must accept UPDATE by MsgAcceptFunc.
+// When secondary zones forward requests with TSIG of clients, dns.Server should use WireRecorder.DecorateReader.
+type Handler struct {
+	mu     sync.RWMutex
+	zones  map[string]*handlerZone
+	logger *slog.Logger
+}
+
+// NewHandler creates Handler.
+// If logger is nil, it uses slog.Default.
+func NewHandler(logger *slog.Logger) *Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Handler{zones: map[string]*handlerZone{}, logger: logger}
+}
+
+// SetZone sets zone and DDNS which processes updates of the zone.
+// If the zone already exists, it is replaced.
+func (h *Handler) SetZone(z dnsutils.ZoneInterface, d *DDNS) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	name := dns.CanonicalName(z.GetName())
+	mu := &sync.Mutex{}
+	if cur, ok := h.zones[name]; ok {
+		mu = cur.mu
+	}
+	h.zones[name] = &handlerZone{mu: mu, zone: z, ddns: d}
+}
+
+// RemoveZone removes zone.
+func (h *Handler) RemoveZone(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.zones, dns.CanonicalName(name))
+}
+
+// GetZone returns zone by name.
+func (h *Handler) GetZone(name string) (dnsutils.ZoneInterface, bool) {
+	hz, ok := h.getZone(name)
+	if !ok {
+		return nil, false
+	}
+	return hz.zone, true
+}
+
+func (h *Handler) getZone(name string) (*handlerZone, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	hz, ok := h.zones[dns.CanonicalName(name)]
+	return hz, ok
+}
+
+// ReapLeases calls DDNS.ReapLeases of all zones.
+// Reaping is serialized with updates of the same zone.
+// It returns total number of removed RRs.
+func (h *Handler) ReapLeases(now time.Time) (int, error) {
+	h.mu.RLock()
+	zones := make([]*handlerZone, 0, len(h.zones))
+	for _, hz := range h.zones {
+		zones = append(zones, hz)
+	}
+	h.mu.RUnlock()
+	var (
+		total int
+		errs  []error
+	)
+	for _, hz := range zones {
+		hz.mu.Lock()
+		n, err := hz.ddns.ReapLeases(now)
+		hz.mu.Unlock()
+		total += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// RunLeaseReaper calls ReapLeases every interval until ctx is done.
+// Errors of ReapLeases are passed to onError if it is not nil.
+func (h *Handler) RunLeaseReaper(ctx context.Context, interval time.Duration, onError func(error)) {
+	runLeaseReaper(ctx, interval, h.ReapLeases, onError)
+}
+
+// rcodeWriter records rcode of the response.
+type rcodeWriter struct {
+	dns.ResponseWriter
+	rcode int
+}
+
+func (w *rcodeWriter) WriteMsg(m *dns.Msg) error {
+	w.rcode = m.Rcode
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+func (w *rcodeWriter) Write(b []byte) (int, error) {
+	m := &dns.Msg{}
+	if err := m.Unpack(b); err == nil {
+		w.rcode = m.Rcode
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ServeDNS is implement of dns.Handler.
+//   - not UPDATE opcode: NOTIMP
+//   - zone section is not valid: FORMERR
+//   - zone is unknown: NOTAUTH
+//
+// Otherwise the request is processed by DDNS.ServeUpdateMsg.
+func (h *Handler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	res := &dns.Msg{}
+	if r.Opcode != dns.OpcodeUpdate {
+		h.writeError(w, r, res.SetRcode(r, dns.RcodeNotImplemented))
+		return
+	}
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		h.writeError(w, r, res.SetRcodeFormatError(r))
+		return
+	}
+	hz, ok := h.getZone(r.Question[0].Name)
+	if !ok || hz.zone.GetClass() != dns.Class(r.Question[0].Qclass) {
+		h.writeError(w, r, res.SetRcode(r, dns.RcodeNotAuth))
+		return
+	}
+	rw := &rcodeWriter{ResponseWriter: w, rcode: -1}
+	hz.mu.Lock()
+	err := hz.ddns.ServeUpdateMsg(hz.zone, rw, r)
+	hz.mu.Unlock()
+	h.log(w, r, hz.ddns.keyRing, rw.rcode, err)
+}
+
+func (h *Handler) writeError(w dns.ResponseWriter, r, res *dns.Msg) {
+	h.log(w, r, nil, res.Rcode, w.WriteMsg(res))
+}
+
+// log logs the result of request.
+// TSIG key name is logged as key only when it is verified by kr, otherwise it is logged as unverified_key.
+func (h *Handler) log(w dns.ResponseWriter, r *dns.Msg, kr *tsig.KeyRing, rcode int, err error) {
+	attrs := []any{"remote", w.RemoteAddr().String()}
+	if len(r.Question) > 0 {
+		attrs = append(attrs, "zone", r.Question[0].Name)
+	}
+	if t := r.IsTsig(); t != nil {
+		if name, ok := verifiedKeyName(kr, w, r); ok {
+			attrs = append(attrs, "key", name)
+		} else {
+			attrs = append(attrs, "unverified_key", t.Hdr.Name)
+		}
+	}
+	if rcode >= 0 {
+		attrs = append(attrs, "rcode", dns.RcodeToString[rcode])
+	}
+	if err != nil {
+		h.logger.Error("dynamic update failed", append(attrs, "error", err)...)
+		return
+	}
+	h.logger.Info("dynamic update", attrs...)
+}
+
+func verifiedKeyName(kr *tsig.KeyRing, w dns.ResponseWriter, r *dns.Msg) (string, bool) {
+	if kr == nil {
+		return "", false
+	}
+	return kr.KeyName(w, r)
+}
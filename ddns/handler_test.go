@@ -0,0 +1,180 @@
+package ddns_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/ddns"
+	. "github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/tsig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		zone   *dnsutils.Zone
+		d      *ddns.DDNS
+		h      *ddns.Handler
+		logBuf *bytes.Buffer
+		msg    *dns.Msg
+		w      *ResponseWriter
+	)
+	BeforeEach(func() {
+		var err error
+		zone, err = dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+		Expect(err).To(Succeed())
+		Expect(zone.Read(bytes.NewBuffer(zonefile))).To(Succeed())
+		d = ddns.NewDDNS(ddns.NewZoneUpdate(zone, nil))
+		logBuf = &bytes.Buffer{}
+		h = ddns.NewHandler(slog.New(slog.NewTextHandler(logBuf, nil)))
+		h.SetZone(zone, d)
+		msg = &dns.Msg{}
+		msg.SetUpdate("example.jp.")
+		w = &ResponseWriter{}
+	})
+	Context("zone", func() {
+		It("can be got and removed", func() {
+			z, ok := h.GetZone("Example.jp")
+			Expect(ok).To(BeTrue())
+			Expect(z).To(Equal(zone))
+			h.RemoveZone("example.jp.")
+			_, ok = h.GetZone("example.jp.")
+			Expect(ok).To(BeFalse())
+		})
+	})
+	Context("ServeDNS", func() {
+		It("returns NOTIMP for non UPDATE opcode", func() {
+			msg.Opcode = dns.OpcodeQuery
+			h.ServeDNS(w, msg)
+			Expect(w.Msg.Rcode).To(Equal(dns.RcodeNotImplemented))
+		})
+		It("returns FORMERR for invalid zone section", func() {
+			msg.Question[0].Qtype = dns.TypeA
+			h.ServeDNS(w, msg)
+			Expect(w.Msg.Rcode).To(Equal(dns.RcodeFormatError))
+		})
+		It("returns NOTAUTH for unknown zone", func() {
+			msg.SetUpdate("example.com.")
+			h.ServeDNS(w, msg)
+			Expect(w.Msg.Rcode).To(Equal(dns.RcodeNotAuth))
+			Expect(logBuf.String()).To(ContainSubstring("rcode=NOTAUTH"))
+		})
+		It("processes update and logs the outcome", func() {
+			msg.Insert([]dns.RR{MustNewRR("new.example.jp. 300 IN A 192.168.0.1")})
+			h.ServeDNS(w, msg)
+			Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+			_, ok := zone.GetRootNode().GetNameNode("new.example.jp.")
+			Expect(ok).To(BeTrue())
+			Expect(logBuf.String()).To(ContainSubstring("msg=\"dynamic update\""))
+			Expect(logBuf.String()).To(ContainSubstring("zone=example.jp."))
+			Expect(logBuf.String()).To(ContainSubstring("remote=10.0.0.1:38000"))
+			Expect(logBuf.String()).To(ContainSubstring("rcode=NOERROR"))
+		})
+		It("returns rcode of failed update", func() {
+			msg.NameUsed([]dns.RR{MustNewRR("new.example.jp. 0 IN A 0.0.0.0")})
+			h.ServeDNS(w, msg)
+			Expect(w.Msg.Rcode).To(Equal(dns.RcodeNameError))
+			Expect(logBuf.String()).To(ContainSubstring("rcode=NXDOMAIN"))
+		})
+		It("logs write error", func() {
+			w.ErrWriteMsg = fmt.Errorf("write error")
+			h.ServeDNS(w, msg)
+			Expect(logBuf.String()).To(ContainSubstring("msg=\"dynamic update failed\""))
+			Expect(logBuf.String()).To(ContainSubstring("error=\"write error\""))
+		})
+		It("signs the response", func() {
+			kr, err := tsig.NewKeyRing(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})
+			Expect(err).To(Succeed())
+			d.SetKeyRing(kr)
+			msg.Insert([]dns.RR{MustNewRR("new.example.jp. 300 IN A 192.168.0.1")})
+			msg.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+			h.ServeDNS(w, MustSignMsg(msg, kr))
+			Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+			Expect(w.Msg.IsTsig()).NotTo(BeNil())
+			Expect(logBuf.String()).To(ContainSubstring("key=key.example.jp."))
+		})
+		It("logs unverified key name", func() {
+			kr, err := tsig.NewKeyRing(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})
+			Expect(err).To(Succeed())
+			d.SetKeyRing(kr)
+			msg.Insert([]dns.RR{MustNewRR("new.example.jp. 300 IN A 192.168.0.1")})
+			msg.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+			h.ServeDNS(w, msg)
+			Expect(w.Msg.Rcode).To(Equal(dns.RcodeNotAuth))
+			Expect(logBuf.String()).To(ContainSubstring("unverified_key=key.example.jp."))
+			Expect(logBuf.String()).NotTo(ContainSubstring(" key=key.example.jp."))
+		})
+		It("serializes updates of the same zone", func() {
+			n := 20
+			wg := sync.WaitGroup{}
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					defer GinkgoRecover()
+					m := &dns.Msg{}
+					m.SetUpdate("example.jp.")
+					m.Insert([]dns.RR{MustNewRR(fmt.Sprintf("host%d.example.jp. 300 IN A 192.168.0.%d", i, i))})
+					rw := &ResponseWriter{}
+					h.ServeDNS(rw, m)
+					Expect(rw.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+				}(i)
+			}
+			wg.Wait()
+			for i := 0; i < n; i++ {
+				_, ok := zone.GetRootNode().GetNameNode(fmt.Sprintf("host%d.example.jp.", i))
+				Expect(ok).To(BeTrue())
+			}
+			soa, err := dnsutils.GetSOA(zone)
+			Expect(err).To(Succeed())
+			Expect(soa.Serial).To(Equal(uint32(1 + n)))
+		})
+	})
+	Context("ReapLeases", func() {
+		It("removes expired RRs while updates are served", func() {
+			min := uint32(0)
+			leases := ddns.NewLeases(&ddns.LeaseOption{MinLease: &min})
+			d.SetLeases(leases)
+			msg.Insert([]dns.RR{MustNewRR("new.example.jp. 300 IN A 192.168.0.1")})
+			msg.SetEdns0(dns.DefaultMsgSize, false)
+			msg.IsEdns0().Option = append(msg.IsEdns0().Option, &dns.EDNS0_UL{Code: dns.EDNS0UL, Lease: 60})
+			h.ServeDNS(w, msg)
+			Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+			Expect(leases.Len()).To(Equal(1))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go h.RunLeaseReaper(ctx, 10*time.Millisecond, nil)
+			for i := 0; i < 10; i++ {
+				m := &dns.Msg{}
+				m.SetUpdate("example.jp.")
+				m.Insert([]dns.RR{MustNewRR(fmt.Sprintf("host%d.example.jp. 300 IN A 192.168.0.%d", i, i))})
+				h.ServeDNS(&ResponseWriter{}, m)
+			}
+			n, err := h.ReapLeases(time.Now().Add(time.Hour))
+			Expect(err).To(Succeed())
+			Expect(n).To(Equal(1))
+			Expect(leases.Len()).To(Equal(0))
+			nn, ok := zone.GetRootNode().GetNameNode("new.example.jp.")
+			Expect(ok && nn.GetRRSet(dns.TypeA) != nil && nn.GetRRSet(dns.TypeA).Len() > 0).To(BeFalse())
+			_, ok = zone.GetRootNode().GetNameNode("host9.example.jp.")
+			Expect(ok).To(BeTrue())
+		})
+	})
+	Context("MsgAcceptFunc", func() {
+		It("accepts UPDATE", func() {
+			Expect(ddns.MsgAcceptFunc(dns.Header{Bits: dns.OpcodeUpdate << 11, Qdcount: 1, Ancount: 2, Nscount: 3, Arcount: 2})).To(Equal(dns.MsgAccept))
+			Expect(ddns.MsgAcceptFunc(dns.Header{Bits: dns.OpcodeUpdate<<11 | 1<<15, Qdcount: 1})).To(Equal(dns.MsgIgnore))
+			Expect(ddns.MsgAcceptFunc(dns.Header{Bits: dns.OpcodeUpdate << 11, Qdcount: 2})).To(Equal(dns.MsgReject))
+			Expect(ddns.MsgAcceptFunc(dns.Header{Bits: dns.OpcodeQuery << 11, Qdcount: 1})).To(Equal(dns.MsgAccept))
+			Expect(ddns.MsgAcceptFunc(dns.Header{Bits: dns.OpcodeIQuery << 11, Qdcount: 1})).To(Equal(dns.MsgRejectNotImplemented))
+		})
+	})
+})
@@ -0,0 +1,265 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+)
+
+var (
+	// DefaultMinLease is default minimum granted lease in seconds.
+	DefaultMinLease uint32 = 1800
+	// DefaultMaxLease is default maximum granted lease in seconds.
+	DefaultMaxLease uint32 = 7 * 24 * 3600
+)
+
+// GetUpdateLease returns Update Lease option of message. RFC 9664.
+// If KEY-LEASE is omitted, keyLease is equal to lease.
+func GetUpdateLease(msg *dns.Msg) (lease uint32, keyLease uint32, ok bool) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return 0, 0, false
+	}
+	for _, o := range opt.Option {
+		if ul, isUL := o.(*dns.EDNS0_UL); isUL {
+			keyLease = ul.KeyLease
+			if keyLease == 0 {
+				keyLease = ul.Lease
+			}
+			return ul.Lease, keyLease, true
+		}
+	}
+	return 0, 0, false
+}
+
+// LeaseOption is option of Leases.
+type LeaseOption struct {
+	// MinLease is minimum granted lease in seconds. default DefaultMinLease
+	MinLease *uint32
+	// MaxLease is maximum granted lease in seconds. default DefaultMaxLease
+	MaxLease *uint32
+}
+
+func (o *LeaseOption) GetMinLease() uint32 {
+	if o == nil || o.MinLease == nil {
+		return DefaultMinLease
+	}
+	return *o.MinLease
+}
+
+func (o *LeaseOption) GetMaxLease() uint32 {
+	if o == nil || o.MaxLease == nil {
+		return DefaultMaxLease
+	}
+	return *o.MaxLease
+}
+
+// LeaseEntry is lease of RR.
+type LeaseEntry struct {
+	RR     dns.RR
+	Expire time.Time
+}
+
+// Leases stores leases of RRs which are added by update with Update Lease option.
+type Leases struct {
+	mu      sync.Mutex
+	opt     *LeaseOption
+	entries map[string]*LeaseEntry
+}
+
+// NewLeases creates Leases.
+func NewLeases(opt *LeaseOption) *Leases {
+	return &Leases{opt: opt, entries: map[string]*LeaseEntry{}}
+}
+
+// Grant returns granted lease and key lease.
+func (l *Leases) Grant(lease, keyLease uint32) (uint32, uint32) {
+	clamp := func(v uint32) uint32 {
+		if v < l.opt.GetMinLease() {
+			return l.opt.GetMinLease()
+		}
+		if v > l.opt.GetMaxLease() {
+			return l.opt.GetMaxLease()
+		}
+		return v
+	}
+	return clamp(lease), clamp(keyLease)
+}
+
+func leaseKey(rr dns.RR) string {
+	return strings.Join([]string{dns.CanonicalName(rr.Header().Name), dns.TypeToString[rr.Header().Rrtype], dnsutils.GetRDATA(rr)}, " ")
+}
+
+func leasePrefix(name string, rrtype uint16) string {
+	prefix := dns.CanonicalName(name) + " "
+	if rrtype != dns.TypeANY {
+		prefix += dns.TypeToString[rrtype] + " "
+	}
+	return prefix
+}
+
+// Get returns lease of rr.
+func (l *Leases) Get(rr dns.RR) (*LeaseEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[leaseKey(rr)]
+	if !ok {
+		return nil, false
+	}
+	c := *e
+	return &c, true
+}
+
+// Len returns number of leases.
+func (l *Leases) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// Expired returns RRs whose lease is expired at now.
+func (l *Leases) Expired(now time.Time) []dns.RR {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var rrs []dns.RR
+	for _, e := range l.entries {
+		if !now.Before(e.Expire) {
+			rrs = append(rrs, e.RR)
+		}
+	}
+	return rrs
+}
+
+// Remove removes lease of rr.
+func (l *Leases) Remove(rr dns.RR) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, leaseKey(rr))
+}
+
+func (l *Leases) removePrefix(prefix string, keep func(rrtype uint16) bool) {
+	for key, e := range l.entries {
+		if strings.HasPrefix(key, prefix) && !keep(e.RR.Header().Rrtype) {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// apply updates leases by operations of successful update.
+// If ok is false, added RRs have no lease.
+func (l *Leases) apply(ops []*PlanOperation, lease, keyLease uint32, ok bool, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lease, keyLease = l.Grant(lease, keyLease)
+	for _, op := range ops {
+		rr := op.RR
+		switch op.Action {
+		case PlanActionReplace:
+			l.removePrefix(leasePrefix(rr.Header().Name, rr.Header().Rrtype), func(uint16) bool { return false })
+			fallthrough
+		case PlanActionAdd:
+			if !ok {
+				delete(l.entries, leaseKey(rr))
+				continue
+			}
+			d := lease
+			if rr.Header().Rrtype == dns.TypeKEY {
+				d = keyLease
+			}
+			l.entries[leaseKey(rr)] = &LeaseEntry{RR: dns.Copy(rr), Expire: now.Add(time.Duration(d) * time.Second)}
+		case PlanActionRemoveNameApex:
+			l.removePrefix(leasePrefix(rr.Header().Name, dns.TypeANY), func(t uint16) bool {
+				return t == dns.TypeSOA || t == dns.TypeNS
+			})
+		case PlanActionRemoveName:
+			l.removePrefix(leasePrefix(rr.Header().Name, dns.TypeANY), func(uint16) bool { return false })
+		case PlanActionRemoveRRSet:
+			l.removePrefix(leasePrefix(rr.Header().Name, rr.Header().Rrtype), func(uint16) bool { return false })
+		case PlanActionRemoveRR:
+			delete(l.entries, leaseKey(rr))
+		}
+	}
+}
+
+// SetLeases enables Update Lease. RFC 9664.
+// Leases of added RRs are stored in l, and expired RRs are removed by ReapLeases.
+func (d *DDNS) SetLeases(l *Leases) {
+	d.leases = l
+}
+
+// setLeaseOption adds granted Update Lease option to response.
+func (d *DDNS) setLeaseOption(res, r *dns.Msg) {
+	if d.leases == nil || res.Rcode != dns.RcodeSuccess {
+		return
+	}
+	lease, keyLease, ok := GetUpdateLease(r)
+	if !ok {
+		return
+	}
+	lease, keyLease = d.leases.Grant(lease, keyLease)
+	ul := &dns.EDNS0_UL{Code: dns.EDNS0UL, Lease: lease}
+	if reqOpt := r.IsEdns0(); reqOpt != nil {
+		for _, o := range reqOpt.Option {
+			if reqUL, isUL := o.(*dns.EDNS0_UL); isUL && reqUL.KeyLease != 0 {
+				ul.KeyLease = keyLease
+			}
+		}
+	}
+	opt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT, Class: dns.DefaultMsgSize}}
+	opt.Option = append(opt.Option, ul)
+	res.Extra = append(res.Extra, opt)
+}
+
+// ReapLeases removes RRs whose lease is expired at now through UpdateInterface.
+// It returns number of removed RRs.
+// Like ServeUpdate, it must not run concurrently with updates of the same zone.
+// When updates are served by Handler, use Handler.ReapLeases instead.
+func (d *DDNS) ReapLeases(now time.Time) (int, error) {
+	if d.leases == nil {
+		return 0, nil
+	}
+	rrs := d.leases.Expired(now)
+	if len(rrs) == 0 {
+		return 0, nil
+	}
+	for _, rr := range rrs {
+		if err := d.ui.RemoveRR(rr); err != nil {
+			err = fmt.Errorf("failed to remove expired rr: %w", err)
+			d.ui.UpdateFailedPostProcess(err)
+			return 0, err
+		}
+	}
+	if err := d.ui.UpdatePostProcess(); err != nil {
+		return 0, fmt.Errorf("failed to apply expired rr: %w", err)
+	}
+	for _, rr := range rrs {
+		d.leases.Remove(rr)
+	}
+	return len(rrs), nil
+}
+
+// RunLeaseReaper calls ReapLeases every interval until ctx is done.
+// Errors of ReapLeases are passed to onError if it is not nil.
+func (d *DDNS) RunLeaseReaper(ctx context.Context, interval time.Duration, onError func(error)) {
+	runLeaseReaper(ctx, interval, d.ReapLeases, onError)
+}
+
+func runLeaseReaper(ctx context.Context, interval time.Duration, reap func(time.Time) (int, error), onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := reap(now); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
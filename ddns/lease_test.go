@@ -0,0 +1,190 @@
+package ddns_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/ddns"
+	. "github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Update Lease", func() {
+	setLease := func(msg *dns.Msg, lease, keyLease uint32) {
+		msg.SetEdns0(dns.DefaultMsgSize, false)
+		opt := msg.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_UL{Code: dns.EDNS0UL, Lease: lease, KeyLease: keyLease})
+	}
+	Context("GetUpdateLease", func() {
+		It("returns lease and key lease", func() {
+			msg := &dns.Msg{}
+			_, _, ok := ddns.GetUpdateLease(msg)
+			Expect(ok).To(BeFalse())
+			setLease(msg, 3600, 0)
+			lease, keyLease, ok := ddns.GetUpdateLease(msg)
+			Expect(ok).To(BeTrue())
+			Expect(lease).To(Equal(uint32(3600)))
+			Expect(keyLease).To(Equal(uint32(3600)))
+			msg = &dns.Msg{}
+			setLease(msg, 3600, 7200)
+			lease, keyLease, ok = ddns.GetUpdateLease(msg)
+			Expect(ok).To(BeTrue())
+			Expect(lease).To(Equal(uint32(3600)))
+			Expect(keyLease).To(Equal(uint32(7200)))
+		})
+	})
+	Context("Grant", func() {
+		It("clamps lease", func() {
+			l := ddns.NewLeases(nil)
+			lease, keyLease := l.Grant(60, 3600)
+			Expect(lease).To(Equal(ddns.DefaultMinLease))
+			Expect(keyLease).To(Equal(uint32(3600)))
+			lease, _ = l.Grant(ddns.DefaultMaxLease+1, 0)
+			Expect(lease).To(Equal(ddns.DefaultMaxLease))
+			min, max := uint32(10), uint32(100)
+			l = ddns.NewLeases(&ddns.LeaseOption{MinLease: &min, MaxLease: &max})
+			lease, keyLease = l.Grant(1, 1000)
+			Expect(lease).To(Equal(uint32(10)))
+			Expect(keyLease).To(Equal(uint32(100)))
+		})
+	})
+	Context("DDNS", func() {
+		var (
+			zone   *dnsutils.Zone
+			d      *ddns.DDNS
+			leases *ddns.Leases
+			msg    *dns.Msg
+			w      *ResponseWriter
+			rr     = MustNewRR("printer.example.jp. 300 IN A 192.168.10.1")
+			keyRR  = MustNewRR("printer.example.jp. 300 IN KEY 512 3 8 AwEAAcMnWBKLuvG/LwnPVykcmpvnntwxfshHlHRhlY0F3oz8AkzMzW2lrW7ksMWUcsETYSSuIXf8KcePaQIWkwLS/fvvuRWN7iGIhH7Sgnu+7ih0UXkRRmGSHnapTkMHbS6n2g6h1Q2VwGXI9Fhy2G4jb6tYqFsU0sBh7SG0Tn9rvJQx")
+		)
+		has := func(rr dns.RR) bool {
+			nn, ok := zone.GetRootNode().GetNameNode(rr.Header().Name)
+			if !ok || nn.GetRRSet(rr.Header().Rrtype) == nil {
+				return false
+			}
+			return nn.GetRRSet(rr.Header().Rrtype).Len() > 0
+		}
+		BeforeEach(func() {
+			var err error
+			zone, err = dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+			Expect(err).To(Succeed())
+			Expect(zone.Read(bytes.NewBuffer(zonefile))).To(Succeed())
+			d = ddns.NewDDNS(ddns.NewZoneUpdate(zone, nil))
+			leases = ddns.NewLeases(nil)
+			d.SetLeases(leases)
+			msg = &dns.Msg{}
+			msg.SetUpdate("example.jp.")
+			w = &ResponseWriter{}
+		})
+		When("update has Update Lease option", func() {
+			BeforeEach(func() {
+				msg.Insert([]dns.RR{rr, keyRR})
+				setLease(msg, 3600, 7200)
+				Expect(d.ServeUpdateMsg(zone, w, msg)).To(Succeed())
+			})
+			It("echoes granted lease", func() {
+				Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+				opt := w.Msg.IsEdns0()
+				Expect(opt).NotTo(BeNil())
+				Expect(opt.Option).To(Equal([]dns.EDNS0{&dns.EDNS0_UL{Code: dns.EDNS0UL, Lease: 3600, KeyLease: 7200}}))
+			})
+			It("stores leases", func() {
+				Expect(leases.Len()).To(Equal(2))
+				e, ok := leases.Get(rr)
+				Expect(ok).To(BeTrue())
+				Expect(e.Expire).To(BeTemporally("~", time.Now().Add(time.Hour), 5*time.Second))
+				e, ok = leases.Get(keyRR)
+				Expect(ok).To(BeTrue())
+				Expect(e.Expire).To(BeTemporally("~", time.Now().Add(2*time.Hour), 5*time.Second))
+			})
+			It("removes expired RRs by ReapLeases", func() {
+				n, err := d.ReapLeases(time.Now())
+				Expect(err).To(Succeed())
+				Expect(n).To(Equal(0))
+				Expect(has(rr)).To(BeTrue())
+
+				n, err = d.ReapLeases(time.Now().Add(time.Hour + time.Minute))
+				Expect(err).To(Succeed())
+				Expect(n).To(Equal(1))
+				Expect(has(rr)).To(BeFalse())
+				Expect(has(keyRR)).To(BeTrue())
+
+				n, err = d.ReapLeases(time.Now().Add(2*time.Hour + time.Minute))
+				Expect(err).To(Succeed())
+				Expect(n).To(Equal(1))
+				Expect(has(keyRR)).To(BeFalse())
+				Expect(leases.Len()).To(Equal(0))
+			})
+			It("removes lease when RR is deleted", func() {
+				msg = &dns.Msg{}
+				msg.SetUpdate("example.jp.")
+				msg.RemoveName([]dns.RR{MustNewRR("printer.example.jp. 0 IN A 0.0.0.0")})
+				rc, err := d.ServeUpdate(zone, msg)
+				Expect(err).To(Succeed())
+				Expect(rc).To(Equal(dns.RcodeSuccess))
+				Expect(leases.Len()).To(Equal(0))
+			})
+			It("removes lease when RR is added without lease", func() {
+				msg = &dns.Msg{}
+				msg.SetUpdate("example.jp.")
+				msg.Insert([]dns.RR{MustNewRR("printer.example.jp. 300 IN A 192.168.10.1")})
+				rc, err := d.ServeUpdate(zone, msg)
+				Expect(err).To(Succeed())
+				Expect(rc).To(Equal(dns.RcodeSuccess))
+				_, ok := leases.Get(rr)
+				Expect(ok).To(BeFalse())
+				_, ok = leases.Get(keyRR)
+				Expect(ok).To(BeTrue())
+			})
+		})
+		When("update has no Update Lease option", func() {
+			BeforeEach(func() {
+				msg.Insert([]dns.RR{rr})
+				Expect(d.ServeUpdateMsg(zone, w, msg)).To(Succeed())
+			})
+			It("does not store lease", func() {
+				Expect(w.Msg.IsEdns0()).To(BeNil())
+				Expect(leases.Len()).To(Equal(0))
+			})
+		})
+		When("reaper is running", func() {
+			BeforeEach(func() {
+				min := uint32(0)
+				leases = ddns.NewLeases(&ddns.LeaseOption{MinLease: &min})
+				d.SetLeases(leases)
+				msg.Insert([]dns.RR{rr})
+				setLease(msg, 0, 0)
+				Expect(d.ServeUpdateMsg(zone, w, msg)).To(Succeed())
+			})
+			It("removes expired RRs", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				go d.RunLeaseReaper(ctx, 10*time.Millisecond, nil)
+				Eventually(func() int { return leases.Len() }).Should(Equal(0))
+				Expect(has(rr)).To(BeFalse())
+			})
+		})
+		When("UpdateInterface fails", func() {
+			It("returns error", func() {
+				ui := NewTestUpdate()
+				d = ddns.NewDDNS(ui)
+				d.SetLeases(leases)
+				msg.Insert([]dns.RR{rr})
+				setLease(msg, 3600, 0)
+				rc, err := d.ServeUpdate(zone, msg)
+				Expect(err).To(Succeed())
+				Expect(rc).To(Equal(dns.RcodeSuccess))
+				ui.updateErr = fmt.Errorf("error")
+				_, err = d.ReapLeases(time.Now().Add(2 * time.Hour))
+				Expect(err).To(HaveOccurred())
+				Expect(leases.Len()).To(Equal(1))
+			})
+		})
+	})
+})
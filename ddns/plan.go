@@ -0,0 +1,79 @@
+package ddns
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+)
+
+// PlanAction is kind of planned operation.
+type PlanAction string
+
+const (
+	// PlanActionAdd adds RR by UpdateInterface.AddRR.
+	PlanActionAdd PlanAction = "ADD"
+	// PlanActionReplace replaces CNAME or SOA rrset by UpdateInterface.ReplaceRRSet.
+	PlanActionReplace PlanAction = "REPLACE"
+	// PlanActionRemoveNameApex removes zone apex rrsets other than SOA and NS by UpdateInterface.RemoveNameApex.
+	PlanActionRemoveNameApex PlanAction = "REMOVE_NAME_APEX"
+	// PlanActionRemoveName removes all rrsets of name by UpdateInterface.RemoveName.
+	PlanActionRemoveName PlanAction = "REMOVE_NAME"
+	// PlanActionRemoveRRSet removes rrset by UpdateInterface.RemoveRRSet.
+	PlanActionRemoveRRSet PlanAction = "REMOVE_RRSET"
+	// PlanActionRemoveRR removes RR by UpdateInterface.RemoveRR.
+	PlanActionRemoveRR PlanAction = "REMOVE_RR"
+	// PlanActionSkip is RR which is ignored silently. RFC 2136 section 3.4.2.
+	PlanActionSkip PlanAction = "SKIP"
+)
+
+// PlanOperation is operation of update RR.
+type PlanOperation struct {
+	Action PlanAction
+	// RR is RR of update section.
+	RR dns.RR
+	// Reason is reason of skip.
+	Reason string
+}
+
+func skipOperation(rr dns.RR, reason string) *PlanOperation {
+	return &PlanOperation{Action: PlanActionSkip, RR: rr, Reason: reason}
+}
+
+func (o *PlanOperation) String() string {
+	if o.Action == PlanActionSkip {
+		return fmt.Sprintf("%s %s (%s)", o.Action, o.RR.String(), o.Reason)
+	}
+	return fmt.Sprintf("%s %s", o.Action, o.RR.String())
+}
+
+// Plan returns rcode and operations of update message without changing zone.
+func (d *DDNS) Plan(zone dnsutils.ZoneInterface, r *dns.Msg) (int, []*PlanOperation) {
+	return d.PlanWithIdentity(zone, r, nil)
+}
+
+// PlanWithIdentity is Plan by identity.
+// It runs zone section, prescan, prerequisite and update section processing
+// without calling mutators of UpdateInterface.
+// Update RRs are planned by the same way as ServeUpdate.
+// If rcode is not NOERROR, operations are nil.
+func (d *DDNS) PlanWithIdentity(zone dnsutils.ZoneInterface, r *dns.Msg, id *Identity) (int, []*PlanOperation) {
+	if zone == nil {
+		return dns.RcodeRefused, nil
+	}
+	if rcode := d.CheckZoneSection(zone, r); rcode != dns.RcodeSuccess {
+		return rcode, nil
+	}
+	if rcode := d.UpdatePrescanWithIdentity(zone, r, id); rcode != dns.RcodeSuccess {
+		return rcode, nil
+	}
+	if rcode := d.PrerequisiteProessing(zone, r); rcode != dns.RcodeSuccess {
+		return rcode, nil
+	}
+	// operations are planned in order against the zone which previous operations are applied to.
+	ops, err := d.processUpdates(zone, r, nil)
+	if err != nil {
+		return dns.RcodeServerFailure, nil
+	}
+	return dns.RcodeSuccess, ops
+}
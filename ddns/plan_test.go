@@ -0,0 +1,202 @@
+package ddns_test
+
+import (
+	"bytes"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/ddns"
+	. "github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plan", func() {
+	var (
+		d    *ddns.DDNS
+		ui   *TestUpdate
+		zone *dnsutils.Zone
+		msg  *dns.Msg
+		rc   int
+		ops  []*ddns.PlanOperation
+	)
+	BeforeEach(func() {
+		var err error
+		ui = NewTestUpdate()
+		d = ddns.NewDDNS(ui)
+		zone, err = dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+		Expect(err).To(Succeed())
+		Expect(zone.Read(bytes.NewBuffer(zonefile))).To(Succeed())
+		msg = &dns.Msg{}
+		msg.SetUpdate("example.jp.")
+	})
+	AfterEach(func() {
+		Expect(ui.addRRs).To(BeEmpty())
+		Expect(ui.replaceRRSet).To(BeEmpty())
+		Expect(ui.removeZoneApex).To(BeFalse())
+		Expect(ui.removeName).To(BeEmpty())
+		Expect(ui.removeRRSet).To(BeEmpty())
+		Expect(ui.removeRR).To(BeEmpty())
+	})
+	When("prerequisite fails", func() {
+		BeforeEach(func() {
+			msg.NameNotUsed([]dns.RR{MustNewRR("www.example.jp. 0 IN A 0.0.0.0")})
+			msg.Insert([]dns.RR{MustNewRR("www2.example.jp. 300 IN A 192.168.0.1")})
+			rc, ops = d.Plan(zone, msg)
+		})
+		It("returns rcode without operations", func() {
+			Expect(rc).To(Equal(dns.RcodeYXDomain))
+			Expect(ops).To(BeNil())
+		})
+	})
+	When("update is refused by policy", func() {
+		BeforeEach(func() {
+			p, err := ddns.NewUpdatePolicy(&ddns.PolicyRule{Action: ddns.PolicyActionGrant, Key: "*", MatchType: ddns.PolicyMatchSubdomain, Name: "example.jp."})
+			Expect(err).To(Succeed())
+			d.SetUpdatePolicy(p)
+			msg.Insert([]dns.RR{MustNewRR("www2.example.jp. 300 IN A 192.168.0.1")})
+		})
+		It("returns REFUSED", func() {
+			rc, ops = d.Plan(zone, msg)
+			Expect(rc).To(Equal(dns.RcodeRefused))
+			rc, ops = d.PlanWithIdentity(zone, msg, &ddns.Identity{KeyName: "key.example.jp."})
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			Expect(ops).To(HaveLen(1))
+		})
+	})
+	When("update is valid", func() {
+		BeforeEach(func() {
+			msg.Insert([]dns.RR{
+				MustNewRR("new.example.jp. 300 IN A 192.168.0.1"),
+				MustNewRR("www.example.jp. 300 IN CNAME www2.example.net."),
+				MustNewRR("www.example.jp. 300 IN A 192.168.0.1"),
+				MustNewRR("mail.example.jp. 300 IN CNAME www.example.net."),
+				MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 0 3600 900 85400 300"),
+				MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 2 3600 900 85400 300"),
+			})
+			msg.RemoveRRset([]dns.RR{
+				MustNewRR("example.jp. 0 IN NS ns1.example.jp."),
+				MustNewRR("sub.example.jp. 0 IN NS ns1.example.jp."),
+			})
+			msg.RemoveName([]dns.RR{
+				MustNewRR("example.jp. 0 IN A 0.0.0.0"),
+				MustNewRR("help.example.jp. 0 IN A 0.0.0.0"),
+			})
+			msg.Remove([]dns.RR{
+				MustNewRR("mail.example.jp. 0 IN A 192.168.1.1"),
+				MustNewRR("example.jp. 0 IN NS ns1.example.jp."),
+				MustNewRR("example.jp. 0 IN SOA localhost. root.localhost. 1 3600 900 85400 300"),
+			})
+			rc, ops = d.Plan(zone, msg)
+		})
+		It("returns ordered operations including skipped RRs", func() {
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			var actions []ddns.PlanAction
+			for i, op := range ops {
+				Expect(op.RR).To(Equal(msg.Ns[i]))
+				actions = append(actions, op.Action)
+			}
+			Expect(actions).To(Equal([]ddns.PlanAction{
+				ddns.PlanActionAdd,
+				ddns.PlanActionReplace,
+				ddns.PlanActionSkip,
+				ddns.PlanActionSkip,
+				ddns.PlanActionSkip,
+				ddns.PlanActionReplace,
+				ddns.PlanActionSkip,
+				ddns.PlanActionRemoveRRSet,
+				ddns.PlanActionRemoveNameApex,
+				ddns.PlanActionRemoveName,
+				ddns.PlanActionRemoveRR,
+				ddns.PlanActionSkip,
+				ddns.PlanActionSkip,
+			}))
+			Expect(ops[2].Reason).To(Equal("name has CNAME"))
+			Expect(ops[4].Reason).To(Equal("SOA serial is older than zone"))
+			Expect(ops[6].Reason).To(Equal("zone apex SOA and NS can't be removed"))
+			Expect(ops[0].String()).To(Equal("ADD " + msg.Ns[0].String()))
+			Expect(ops[6].String()).To(HaveSuffix("(zone apex SOA and NS can't be removed)"))
+		})
+	})
+	When("name is deleted and added in one message", func() {
+		BeforeEach(func() {
+			msg.RemoveName([]dns.RR{MustNewRR("mail.example.jp. 0 IN A 0.0.0.0")})
+			msg.Insert([]dns.RR{
+				MustNewRR("mail.example.jp. 300 IN CNAME www.example.net."),
+				MustNewRR("mail.example.jp. 300 IN A 192.168.1.1"),
+			})
+			rc, ops = d.Plan(zone, msg)
+		})
+		It("plans each RR against the zone changed by previous RRs", func() {
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			Expect(ops).To(HaveLen(3))
+			Expect(ops[0].Action).To(Equal(ddns.PlanActionRemoveName))
+			Expect(ops[1].Action).To(Equal(ddns.PlanActionAdd))
+			Expect(ops[2].Action).To(Equal(ddns.PlanActionSkip))
+			Expect(ops[2].Reason).To(Equal("name has CNAME"))
+			nn, ok := zone.GetRootNode().GetNameNode("mail.example.jp.")
+			Expect(ok).To(BeTrue())
+			Expect(nn.GetRRSet(dns.TypeA).Len()).To(Equal(3))
+		})
+	})
+	When("NS rrset is deleted", func() {
+		BeforeEach(func() {
+			msg.RemoveRRset([]dns.RR{
+				MustNewRR("example.jp. 0 IN NS ns1.example.jp."),
+				MustNewRR("ns1.example.jp. 0 IN NS ns1.example.jp."),
+			})
+			rc, ops = d.Plan(zone, msg)
+		})
+		It("skips only zone apex NS", func() {
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			Expect(ops).To(HaveLen(2))
+			Expect(ops[0].Action).To(Equal(ddns.PlanActionSkip))
+			Expect(ops[1].Action).To(Equal(ddns.PlanActionRemoveRRSet))
+		})
+	})
+	When("zone is large", func() {
+		var root *noCopyNameNode
+		BeforeEach(func() {
+			root = &noCopyNameNode{NameNodeInterface: zone.GetRootNode()}
+			msg.RemoveName([]dns.RR{MustNewRR("mail.example.jp. 0 IN A 0.0.0.0")})
+			msg.Insert([]dns.RR{MustNewRR("mail.example.jp. 300 IN CNAME www.example.net.")})
+			rc, ops = d.Plan(&rootZone{ZoneInterface: zone, root: root}, msg)
+		})
+		It("plans without copying zone tree", func() {
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			Expect(ops).To(HaveLen(2))
+			Expect(ops[1].Action).To(Equal(ddns.PlanActionAdd))
+			Expect(root.copied).To(BeFalse())
+		})
+	})
+})
+
+type rootZone struct {
+	dnsutils.ZoneInterface
+	root dnsutils.NameNodeInterface
+}
+
+func (z *rootZone) GetRootNode() dnsutils.NameNodeInterface { return z.root }
+
+type noCopyNameNode struct {
+	dnsutils.NameNodeInterface
+	copied bool
+}
+
+func (n *noCopyNameNode) CopyChildNodes() map[string]dnsutils.NameNodeInterface {
+	n.copied = true
+	return n.NameNodeInterface.CopyChildNodes()
+}
+
+var _ = Describe("UpdateRemoveRR", func() {
+	It("removes NS rrset other than zone apex", func() {
+		ui := NewTestUpdate()
+		d := ddns.NewDDNS(ui)
+		zone, err := dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+		Expect(err).To(Succeed())
+		Expect(d.UpdateRemoveRR(zone, &dns.ANY{Hdr: dns.RR_Header{Name: "example.jp.", Rrtype: dns.TypeNS, Class: dns.ClassANY}})).To(Succeed())
+		Expect(ui.removeRRSet).To(BeEmpty())
+		Expect(d.UpdateRemoveRR(zone, &dns.ANY{Hdr: dns.RR_Header{Name: "sub.example.jp.", Rrtype: dns.TypeNS, Class: dns.ClassANY}})).To(Succeed())
+		Expect(ui.removeRRSet).To(Equal(map[string][]uint16{"sub.example.jp.": {dns.TypeNS}}))
+	})
+})
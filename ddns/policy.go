@@ -0,0 +1,230 @@
+package ddns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidPolicy returns when update policy rule is not valid.
+var ErrInvalidPolicy = fmt.Errorf("invalid update policy")
+
+// PolicyAction is action of update policy rule.
+type PolicyAction string
+
+func (a PolicyAction) Get() PolicyAction {
+	return PolicyAction(strings.ToUpper(string(a)))
+}
+
+const (
+	PolicyActionGrant PolicyAction = "GRANT"
+	PolicyActionDeny  PolicyAction = "DENY"
+)
+
+// PolicyMatchType is name match type of update policy rule.
+type PolicyMatchType string
+
+func (m PolicyMatchType) Get() PolicyMatchType {
+	return PolicyMatchType(strings.ToUpper(string(m)))
+}
+
+const (
+	// PolicyMatchName matches the name only.
+	PolicyMatchName PolicyMatchType = "NAME"
+	// PolicyMatchSubdomain matches the name and its subdomains.
+	PolicyMatchSubdomain PolicyMatchType = "SUBDOMAIN"
+	// PolicyMatchWildcard matches names by wildcard name. e.g. *.example.jp.
+	PolicyMatchWildcard PolicyMatchType = "WILDCARD"
+	// PolicyMatchSelf matches the name which is equal to the TSIG key name.
+	PolicyMatchSelf PolicyMatchType = "SELF"
+)
+
+// Identity is requester of update.
+type Identity struct {
+	// KeyName is verified TSIG key name. If the request is not signed, it is empty.
+	KeyName string
+	// Addr is client address.
+	Addr net.IP
+}
+
+// NewIdentity creates Identity from request.
+// keyName must be verified TSIG key name.
+func NewIdentity(keyName string, addr net.Addr) *Identity {
+	id := &Identity{}
+	if keyName != "" {
+		id.KeyName = dns.CanonicalName(keyName)
+	}
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		id.Addr = a.IP
+	case *net.TCPAddr:
+		id.Addr = a.IP
+	}
+	return id
+}
+
+// PolicyRule is BIND style update-policy rule.
+//
+//	{"Action": "grant", "Key": "key.example.jp.", "MatchType": "subdomain", "Name": "dyn.example.jp.", "Types": ["A", "AAAA"]}
+type PolicyRule struct {
+	Action PolicyAction
+	// Key is TSIG key name. "*" matches any signed request. If empty, it is not checked.
+	Key string
+	// Network is client subnet. If empty, it is not checked.
+	Network string
+	// MatchType is name match type.
+	MatchType PolicyMatchType
+	// Name is target name. It is ignored when MatchType is SELF.
+	Name string
+	// Types is target types. If empty, it matches all types.
+	Types []string
+
+	network *net.IPNet
+	types   map[uint16]struct{}
+}
+
+// Validate checks rule.
+func (r *PolicyRule) Validate() error {
+	switch r.Action.Get() {
+	case PolicyActionGrant, PolicyActionDeny:
+	default:
+		return fmt.Errorf("%w: invalid action `%s`", ErrInvalidPolicy, r.Action)
+	}
+	if r.Key != "" && r.Key != "*" {
+		if _, ok := dns.IsDomainName(r.Key); !ok {
+			return fmt.Errorf("%w: invalid key `%s`", ErrInvalidPolicy, r.Key)
+		}
+	}
+	r.network = nil
+	if r.Network != "" {
+		_, n, err := net.ParseCIDR(r.Network)
+		if err != nil {
+			return fmt.Errorf("%w: invalid network `%s`", ErrInvalidPolicy, r.Network)
+		}
+		r.network = n
+	}
+	switch r.MatchType.Get() {
+	case PolicyMatchName, PolicyMatchSubdomain:
+		if _, ok := dns.IsDomainName(r.Name); !ok || r.Name == "" {
+			return fmt.Errorf("%w: invalid name `%s`", ErrInvalidPolicy, r.Name)
+		}
+	case PolicyMatchWildcard:
+		if !strings.HasPrefix(r.Name, "*.") {
+			return fmt.Errorf("%w: invalid wildcard name `%s`", ErrInvalidPolicy, r.Name)
+		}
+		if _, ok := dns.IsDomainName(r.Name); !ok {
+			return fmt.Errorf("%w: invalid name `%s`", ErrInvalidPolicy, r.Name)
+		}
+	case PolicyMatchSelf:
+	default:
+		return fmt.Errorf("%w: invalid match type `%s`", ErrInvalidPolicy, r.MatchType)
+	}
+	r.types = nil
+	if len(r.Types) > 0 {
+		r.types = map[uint16]struct{}{}
+		for _, t := range r.Types {
+			rrtype, ok := dns.StringToType[strings.ToUpper(t)]
+			if !ok {
+				return fmt.Errorf("%w: invalid type `%s`", ErrInvalidPolicy, t)
+			}
+			r.types[rrtype] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func (r *PolicyRule) matchIdentity(id *Identity) bool {
+	if r.Key != "" {
+		if id.KeyName == "" {
+			return false
+		}
+		if r.Key != "*" && !strings.EqualFold(dns.Fqdn(r.Key), id.KeyName) {
+			return false
+		}
+	}
+	if r.network != nil && (id.Addr == nil || !r.network.Contains(id.Addr)) {
+		return false
+	}
+	return true
+}
+
+func (r *PolicyRule) matchName(id *Identity, name string) bool {
+	name = dns.CanonicalName(name)
+	switch r.MatchType.Get() {
+	case PolicyMatchName:
+		return name == dns.CanonicalName(r.Name)
+	case PolicyMatchSubdomain:
+		return dns.IsSubDomain(dns.CanonicalName(r.Name), name)
+	case PolicyMatchWildcard:
+		parent := dns.CanonicalName(r.Name[2:])
+		return name != parent && dns.IsSubDomain(parent, name)
+	case PolicyMatchSelf:
+		return id.KeyName != "" && name == id.KeyName
+	}
+	return false
+}
+
+func (r *PolicyRule) matchType(rrtype uint16) bool {
+	if r.types == nil {
+		return true
+	}
+	_, ok := r.types[rrtype]
+	return ok
+}
+
+// UpdatePolicy is list of update policy rules.
+// Rules are evaluated in order and the first matched rule is applied.
+// If no rule matches, update is denied.
+type UpdatePolicy struct {
+	Rules []*PolicyRule
+}
+
+// NewUpdatePolicy creates UpdatePolicy.
+func NewUpdatePolicy(rules ...*PolicyRule) (*UpdatePolicy, error) {
+	p := &UpdatePolicy{Rules: rules}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReadUpdatePolicy reads UpdatePolicy from JSON.
+func ReadUpdatePolicy(r io.Reader) (*UpdatePolicy, error) {
+	p := &UpdatePolicy{}
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return nil, fmt.Errorf("failed to decode json: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks all rules.
+func (p *UpdatePolicy) Validate() error {
+	for i, r := range p.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// IsAllowed returns true when identity is granted to update rr.
+// Rules must be validated before.
+func (p *UpdatePolicy) IsAllowed(id *Identity, rr dns.RR) bool {
+	if id == nil {
+		id = &Identity{}
+	}
+	for _, r := range p.Rules {
+		if !r.matchIdentity(id) || !r.matchName(id, rr.Header().Name) || !r.matchType(rr.Header().Rrtype) {
+			continue
+		}
+		return r.Action.Get() == PolicyActionGrant
+	}
+	return false
+}
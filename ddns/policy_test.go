@@ -0,0 +1,79 @@
+package ddns_test
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils/ddns"
+	. "github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UpdatePolicy", func() {
+	var (
+		p   *ddns.UpdatePolicy
+		err error
+	)
+	BeforeEach(func() {
+		f, err := os.Open("tests/policy.json")
+		Expect(err).To(Succeed())
+		defer f.Close()
+		p, err = ddns.ReadUpdatePolicy(f)
+		Expect(err).To(Succeed())
+	})
+	Context("IsAllowed", func() {
+		var (
+			dyn  = ddns.NewIdentity("DYN.example.jp", nil)
+			host = ddns.NewIdentity("host.example.jp.", nil)
+			dhcp = ddns.NewIdentity("", &net.UDPAddr{IP: net.ParseIP("192.168.0.10"), Port: 53})
+			anon = ddns.NewIdentity("", &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53})
+		)
+		It("checks name match type", func() {
+			Expect(p.IsAllowed(dyn, MustNewRR("dyn.example.jp. 300 IN TXT test"))).To(BeTrue())
+			Expect(p.IsAllowed(dyn, MustNewRR("a.dyn.example.jp. 300 IN TXT test"))).To(BeTrue())
+			Expect(p.IsAllowed(dyn, MustNewRR("www.example.jp. 300 IN TXT test"))).To(BeFalse())
+			Expect(p.IsAllowed(host, MustNewRR("host.example.jp. 300 IN A 192.168.0.1"))).To(BeTrue())
+			Expect(p.IsAllowed(host, MustNewRR("a.host.example.jp. 300 IN A 192.168.0.1"))).To(BeFalse())
+			Expect(p.IsAllowed(dhcp, MustNewRR("a.dhcp.example.jp. 300 IN A 192.168.0.1"))).To(BeTrue())
+			Expect(p.IsAllowed(dhcp, MustNewRR("a.b.dhcp.example.jp. 300 IN A 192.168.0.1"))).To(BeTrue())
+			Expect(p.IsAllowed(dhcp, MustNewRR("dhcp.example.jp. 300 IN A 192.168.0.1"))).To(BeFalse())
+		})
+		It("checks types", func() {
+			Expect(p.IsAllowed(host, MustNewRR("host.example.jp. 300 IN TXT test"))).To(BeFalse())
+			Expect(p.IsAllowed(dhcp, MustNewRR("a.dhcp.example.jp. 300 IN TXT test"))).To(BeFalse())
+			Expect(p.IsAllowed(dyn, &dns.ANY{Hdr: dns.RR_Header{Name: "a.dyn.example.jp.", Rrtype: dns.TypeANY, Class: dns.ClassANY}})).To(BeTrue())
+			Expect(p.IsAllowed(host, &dns.ANY{Hdr: dns.RR_Header{Name: "host.example.jp.", Rrtype: dns.TypeANY, Class: dns.ClassANY}})).To(BeFalse())
+		})
+		It("checks identity", func() {
+			Expect(p.IsAllowed(anon, MustNewRR("a.dhcp.example.jp. 300 IN A 192.168.0.1"))).To(BeFalse())
+			Expect(p.IsAllowed(host, MustNewRR("a.dyn.example.jp. 300 IN A 192.168.0.1"))).To(BeFalse())
+			Expect(p.IsAllowed(nil, MustNewRR("a.dyn.example.jp. 300 IN A 192.168.0.1"))).To(BeFalse())
+		})
+		It("applies first matched rule", func() {
+			ns1 := ddns.NewIdentity("ns1.example.jp.", nil)
+			Expect(p.IsAllowed(ns1, MustNewRR("ns1.example.jp. 300 IN A 192.168.0.1"))).To(BeFalse())
+		})
+	})
+	Context("Validate", func() {
+		It("returns ErrInvalidPolicy for invalid rule", func() {
+			for _, r := range []*ddns.PolicyRule{
+				{Action: "allow", MatchType: ddns.PolicyMatchSelf},
+				{Action: ddns.PolicyActionGrant, MatchType: "zone"},
+				{Action: ddns.PolicyActionGrant, MatchType: ddns.PolicyMatchName},
+				{Action: ddns.PolicyActionGrant, MatchType: ddns.PolicyMatchWildcard, Name: "dhcp.example.jp."},
+				{Action: ddns.PolicyActionGrant, MatchType: ddns.PolicyMatchSelf, Network: "192.168.0.1"},
+				{Action: ddns.PolicyActionGrant, MatchType: ddns.PolicyMatchSelf, Types: []string{"FOO"}},
+			} {
+				_, err = ddns.NewUpdatePolicy(r)
+				Expect(err).To(MatchError(ddns.ErrInvalidPolicy))
+			}
+		})
+		It("returns error for invalid json", func() {
+			_, err = ddns.ReadUpdatePolicy(strings.NewReader(`{"Rules":[{"Action":"grant","MatchType":"foo"}]}`))
+			Expect(err).To(MatchError(ddns.ErrInvalidPolicy))
+		})
+	})
+})
@@ -0,0 +1,93 @@
+package ddns
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+)
+
+// updateOverlay tracks changes by update RRs over live zone.
+// Only name nodes touched by update are copied, the zone is not changed.
+type updateOverlay struct {
+	zone      dnsutils.ZoneInterface
+	generator dnsutils.Generator
+	nodes     map[string]dnsutils.NameNodeInterface
+}
+
+func newUpdateOverlay(z dnsutils.ZoneInterface) *updateOverlay {
+	return &updateOverlay{
+		zone:      z,
+		generator: &dnsutils.DefaultGenerator{},
+		nodes:     map[string]dnsutils.NameNodeInterface{},
+	}
+}
+
+// getNameNode returns name node which changes are applied to.
+// Name node which all rrsets are removed from is treated as non-existent, as it is pruned from zone tree.
+func (o *updateOverlay) getNameNode(name string) (dnsutils.NameNodeInterface, bool) {
+	if nn, ok := o.nodes[dns.CanonicalName(name)]; ok {
+		return nn, nn.RRSetLen() > 0
+	}
+	return o.zone.GetRootNode().GetNameNode(name)
+}
+
+// nameNode returns copy of name node for changing.
+// If name does not exist in zone, it returns new name node.
+func (o *updateOverlay) nameNode(name string) (dnsutils.NameNodeInterface, error) {
+	name = dns.CanonicalName(name)
+	if nn, ok := o.nodes[name]; ok {
+		return nn, nil
+	}
+	nn, err := o.generator.NewNameNode(name, o.zone.GetClass())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create name node: %w", err)
+	}
+	if cur, ok := o.zone.GetRootNode().GetNameNode(name); ok {
+		for _, set := range cur.CopyRRSetMap() {
+			if err := nn.SetRRSet(set.Copy()); err != nil {
+				return nil, fmt.Errorf("failed to set rrset: %w", err)
+			}
+		}
+	}
+	o.nodes[name] = nn
+	return nn, nil
+}
+
+func (o *updateOverlay) apply(op *PlanOperation) error {
+	switch op.Action {
+	case PlanActionSkip:
+		return nil
+	case PlanActionAdd, PlanActionReplace:
+	default:
+		// removing from non-existent name does nothing
+		if _, ok := o.getNameNode(op.RR.Header().Name); !ok {
+			return nil
+		}
+	}
+	nn, err := o.nameNode(op.RR.Header().Name)
+	if err != nil {
+		return err
+	}
+	switch op.Action {
+	case PlanActionAdd:
+		set, err := addRR(nn, op.RR, o.zone.GetClass(), o.generator)
+		if err != nil {
+			return err
+		}
+		return nn.SetRRSet(set)
+	case PlanActionReplace:
+		return nn.SetRRSet(dnsutils.NewRRSetFromRR(op.RR))
+	case PlanActionRemoveNameApex:
+		_, err = removeRRSets(nn, func(rrtype uint16) bool {
+			return rrtype == dns.TypeSOA || rrtype == dns.TypeNS
+		})
+	case PlanActionRemoveName:
+		_, err = removeRRSets(nn, func(uint16) bool { return false })
+	case PlanActionRemoveRRSet:
+		_, err = removeRRSets(nn, func(t uint16) bool { return t != op.RR.Header().Rrtype })
+	case PlanActionRemoveRR:
+		_, err = removeRR(nn, op.RR, o.zone.GetClass())
+	}
+	return err
+}
@@ -0,0 +1,332 @@
+package ddns
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+)
+
+var _ UpdateInterface = &ZoneUpdate{}
+
+// ZoneUpdate is in-memory implement of UpdateInterface.
+// Changes are applied to staged copy of zone tree.
+// UpdatePostProcess bumps SOA serial and replaces zone tree by staged tree,
+// UpdateFailedPostProcess discards staged tree.
+type ZoneUpdate struct {
+	mu        sync.Mutex
+	zone      dnsutils.ZoneInterface
+	generator dnsutils.Generator
+	staged    dnsutils.NameNodeInterface
+	changed   bool
+	soaSet    bool
+
+	signOption *dnsutils.SignOption
+	dnskeys    []*dnsutils.DNSKEY
+	zoneLocker sync.Locker
+}
+
+type stagedZone struct {
+	dnsutils.ZoneInterface
+	root dnsutils.NameNodeInterface
+}
+
+func (z *stagedZone) GetRootNode() dnsutils.NameNodeInterface { return z.root }
+
+// NewZoneUpdate creates ZoneUpdate.
+// if generator is nil, use DefaultGenerator.
+func NewZoneUpdate(z dnsutils.ZoneInterface, generator dnsutils.Generator) *ZoneUpdate {
+	if generator == nil {
+		generator = &dnsutils.DefaultGenerator{}
+	}
+	return &ZoneUpdate{zone: z, generator: generator}
+}
+
+// EnableSign enables re-signing for DNSSEC signed zone.
+// After changes are applied, UpdatePostProcess re-signs changed rrsets by dnsutils.Resign.
+// If re-signing fails, changes are discarded.
+func (u *ZoneUpdate) EnableSign(opt dnsutils.SignOption, dnskeys []*dnsutils.DNSKEY) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.signOption = &opt
+	u.dnskeys = dnskeys
+}
+
+// SetZoneLocker sets lock of zone.
+// UpdatePostProcess holds l while it replaces zone tree by staged tree.
+// Readers of the zone should hold the read lock of the same lock, for example sync.RWMutex.RLock.
+// If l is not set, readers may see the zone tree during replacement.
+func (u *ZoneUpdate) SetZoneLocker(l sync.Locker) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.zoneLocker = l
+}
+
+func (u *ZoneUpdate) stage() (dnsutils.NameNodeInterface, error) {
+	if u.staged == nil {
+		root, err := dnsutils.CopyNameNodeTree(u.zone.GetRootNode(), u.generator)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy zone: %w", err)
+		}
+		u.staged = root
+	}
+	return u.staged, nil
+}
+
+// getNameNode returns name node of zone which staged changes are applied to.
+func (u *ZoneUpdate) getNameNode(name string) (dnsutils.NameNodeInterface, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.staged == nil {
+		return u.zone.GetRootNode().GetNameNode(name)
+	}
+	return u.staged.GetNameNode(name)
+}
+
+func (u *ZoneUpdate) setRRSet(set dnsutils.RRSetInterface) error {
+	root, err := u.stage()
+	if err != nil {
+		return err
+	}
+	nn, err := dnsutils.GetNameNodeOrCreate(root, set.GetName(), u.generator)
+	if err != nil {
+		return fmt.Errorf("failed to get name node: %w", err)
+	}
+	if err := nn.SetRRSet(set); err != nil {
+		return fmt.Errorf("failed to set rrset: %w", err)
+	}
+	if err := dnsutils.SetNameNode(root, nn, u.generator); err != nil {
+		return fmt.Errorf("failed to set name node: %w", err)
+	}
+	if set.GetRRtype() == dns.TypeSOA {
+		u.soaSet = true
+	}
+	u.changed = true
+	return nil
+}
+
+// AddRR is implement of UpdateInterface.AddRR
+// If rrset already exists, TTL of rrset is changed to TTL of rr.
+func (u *ZoneUpdate) AddRR(rr dns.RR) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	root, err := u.stage()
+	if err != nil {
+		return err
+	}
+	nn, ok := root.GetNameNode(rr.Header().Name)
+	if !ok {
+		nn = nil
+	}
+	set, err := addRR(nn, rr, u.zone.GetClass(), u.generator)
+	if err != nil {
+		return err
+	}
+	return u.setRRSet(set)
+}
+
+// addRR returns rrset of nn which rr is added to.
+// nn may be nil.
+func addRR(nn dnsutils.NameNodeInterface, rr dns.RR, class dns.Class, generator dnsutils.RRSetGenerator) (dnsutils.RRSetInterface, error) {
+	var (
+		set dnsutils.RRSetInterface
+		err error
+	)
+	if nn != nil {
+		set = nn.GetRRSet(rr.Header().Rrtype)
+	}
+	if dnsutils.IsEmptyRRSet(set) {
+		set, err = generator.NewRRSet(rr.Header().Name, rr.Header().Ttl, class, rr.Header().Rrtype)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rrset: %w", err)
+		}
+	}
+	if err := set.SetTTL(rr.Header().Ttl); err != nil {
+		return nil, fmt.Errorf("failed to set ttl: %w", err)
+	}
+	if err := set.AddRR(rr); err != nil {
+		return nil, fmt.Errorf("failed to add rr: %w", err)
+	}
+	return set, nil
+}
+
+// ReplaceRRSet is implement of UpdateInterface.ReplaceRRSet
+func (u *ZoneUpdate) ReplaceRRSet(set dnsutils.RRSetInterface) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.setRRSet(set.Copy())
+}
+
+func (u *ZoneUpdate) removeName(name string, keep func(rrtype uint16) bool) error {
+	root, err := u.stage()
+	if err != nil {
+		return err
+	}
+	nn, ok := root.GetNameNode(name)
+	if !ok {
+		return nil
+	}
+	changed, err := removeRRSets(nn, keep)
+	if changed {
+		u.changed = true
+	}
+	return err
+}
+
+// removeRRSets removes rrsets of nn except for types which keep returns true.
+// It returns true if any rrset is removed.
+func removeRRSets(nn dnsutils.NameNodeInterface, keep func(rrtype uint16) bool) (bool, error) {
+	changed := false
+	for rrtype, set := range nn.CopyRRSetMap() {
+		if keep(rrtype) || dnsutils.IsEmptyRRSet(set) {
+			continue
+		}
+		if err := nn.RemoveRRSet(rrtype); err != nil {
+			return changed, fmt.Errorf("failed to remove rrset: %w", err)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// RemoveNameApex is implement of UpdateInterface.RemoveNameApex
+func (u *ZoneUpdate) RemoveNameApex(name string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.removeName(name, func(rrtype uint16) bool {
+		return rrtype == dns.TypeSOA || rrtype == dns.TypeNS
+	})
+}
+
+// RemoveName is implement of UpdateInterface.RemoveName
+func (u *ZoneUpdate) RemoveName(name string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.removeName(name, func(uint16) bool { return false })
+}
+
+// RemoveRRSet is implement of UpdateInterface.RemoveRRSet
+func (u *ZoneUpdate) RemoveRRSet(name string, rrtype uint16) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.removeName(name, func(t uint16) bool { return t != rrtype })
+}
+
+// RemoveRR is implement of UpdateInterface.RemoveRR
+// Class and TTL of rr are ignored.
+func (u *ZoneUpdate) RemoveRR(rr dns.RR) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	root, err := u.stage()
+	if err != nil {
+		return err
+	}
+	nn, ok := root.GetNameNode(rr.Header().Name)
+	if !ok {
+		return nil
+	}
+	changed, err := removeRR(nn, rr, u.zone.GetClass())
+	if changed {
+		u.changed = true
+	}
+	return err
+}
+
+// removeRR removes rr from nn. Class and TTL of rr are ignored.
+// It returns true if rr is removed.
+func removeRR(nn dnsutils.NameNodeInterface, rr dns.RR, class dns.Class) (bool, error) {
+	set := nn.GetRRSet(rr.Header().Rrtype)
+	if dnsutils.IsEmptyRRSet(set) {
+		return false, nil
+	}
+	rr = dns.Copy(rr)
+	rr.Header().Class = uint16(class)
+	rr.Header().Ttl = set.GetTTL()
+	l := set.Len()
+	if err := set.RemoveRR(rr); err != nil {
+		return false, fmt.Errorf("failed to remove rr: %w", err)
+	}
+	if set.Len() == l {
+		return false, nil
+	}
+	if set.Len() == 0 {
+		return true, nn.RemoveRRSet(set.GetRRtype())
+	}
+	return true, nn.SetRRSet(set)
+}
+
+// UpdateFailedPostProcess is implement of UpdateInterface.UpdateFailedPostProcess
+// It discards staged changes.
+func (u *ZoneUpdate) UpdateFailedPostProcess(error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.reset()
+}
+
+func (u *ZoneUpdate) reset() {
+	u.staged = nil
+	u.changed = false
+	u.soaSet = false
+}
+
+// UpdatePostProcess is implement of UpdateInterface.UpdatePostProcess
+// If zone is changed, it increments SOA serial unless update sets newer SOA, and replaces zone tree.
+// The zone tree is replaced while holding the lock set by SetZoneLocker.
+func (u *ZoneUpdate) UpdatePostProcess() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	defer u.reset()
+	if u.staged == nil || !u.changed {
+		return nil
+	}
+	cur, err := dnsutils.GetSOA(u.zone)
+	if err != nil {
+		return err
+	}
+	soa, err := dnsutils.GetFirstTyped[*dns.SOA](u.staged, dns.TypeSOA)
+	if err != nil {
+		return fmt.Errorf("failed to get SOA: %w", err)
+	}
+	if !u.soaSet || dnsutils.CompareSerial(soa.Serial, cur.Serial) <= 0 {
+		soa = dns.Copy(soa).(*dns.SOA)
+		soa.Serial = cur.Serial + 1
+		set, err := dnsutils.NewRRSetFromRRWithGenerator(soa, u.generator)
+		if err != nil {
+			return fmt.Errorf("failed to create SOA rrset: %w", err)
+		}
+		if err := u.staged.SetRRSet(set); err != nil {
+			return fmt.Errorf("failed to set SOA: %w", err)
+		}
+	}
+	if u.signOption != nil {
+		if err := dnsutils.Resign(&stagedZone{ZoneInterface: u.zone, root: u.staged}, u.zone.GetRootNode(), *u.signOption, u.dnskeys, u.generator); err != nil {
+			return fmt.Errorf("failed to re-sign zone: %w", err)
+		}
+	}
+	if u.zoneLocker != nil {
+		u.zoneLocker.Lock()
+		defer u.zoneLocker.Unlock()
+	}
+	return u.zone.GetRootNode().SetValue(u.staged)
+}
+
+// IsPrecheckSupportedRtype is implement of UpdateInterface.IsPrecheckSupportedRtype
+// It supports all types.
+func (u *ZoneUpdate) IsPrecheckSupportedRtype(uint16) bool {
+	return true
+}
+
+// IsUpdateSupportedRtype is implement of UpdateInterface.IsUpdateSupportedRtype
+// It supports all types. If signing is enabled, RRSIG, NSEC and NSEC3 are not supported.
+func (u *ZoneUpdate) IsUpdateSupportedRtype(rrtype uint16) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.signOption != nil {
+		switch rrtype {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,242 @@
+package ddns_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/ddns"
+	. "github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type countLocker struct {
+	locked, unlocked int
+}
+
+func (l *countLocker) Lock()   { l.locked++ }
+func (l *countLocker) Unlock() { l.unlocked++ }
+
+var _ = Describe("ZoneUpdate", func() {
+	var (
+		zone *dnsutils.Zone
+		u    *ddns.ZoneUpdate
+		d    *ddns.DDNS
+		msg  *dns.Msg
+		rc   int
+		err  error
+	)
+	serial := func() uint32 {
+		soa, err := dnsutils.GetSOA(zone)
+		Expect(err).To(Succeed())
+		return soa.Serial
+	}
+	rrs := func(name string, rrtype uint16) []dns.RR {
+		nn, ok := zone.GetRootNode().GetNameNode(name)
+		if !ok || nn.GetRRSet(rrtype) == nil {
+			return nil
+		}
+		return nn.GetRRSet(rrtype).GetRRs()
+	}
+	BeforeEach(func() {
+		zone, err = dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+		Expect(err).To(Succeed())
+		Expect(zone.Read(bytes.NewBuffer(zonefile))).To(Succeed())
+		u = ddns.NewZoneUpdate(zone, nil)
+		d = ddns.NewDDNS(u)
+		msg = &dns.Msg{}
+		msg.SetUpdate("example.jp.")
+	})
+	When("adds RRs", func() {
+		BeforeEach(func() {
+			msg.Insert([]dns.RR{
+				MustNewRR("mail.example.jp. 300 IN A 192.168.1.4"),
+				MustNewRR("new.sub.example.jp. 300 IN HINFO \"cpu\" \"os\""),
+			})
+			rc, err = d.ServeUpdate(zone, msg)
+		})
+		It("applies changes and bumps serial", func() {
+			Expect(err).To(Succeed())
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			Expect(rrs("mail.example.jp.", dns.TypeA)).To(HaveLen(4))
+			Expect(rrs("mail.example.jp.", dns.TypeA)[0].Header().Ttl).To(Equal(uint32(300)))
+			Expect(rrs("new.sub.example.jp.", dns.TypeHINFO)).To(HaveLen(1))
+			Expect(serial()).To(Equal(uint32(2)))
+		})
+	})
+	When("replaces CNAME and SOA", func() {
+		BeforeEach(func() {
+			msg.Insert([]dns.RR{
+				MustNewRR("www.example.jp. 3600 IN CNAME www2.example.net."),
+				MustNewRR("example.jp. 3600 IN SOA localhost. root.localost. 10 3600 900 85400 300"),
+			})
+			rc, err = d.ServeUpdate(zone, msg)
+		})
+		It("keeps newer SOA serial", func() {
+			Expect(err).To(Succeed())
+			Expect(rrs("www.example.jp.", dns.TypeCNAME)).To(Equal([]dns.RR{MustNewRR("www.example.jp. 3600 IN CNAME www2.example.net.")}))
+			Expect(serial()).To(Equal(uint32(10)))
+		})
+	})
+	When("removes name, rrset and rr", func() {
+		BeforeEach(func() {
+			msg.RemoveName([]dns.RR{MustNewRR("help.example.jp. 0 IN A 0.0.0.0")})
+			msg.RemoveRRset([]dns.RR{MustNewRR("ns1.example.jp. 0 IN AAAA ::")})
+			msg.Remove([]dns.RR{MustNewRR("mail.example.jp. 0 IN A 192.168.1.1")})
+			msg.RemoveName([]dns.RR{MustNewRR("example.jp. 0 IN A 0.0.0.0")})
+			rc, err = d.ServeUpdate(zone, msg)
+		})
+		It("applies changes", func() {
+			Expect(err).To(Succeed())
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			_, ok := zone.GetRootNode().GetNameNode("help.example.jp.")
+			Expect(ok).To(BeFalse())
+			Expect(rrs("ns1.example.jp.", dns.TypeAAAA)).To(BeNil())
+			Expect(rrs("ns1.example.jp.", dns.TypeA)).To(HaveLen(1))
+			Expect(rrs("mail.example.jp.", dns.TypeA)).To(HaveLen(2))
+			Expect(rrs("example.jp.", dns.TypeNS)).To(HaveLen(2))
+			Expect(serial()).To(Equal(uint32(2)))
+		})
+	})
+	When("deletes name and adds CNAME in one message", func() {
+		BeforeEach(func() {
+			msg.RemoveName([]dns.RR{MustNewRR("mail.example.jp. 0 IN A 0.0.0.0")})
+			msg.Insert([]dns.RR{MustNewRR("mail.example.jp. 300 IN CNAME www.example.net.")})
+			rc, err = d.ServeUpdate(zone, msg)
+		})
+		It("checks CNAME against the deleted name", func() {
+			Expect(err).To(Succeed())
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			Expect(rrs("mail.example.jp.", dns.TypeA)).To(BeNil())
+			Expect(rrs("mail.example.jp.", dns.TypeCNAME)).To(Equal([]dns.RR{MustNewRR("mail.example.jp. 300 IN CNAME www.example.net.")}))
+		})
+	})
+	When("adds CNAME and then A in one message", func() {
+		BeforeEach(func() {
+			msg.Insert([]dns.RR{
+				MustNewRR("new.example.jp. 300 IN CNAME www.example.net."),
+				MustNewRR("new.example.jp. 300 IN A 192.168.1.4"),
+			})
+			rc, err = d.ServeUpdate(zone, msg)
+		})
+		It("skips A because of added CNAME", func() {
+			Expect(err).To(Succeed())
+			Expect(rrs("new.example.jp.", dns.TypeCNAME)).To(HaveLen(1))
+			Expect(rrs("new.example.jp.", dns.TypeA)).To(BeNil())
+		})
+	})
+	When("zone locker is set", func() {
+		var locker *countLocker
+		BeforeEach(func() {
+			locker = &countLocker{}
+			u.SetZoneLocker(locker)
+			msg.Insert([]dns.RR{MustNewRR("new.example.jp. 300 IN A 192.168.1.4")})
+			rc, err = d.ServeUpdate(zone, msg)
+		})
+		It("replaces zone tree holding the lock", func() {
+			Expect(err).To(Succeed())
+			Expect(locker.locked).To(Equal(1))
+			Expect(locker.unlocked).To(Equal(1))
+		})
+	})
+	When("nothing is changed", func() {
+		BeforeEach(func() {
+			msg.Remove([]dns.RR{MustNewRR("mail.example.jp. 0 IN A 192.168.1.100")})
+			rc, err = d.ServeUpdate(zone, msg)
+		})
+		It("does not bump serial", func() {
+			Expect(err).To(Succeed())
+			Expect(serial()).To(Equal(uint32(1)))
+		})
+	})
+	When("update fails", func() {
+		BeforeEach(func() {
+			Expect(u.AddRR(MustNewRR("mail.example.jp. 300 IN A 192.168.1.4"))).To(Succeed())
+			u.UpdateFailedPostProcess(fmt.Errorf("error"))
+			err = u.UpdatePostProcess()
+		})
+		It("discards staged changes", func() {
+			Expect(err).To(Succeed())
+			Expect(rrs("mail.example.jp.", dns.TypeA)).To(HaveLen(3))
+			Expect(serial()).To(Equal(uint32(1)))
+		})
+	})
+	When("changes are not committed", func() {
+		BeforeEach(func() {
+			Expect(u.RemoveName("help.example.jp.")).To(Succeed())
+		})
+		It("does not change zone", func() {
+			Expect(rrs("help.example.jp.", dns.TypeA)).To(HaveLen(1))
+		})
+	})
+	When("signing is enabled", func() {
+		var (
+			dnskeys    []*dnsutils.DNSKEY
+			inception  = uint32(1704067200)
+			expiration = uint32(1893456000)
+			opt        dnsutils.SignOption
+			f          = false
+		)
+		readKey := func(name string) *dnsutils.DNSKEY {
+			priv, err := os.Open("../testdata/sign/keys/" + name + ".private")
+			Expect(err).To(Succeed())
+			defer priv.Close()
+			pub, err := os.Open("../testdata/sign/keys/" + name + ".key")
+			Expect(err).To(Succeed())
+			defer pub.Close()
+			key, err := dnsutils.ReadDNSKEY(priv, pub)
+			Expect(err).To(Succeed())
+			return key
+		}
+		rrsigCovered := func(name string, rrtype uint16) []*dns.RRSIG {
+			var res []*dns.RRSIG
+			for _, rr := range rrs(name, dns.TypeRRSIG) {
+				if rrsig := rr.(*dns.RRSIG); rrsig.TypeCovered == rrtype {
+					res = append(res, rrsig)
+				}
+			}
+			return res
+		}
+		BeforeEach(func() {
+			dnskeys = []*dnsutils.DNSKEY{readKey("Kexample.jp.+015+02290"), readKey("Kexample.jp.+015+30075")}
+			opt = dnsutils.SignOption{
+				DoEMethod:     dnsutils.DenialOfExistenceMethodNSEC,
+				Inception:     &inception,
+				Expiration:    &expiration,
+				ZONEMDEnabled: &f,
+				CDSEnabled:    &f,
+			}
+			Expect(dnsutils.Sign(zone, opt, dnskeys, nil)).To(Succeed())
+			msg.Insert([]dns.RR{MustNewRR("new.example.jp. 300 IN A 192.168.1.4")})
+		})
+		It("re-signs zone", func() {
+			u.EnableSign(opt, dnskeys)
+			rc, err = d.ServeUpdate(zone, msg)
+			Expect(err).To(Succeed())
+			Expect(rc).To(Equal(dns.RcodeSuccess))
+			Expect(serial()).To(Equal(uint32(2)))
+			Expect(rrsigCovered("new.example.jp.", dns.TypeA)).To(HaveLen(1))
+			Expect(rrs("new.example.jp.", dns.TypeNSEC)).To(HaveLen(1))
+			Expect(rrsigCovered("example.jp.", dns.TypeSOA)).To(HaveLen(1))
+			Expect(rrsigCovered("example.jp.", dns.TypeSOA)[0].Verify(dnskeys[1].GetRR(), rrs("example.jp.", dns.TypeSOA))).To(Succeed())
+		})
+		It("rejects RRSIG, NSEC and NSEC3 updates", func() {
+			u.EnableSign(opt, dnskeys)
+			Expect(u.IsUpdateSupportedRtype(dns.TypeA)).To(BeTrue())
+			for _, rrtype := range []uint16{dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3} {
+				Expect(u.IsUpdateSupportedRtype(rrtype)).To(BeFalse())
+			}
+		})
+		It("rejects update when re-signing fails", func() {
+			u.EnableSign(opt, nil)
+			rc, err = d.ServeUpdate(zone, msg)
+			Expect(err).To(HaveOccurred())
+			Expect(rc).To(Equal(dns.RcodeServerFailure))
+			Expect(serial()).To(Equal(uint32(1)))
+			Expect(rrs("new.example.jp.", dns.TypeA)).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,144 @@
+package dnsutils
+
+import (
+	"github.com/miekg/dns"
+)
+
+// NameProof is the result of GetNameProof.
+// It contains names which are needed for answering and proof of non-existence.
+// https://datatracker.ietf.org/doc/html/rfc5155#section-7.2.1
+type NameProof struct {
+	// Zone is canonical zone name
+	Zone string
+	// QName is canonical query name
+	QName string
+	// Exist is true when QName exists in the zone (include ENT).
+	Exist bool
+	// ClosestEncloser is the longest existing ancestor of QName.
+	// If QName exists, it is QName.
+	ClosestEncloser string
+	// NextCloser is the name one label longer than ClosestEncloser.
+	// If QName exists, it is empty.
+	NextCloser string
+	// Wildcard is the wildcard name at ClosestEncloser (source of synthesis).
+	Wildcard string
+	// WildcardExist is true when Wildcard exists in the zone.
+	WildcardExist bool
+	// ZoneCut is the delegation point at or above QName.
+	// If QName is not at or below zone cut, it is empty.
+	ZoneCut string
+	// DNAME is owner name of DNAME RR above QName.
+	// If QName is not below DNAME, it is empty.
+	DNAME string
+}
+
+// IsBelowZoneCut returns true when QName is at or below zone cut.
+func (p *NameProof) IsBelowZoneCut() bool {
+	return p.ZoneCut != ""
+}
+
+// IsBelowDNAME returns true when QName is below DNAME owner name.
+func (p *NameProof) IsBelowDNAME() bool {
+	return p.DNAME != ""
+}
+
+// NSEC3NameProof is NSEC3 hashed owner names of NameProof.
+type NSEC3NameProof struct {
+	ClosestEncloser string
+	NextCloser      string
+	Wildcard        string
+}
+
+// NSEC3 returns NSEC3 hashed owner names using NSEC3PARAM.
+// If NextCloser is empty, NSEC3NameProof.NextCloser is empty.
+func (p *NameProof) NSEC3(param *dns.NSEC3PARAM) *NSEC3NameProof {
+	res := &NSEC3NameProof{
+		ClosestEncloser: HashNSEC3Name(p.ClosestEncloser, p.Zone, param),
+		Wildcard:        HashNSEC3Name(p.Wildcard, p.Zone, param),
+	}
+	if p.NextCloser != "" {
+		res.NextCloser = HashNSEC3Name(p.NextCloser, p.Zone, param)
+	}
+	return res
+}
+
+// HashNSEC3Name returns NSEC3 owner name of name.
+func HashNSEC3Name(name, zone string, param *dns.NSEC3PARAM) string {
+	return dns.CanonicalName(dns.HashName(name, param.Hash, param.Iterations, param.Salt) + "." + zone)
+}
+
+// GetNSEC3PARAM returns zone apex NSEC3PARAM.
+// If not exist NSEC3PARAM, returns nil.
+func GetNSEC3PARAM(z ZoneInterface) *dns.NSEC3PARAM {
+	param, err := GetFirstTyped[*dns.NSEC3PARAM](z.GetRootNode(), dns.TypeNSEC3PARAM)
+	if err != nil {
+		return nil
+	}
+	return param
+}
+
+// IsExistName checks that name node exists as domain name.
+// A node having only NSEC3 (and RRSIG) is not exist name, and ENT node having no children is not exist name.
+func IsExistName(n NameNodeInterface) bool {
+	for rrtype, set := range n.CopyRRSetMap() {
+		switch rrtype {
+		case dns.TypeNSEC3, dns.TypeRRSIG:
+		default:
+			if set.Len() > 0 {
+				return true
+			}
+		}
+	}
+	return len(n.CopyChildNodes()) > 0
+}
+
+// GetNameProof returns closest encloser, next closer name and source of synthesis of qname.
+// Searching stops at zone cut and DNAME.
+// It returns ErrBadName when qname is not domain name.
+// It returns ErrNotInDomain when qname is not in the zone.
+func GetNameProof(z ZoneInterface, qname string) (*NameProof, error) {
+	qname = dns.CanonicalName(qname)
+	if _, ok := dns.IsDomainName(qname); !ok {
+		return nil, ErrBadName
+	}
+	if !dns.IsSubDomain(z.GetName(), qname) {
+		return nil, ErrNotInDomain
+	}
+	names, _ := GetAllParentNames(qname, uint(dns.CountLabel(z.GetName())))
+	p := &NameProof{
+		Zone:            z.GetName(),
+		QName:           qname,
+		ClosestEncloser: z.GetName(),
+	}
+	cur := z.GetRootNode()
+	for _, name := range names {
+		if cur.GetName() != z.GetName() && !IsEmptyRRSet(cur.GetRRSet(dns.TypeNS)) {
+			p.ZoneCut = cur.GetName()
+			p.NextCloser = name
+			break
+		}
+		if !IsEmptyRRSet(cur.GetRRSet(dns.TypeDNAME)) {
+			p.DNAME = cur.GetName()
+			p.NextCloser = name
+			break
+		}
+		child, ok := cur.CopyChildNodes()[name]
+		if !ok || !IsExistName(child) {
+			p.NextCloser = name
+			break
+		}
+		cur = child
+		p.ClosestEncloser = name
+	}
+	if p.NextCloser == "" {
+		p.Exist = true
+		if cur.GetName() != z.GetName() && !IsEmptyRRSet(cur.GetRRSet(dns.TypeNS)) {
+			p.ZoneCut = cur.GetName()
+		}
+	}
+	p.Wildcard = dns.CanonicalName("*." + p.ClosestEncloser)
+	if wc, ok := cur.CopyChildNodes()[p.Wildcard]; ok {
+		p.WildcardExist = IsExistName(wc)
+	}
+	return p, nil
+}
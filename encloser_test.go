@@ -0,0 +1,178 @@
+package dnsutils_test
+
+import (
+	"bytes"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var testEncloserZone = []byte(`
+example.jp. 3600 IN SOA localhost. root.localhost. 1 3600 900 85400 300
+example.jp. 3600 IN NS ns1.example.jp.
+ns1.example.jp. 3600 IN A 192.168.0.1
+www.example.jp. 3600 IN A 192.168.0.2
+a.b.c.example.jp. 3600 IN A 192.168.0.3
+*.wild.example.jp. 3600 IN TXT "wildcard"
+sub.example.jp. 3600 IN NS ns.sub.example.jp.
+ns.sub.example.jp. 3600 IN A 192.168.0.4
+dname.example.jp. 3600 IN DNAME example.net.
+`)
+
+var _ = Describe("encloser.go", func() {
+	var (
+		err error
+		z   *dnsutils.Zone
+		p   *dnsutils.NameProof
+	)
+	BeforeEach(func() {
+		z = &dnsutils.Zone{}
+		Expect(z.Read(bytes.NewBuffer(testEncloserZone))).To(Succeed())
+	})
+	Context("GetNameProof", func() {
+		When("qname is invalid", func() {
+			BeforeEach(func() {
+				_, err = dnsutils.GetNameProof(z, "..")
+			})
+			It("returns ErrBadName", func() {
+				Expect(err).To(Equal(dnsutils.ErrBadName))
+			})
+		})
+		When("qname is out of zone", func() {
+			BeforeEach(func() {
+				_, err = dnsutils.GetNameProof(z, "example.net.")
+			})
+			It("returns ErrNotInDomain", func() {
+				Expect(err).To(Equal(dnsutils.ErrNotInDomain))
+			})
+		})
+		When("qname is apex", func() {
+			BeforeEach(func() {
+				p, err = dnsutils.GetNameProof(z, "example.jp.")
+			})
+			It("returns exist proof", func() {
+				Expect(err).To(Succeed())
+				Expect(p.Exist).To(BeTrue())
+				Expect(p.ClosestEncloser).To(Equal("example.jp."))
+				Expect(p.NextCloser).To(Equal(""))
+				Expect(p.IsBelowZoneCut()).To(BeFalse())
+			})
+		})
+		When("qname exists", func() {
+			BeforeEach(func() {
+				p, err = dnsutils.GetNameProof(z, "WWW.example.jp")
+			})
+			It("returns exist proof", func() {
+				Expect(err).To(Succeed())
+				Expect(p.QName).To(Equal("www.example.jp."))
+				Expect(p.Exist).To(BeTrue())
+				Expect(p.ClosestEncloser).To(Equal("www.example.jp."))
+			})
+		})
+		When("qname is ENT", func() {
+			BeforeEach(func() {
+				p, err = dnsutils.GetNameProof(z, "b.c.example.jp.")
+			})
+			It("returns exist proof", func() {
+				Expect(err).To(Succeed())
+				Expect(p.Exist).To(BeTrue())
+				Expect(p.ClosestEncloser).To(Equal("b.c.example.jp."))
+			})
+		})
+		When("qname does not exist", func() {
+			BeforeEach(func() {
+				p, err = dnsutils.GetNameProof(z, "x.y.c.example.jp.")
+			})
+			It("returns closest encloser and next closer", func() {
+				Expect(err).To(Succeed())
+				Expect(p.Exist).To(BeFalse())
+				Expect(p.ClosestEncloser).To(Equal("c.example.jp."))
+				Expect(p.NextCloser).To(Equal("y.c.example.jp."))
+				Expect(p.Wildcard).To(Equal("*.c.example.jp."))
+				Expect(p.WildcardExist).To(BeFalse())
+			})
+		})
+		When("qname matches wildcard", func() {
+			BeforeEach(func() {
+				p, err = dnsutils.GetNameProof(z, "x.y.wild.example.jp.")
+			})
+			It("returns source of synthesis", func() {
+				Expect(err).To(Succeed())
+				Expect(p.Exist).To(BeFalse())
+				Expect(p.ClosestEncloser).To(Equal("wild.example.jp."))
+				Expect(p.NextCloser).To(Equal("y.wild.example.jp."))
+				Expect(p.Wildcard).To(Equal("*.wild.example.jp."))
+				Expect(p.WildcardExist).To(BeTrue())
+			})
+		})
+		When("qname is zone cut", func() {
+			BeforeEach(func() {
+				p, err = dnsutils.GetNameProof(z, "sub.example.jp.")
+			})
+			It("returns zone cut", func() {
+				Expect(err).To(Succeed())
+				Expect(p.Exist).To(BeTrue())
+				Expect(p.ZoneCut).To(Equal("sub.example.jp."))
+				Expect(p.IsBelowZoneCut()).To(BeTrue())
+			})
+		})
+		When("qname is below zone cut", func() {
+			BeforeEach(func() {
+				p, err = dnsutils.GetNameProof(z, "ns.sub.example.jp.")
+			})
+			It("returns zone cut", func() {
+				Expect(err).To(Succeed())
+				Expect(p.Exist).To(BeFalse())
+				Expect(p.ZoneCut).To(Equal("sub.example.jp."))
+				Expect(p.ClosestEncloser).To(Equal("sub.example.jp."))
+				Expect(p.NextCloser).To(Equal("ns.sub.example.jp."))
+			})
+		})
+		When("qname is below DNAME", func() {
+			BeforeEach(func() {
+				p, err = dnsutils.GetNameProof(z, "www.dname.example.jp.")
+			})
+			It("returns DNAME", func() {
+				Expect(err).To(Succeed())
+				Expect(p.Exist).To(BeFalse())
+				Expect(p.IsBelowDNAME()).To(BeTrue())
+				Expect(p.DNAME).To(Equal("dname.example.jp."))
+				Expect(p.ClosestEncloser).To(Equal("dname.example.jp."))
+			})
+		})
+	})
+	Context("NSEC3", func() {
+		var (
+			param *dns.NSEC3PARAM
+			h     *dnsutils.NSEC3NameProof
+		)
+		BeforeEach(func() {
+			param = &dns.NSEC3PARAM{Hash: dns.SHA1, Iterations: 0, Salt: ""}
+			p, err = dnsutils.GetNameProof(z, "x.y.c.example.jp.")
+			Expect(err).To(Succeed())
+			h = p.NSEC3(param)
+		})
+		It("returns hashed names", func() {
+			Expect(h.ClosestEncloser).To(Equal(dns.CanonicalName(dns.HashName("c.example.jp.", dns.SHA1, 0, "") + ".example.jp.")))
+			Expect(h.NextCloser).To(Equal(dns.CanonicalName(dns.HashName("y.c.example.jp.", dns.SHA1, 0, "") + ".example.jp.")))
+			Expect(h.Wildcard).To(Equal(dns.CanonicalName(dns.HashName("*.c.example.jp.", dns.SHA1, 0, "") + ".example.jp.")))
+		})
+	})
+	Context("GetNSEC3PARAM", func() {
+		When("not exist", func() {
+			It("returns nil", func() {
+				Expect(dnsutils.GetNSEC3PARAM(z)).To(BeNil())
+			})
+		})
+		When("exist", func() {
+			BeforeEach(func() {
+				Expect(dnsutils.CreateDoE(z, dnsutils.SignOption{DoEMethod: dnsutils.DenialOfExistenceMethodNSEC3}, nil)).To(Succeed())
+			})
+			It("returns NSEC3PARAM", func() {
+				Expect(dnsutils.GetNSEC3PARAM(z)).NotTo(BeNil())
+			})
+		})
+	})
+})
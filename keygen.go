@@ -0,0 +1,159 @@
+package dnsutils
+
+import (
+	"crypto"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// KeyRole is role of DNSKEY.
+type KeyRole string
+
+const (
+	// KeyRoleKSK signs DNSKEY rrset. Flags is 257.
+	KeyRoleKSK KeyRole = "KSK"
+	// KeyRoleZSK signs rrsets other than DNSKEY. Flags is 256.
+	KeyRoleZSK KeyRole = "ZSK"
+	// KeyRoleCSK signs all rrsets. Flags is 257.
+	KeyRoleCSK KeyRole = "CSK"
+)
+
+var (
+	ErrUnsupportedAlgorithm = fmt.Errorf("unsupported algorithm")
+	ErrUnknownKeyRole       = fmt.Errorf("unknown key role")
+)
+
+// DefaultKeyBits is default key size by algorithm.
+var DefaultKeyBits = map[uint8]int{
+	dns.RSASHA256:       2048,
+	dns.ECDSAP256SHA256: 256,
+	dns.ECDSAP384SHA384: 384,
+	dns.ED25519:         256,
+}
+
+// GenerateDNSKEY generates new DNSKEY.
+// Supported algorithms are RSASHA256, ECDSAP256SHA256, ECDSAP384SHA384 and ED25519.
+// If bits is 0, DefaultKeyBits is used.
+func GenerateDNSKEY(name string, class dns.Class, algorithm uint8, role KeyRole, ttl uint32, bits int) (*DNSKEY, error) {
+	defBits, ok := DefaultKeyBits[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, dns.AlgorithmToString[algorithm])
+	}
+	if bits == 0 {
+		bits = defBits
+	}
+	var flags uint16
+	switch role {
+	case KeyRoleKSK, KeyRoleCSK:
+		flags = dns.ZONE | dns.SEP
+	case KeyRoleZSK:
+		flags = dns.ZONE
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyRole, role)
+	}
+	rr := &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   dns.CanonicalName(name),
+			Rrtype: dns.TypeDNSKEY,
+			Class:  uint16(class),
+			Ttl:    ttl,
+		},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: algorithm,
+	}
+	privateKey, err := rr.Generate(bits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, dns.AlgorithmToString[algorithm])
+	}
+	return &DNSKEY{rr: rr, signer: signer, csk: role == KeyRoleCSK}, nil
+}
+
+// GetRole returns role of key.
+func (d *DNSKEY) GetRole() KeyRole {
+	switch {
+	case d.csk:
+		return KeyRoleCSK
+	case d.IsKSK():
+		return KeyRoleKSK
+	}
+	return KeyRoleZSK
+}
+
+// KeyFileBase returns base name of BIND key files. (K<name>+<alg>+<tag>)
+func (d *DNSKEY) KeyFileBase() string {
+	return fmt.Sprintf("K%s+%03d+%05d", dns.CanonicalName(d.rr.Header().Name), d.rr.Algorithm, d.rr.KeyTag())
+}
+
+// WritePublicKey writes BIND .key file format.
+func (d *DNSKEY) WritePublicKey(w io.Writer) error {
+	role := "zone-signing key"
+	switch d.GetRole() {
+	case KeyRoleKSK:
+		role = "key-signing key"
+	case KeyRoleCSK:
+		role = "combined signing key"
+	}
+	_, err := fmt.Fprintf(w, "; This is a %s, keyid %d, for %s\n; Created: %s\n%s\n",
+		role, d.rr.KeyTag(), d.rr.Header().Name, time.Now().UTC().Format("20060102150405"), d.rr.String())
+	return err
+}
+
+// WritePrivateKey writes BIND .private file format.
+// Role of key is written as metadata line, which is read by ReadDNSKEY. e.g. "Role: CSK"
+func (d *DNSKEY) WritePrivateKey(w io.Writer) error {
+	priv := strings.TrimRight(d.rr.PrivateKeyString(d.signer), "\n")
+	_, err := fmt.Fprintf(w, "%s\n%s: %s\n", priv, keyRoleMetadata, d.GetRole())
+	return err
+}
+
+// keyRoleMetadata is name of metadata line of .private file.
+const keyRoleMetadata = "Role"
+
+// readKeyRole returns role in metadata line of .private file.
+// If it does not exist, it returns empty.
+func readKeyRole(priv []byte) KeyRole {
+	for _, line := range strings.Split(string(priv), "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(k), keyRoleMetadata) {
+			return KeyRole(strings.ToUpper(strings.TrimSpace(v)))
+		}
+	}
+	return ""
+}
+
+// WriteKeyFiles writes K<name>+<alg>+<tag>.key and .private into dir.
+// It returns paths of written files.
+func (d *DNSKEY) WriteKeyFiles(dir string) (pubPath, privPath string, err error) {
+	base := filepath.Join(dir, d.KeyFileBase())
+	pubPath, privPath = base+".key", base+".private"
+	if err := writeKeyFile(pubPath, 0644, d.WritePublicKey); err != nil {
+		return "", "", fmt.Errorf("failed to write public key: %w", err)
+	}
+	if err := writeKeyFile(privPath, 0600, d.WritePrivateKey); err != nil {
+		return "", "", fmt.Errorf("failed to write private key: %w", err)
+	}
+	return pubPath, privPath, nil
+}
+
+func writeKeyFile(path string, perm os.FileMode, write func(io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
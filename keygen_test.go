@@ -0,0 +1,134 @@
+package dnsutils_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test keygen.go", func() {
+	algorithms := []uint8{dns.RSASHA256, dns.ECDSAP256SHA256, dns.ECDSAP384SHA384, dns.ED25519}
+	signAndVerify := func(dnskey *dnsutils.DNSKEY, rrtype uint16) *dns.RRSIG {
+		var rr dns.RR
+		if rrtype == dns.TypeDNSKEY {
+			rr = dnskey.GetRR()
+		} else {
+			rr = testtool.MustNewRR("example.jp. 3600 IN A 192.168.0.1")
+		}
+		rrsigs, err := dnsutils.SignRRSet(dnsutils.NewRRSetFromRR(rr), dnsutils.SignOption{}, []*dnsutils.DNSKEY{dnskey})
+		Expect(err).To(Succeed())
+		if len(rrsigs) == 0 {
+			return nil
+		}
+		Expect(rrsigs[0].Verify(dnskey.GetRR(), []dns.RR{rr})).To(Succeed())
+		return rrsigs[0]
+	}
+	Context("GenerateDNSKEY", func() {
+		It("generates keys of supported algorithms", func() {
+			for _, alg := range algorithms {
+				ksk, err := dnsutils.GenerateDNSKEY("Example.jp", dns.ClassINET, alg, dnsutils.KeyRoleKSK, 3600, 0)
+				Expect(err).To(Succeed(), dns.AlgorithmToString[alg])
+				Expect(ksk.GetRR().Header().Name).To(Equal("example.jp."))
+				Expect(ksk.GetRR().Header().Ttl).To(Equal(uint32(3600)))
+				Expect(ksk.GetRR().Algorithm).To(Equal(alg))
+				Expect(ksk.GetRR().Flags).To(Equal(uint16(257)))
+				Expect(ksk.GetRole()).To(Equal(dnsutils.KeyRoleKSK))
+				Expect(signAndVerify(ksk, dns.TypeDNSKEY)).NotTo(BeNil())
+				Expect(signAndVerify(ksk, dns.TypeA)).To(BeNil())
+
+				zsk, err := dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, alg, dnsutils.KeyRoleZSK, 3600, 0)
+				Expect(err).To(Succeed(), dns.AlgorithmToString[alg])
+				Expect(zsk.GetRR().Flags).To(Equal(uint16(256)))
+				Expect(zsk.GetRole()).To(Equal(dnsutils.KeyRoleZSK))
+				Expect(signAndVerify(zsk, dns.TypeDNSKEY)).To(BeNil())
+				Expect(signAndVerify(zsk, dns.TypeA)).NotTo(BeNil())
+
+				csk, err := dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, alg, dnsutils.KeyRoleCSK, 3600, 0)
+				Expect(err).To(Succeed(), dns.AlgorithmToString[alg])
+				Expect(csk.GetRR().Flags).To(Equal(uint16(257)))
+				Expect(csk.IsCSK()).To(BeTrue())
+				Expect(csk.GetRole()).To(Equal(dnsutils.KeyRoleCSK))
+				Expect(signAndVerify(csk, dns.TypeDNSKEY)).NotTo(BeNil())
+				Expect(signAndVerify(csk, dns.TypeA)).NotTo(BeNil())
+			}
+		})
+		It("uses specified key size", func() {
+			key, err := dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, dns.RSASHA256, dnsutils.KeyRoleZSK, 3600, 1024)
+			Expect(err).To(Succeed())
+			Expect(signAndVerify(key, dns.TypeA)).NotTo(BeNil())
+		})
+		It("returns error for unsupported algorithm", func() {
+			_, err := dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, dns.RSASHA1, dnsutils.KeyRoleZSK, 3600, 0)
+			Expect(err).To(MatchError(dnsutils.ErrUnsupportedAlgorithm))
+		})
+		It("returns error for unknown role", func() {
+			_, err := dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, dns.ED25519, "HOGE", 3600, 0)
+			Expect(err).To(MatchError(dnsutils.ErrUnknownKeyRole))
+		})
+	})
+	Context("WriteKeyFiles", func() {
+		var dir string
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "keygen")
+			Expect(err).To(Succeed())
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+		It("writes key files which can be read by ReadDNSKEY", func() {
+			for _, alg := range algorithms {
+				key, err := dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, alg, dnsutils.KeyRoleKSK, 3600, 0)
+				Expect(err).To(Succeed())
+				pubPath, privPath, err := key.WriteKeyFiles(dir)
+				Expect(err).To(Succeed())
+				Expect(filepath.Base(pubPath)).To(MatchRegexp(`^Kexample\.jp\.\+%03d\+\d{5}\.key$`, alg))
+				Expect(pubPath).To(Equal(filepath.Join(dir, key.KeyFileBase()+".key")))
+				Expect(privPath).To(Equal(filepath.Join(dir, key.KeyFileBase()+".private")))
+				st, err := os.Stat(privPath)
+				Expect(err).To(Succeed())
+				Expect(st.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+				pub, err := os.ReadFile(pubPath)
+				Expect(err).To(Succeed())
+				priv, err := os.ReadFile(privPath)
+				Expect(err).To(Succeed())
+				read, err := dnsutils.ReadDNSKEY(bytes.NewBuffer(priv), bytes.NewBuffer(pub))
+				Expect(err).To(Succeed())
+				Expect(read.GetRR().String()).To(Equal(key.GetRR().String()))
+				rrsig := signAndVerify(read, dns.TypeDNSKEY)
+				Expect(rrsig.Verify(key.GetRR(), []dns.RR{key.GetRR()})).To(Succeed())
+			}
+		})
+		It("keeps role of key", func() {
+			for _, role := range []dnsutils.KeyRole{dnsutils.KeyRoleKSK, dnsutils.KeyRoleZSK, dnsutils.KeyRoleCSK} {
+				key, err := dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, dns.ED25519, role, 3600, 0)
+				Expect(err).To(Succeed())
+				pubPath, privPath, err := key.WriteKeyFiles(dir)
+				Expect(err).To(Succeed())
+				pub, err := os.ReadFile(pubPath)
+				Expect(err).To(Succeed())
+				priv, err := os.ReadFile(privPath)
+				Expect(err).To(Succeed())
+				Expect(string(priv)).To(HaveSuffix("\nRole: " + string(role) + "\n"))
+				read, err := dnsutils.ReadDNSKEY(bytes.NewBuffer(priv), bytes.NewBuffer(pub))
+				Expect(err).To(Succeed())
+				Expect(read.GetRole()).To(Equal(role))
+				Expect(read.IsCSK()).To(Equal(role == dnsutils.KeyRoleCSK))
+				Expect(signAndVerify(read, dns.TypeA) != nil).To(Equal(role != dnsutils.KeyRoleKSK))
+			}
+		})
+		It("returns error when dir does not exist", func() {
+			key, err := dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, dns.ED25519, dnsutils.KeyRoleZSK, 3600, 0)
+			Expect(err).To(Succeed())
+			_, _, err = key.WriteKeyFiles(filepath.Join(dir, "none"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
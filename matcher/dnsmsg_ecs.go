@@ -0,0 +1,40 @@
+package matcher
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	DNSMatcherECS MatcherName = "ECS"
+)
+
+func NewMatchDNSMsgECS(arg interface{}) (DnsMsgMatcher, error) {
+	t, err := GetIPNet(arg)
+	if err != nil {
+		return nil, err
+	}
+	return &matchDNSMsgECS{target: t}, nil
+}
+
+type matchDNSMsgECS struct {
+	target *net.IPNet
+}
+
+func (m *matchDNSMsgECS) Match(d *dns.Msg) bool {
+	opt := d.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, o := range opt.Option {
+		if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return m.target.Contains(ecs.Address)
+		}
+	}
+	return false
+}
+
+func init() {
+	RegisterDnsMsgMatcher(DNSMatcherECS, NewMatchDNSMsgECS, UnmarshalStringArg)
+}
@@ -0,0 +1,137 @@
+package matcher_test
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//go:embed testdata/dnsmsg_ecs_fail.json
+var matchDNSMsgECSFailData []byte
+
+//go:embed testdata/dnsmsg_ecs_success.json
+var matchDNSMsgECSValidData []byte
+
+var _ = Describe("ECS", func() {
+	Context("NewMatchDNSMsgECS", func() {
+		var (
+			m   matcher.DnsMsgMatcher
+			err error
+		)
+		When("arg is string", func() {
+			When("valid string", func() {
+				BeforeEach(func() {
+					m, err = matcher.NewMatchDNSMsgECS("192.168.0.0/24")
+				})
+				It("returns matcher", func() {
+					Expect(err).To(Succeed())
+					Expect(m).NotTo(BeNil())
+				})
+			})
+			When("invalid string", func() {
+				BeforeEach(func() {
+					m, err = matcher.NewMatchDNSMsgECS("192.168.0.1")
+				})
+				It("returns error", func() {
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
+		When("arg is invalid type", func() {
+			BeforeEach(func() {
+				m, err = matcher.NewMatchDNSMsgECS(true)
+			})
+			It("returns error", func() {
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+	Context("UnmarshalArg", func() {
+		var (
+			err error
+			mc  *matcher.MatcherConfig
+		)
+		BeforeEach(func() {
+			mc = &matcher.MatcherConfig{}
+		})
+		When("valid arg", func() {
+			BeforeEach(func() {
+				err = json.Unmarshal(matchDNSMsgECSValidData, mc)
+			})
+			It("not returns error", func() {
+				Expect(err).To(Succeed())
+				Expect(mc).To(Equal(&matcher.MatcherConfig{
+					Name: "ECS",
+					Type: matcher.MatcherTypeDnsMsg,
+					Arg:  "192.168.0.0/24",
+				}))
+			})
+		})
+		When("invalid arg", func() {
+			BeforeEach(func() {
+				err = json.Unmarshal(matchDNSMsgECSFailData, mc)
+			})
+			It("returns error", func() {
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+	Context("Match", func() {
+		var (
+			err error
+			m   matcher.DnsMsgMatcher
+			msg *dns.Msg
+		)
+		newECSMsg := func(addr string) *dns.Msg {
+			msg := &dns.Msg{}
+			msg.SetQuestion("example.jp.", dns.TypeA)
+			msg.SetEdns0(1232, false)
+			opt := msg.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+				Code:          dns.EDNS0SUBNET,
+				Family:        1,
+				SourceNetmask: 24,
+				Address:       net.ParseIP(addr),
+			})
+			return msg
+		}
+		BeforeEach(func() {
+			m, err = matcher.NewMatchDNSMsgECS("192.168.0.0/24")
+			Expect(err).To(Succeed())
+		})
+		When("msg has no EDNS0", func() {
+			BeforeEach(func() {
+				msg = &dns.Msg{}
+				msg.SetQuestion("example.jp.", dns.TypeA)
+			})
+			It("returns false", func() {
+				Expect(m.Match(msg)).To(BeFalse())
+			})
+		})
+		When("msg has no ECS", func() {
+			BeforeEach(func() {
+				msg = &dns.Msg{}
+				msg.SetQuestion("example.jp.", dns.TypeA)
+				msg.SetEdns0(1232, false)
+			})
+			It("returns false", func() {
+				Expect(m.Match(msg)).To(BeFalse())
+			})
+		})
+		When("ECS address is not in target", func() {
+			It("returns false", func() {
+				Expect(m.Match(newECSMsg("192.168.1.0"))).To(BeFalse())
+			})
+		})
+		When("ECS address is in target", func() {
+			It("returns true", func() {
+				Expect(m.Match(newECSMsg("192.168.0.0"))).To(BeTrue())
+			})
+		})
+	})
+})
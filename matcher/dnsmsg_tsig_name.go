@@ -0,0 +1,41 @@
+package matcher
+
+import (
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+const (
+	DNSMatcherTSIGName MatcherName = "TSIGName"
+)
+
+func NewMatchDNSMsgTSIGName(arg interface{}) (DnsMsgMatcher, error) {
+	name, ok := arg.(string)
+	if !ok {
+		return nil, errors.Errorf("invalid type args %v", arg)
+	}
+	name = dns.CanonicalName(name)
+	if _, ok := dns.IsDomainName(name); !ok {
+		return nil, errors.Errorf("invalid domain name %s", name)
+	}
+	return &matchDNSMsgTSIGName{target: name}, nil
+}
+
+type matchDNSMsgTSIGName struct {
+	target string
+}
+
+// Match checks only TSIG key name.
+// TSIG must be verified before matching, msg with unverified TSIG must not be given.
+// view.Views removes unverified TSIG before matching.
+func (m *matchDNSMsgTSIGName) Match(d *dns.Msg) bool {
+	tsig := d.IsTsig()
+	if tsig == nil {
+		return false
+	}
+	return dns.CanonicalName(tsig.Hdr.Name) == m.target
+}
+
+func init() {
+	RegisterDnsMsgMatcher(DNSMatcherTSIGName, NewMatchDNSMsgTSIGName, UnmarshalStringArg)
+}
@@ -0,0 +1,118 @@
+package matcher_test
+
+import (
+	_ "embed"
+	"encoding/json"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//go:embed testdata/dnsmsg_tsig_name_fail.json
+var matchDNSMsgTSIGNameFailData []byte
+
+//go:embed testdata/dnsmsg_tsig_name_success.json
+var matchDNSMsgTSIGNameValidData []byte
+
+var _ = Describe("TSIGName", func() {
+	Context("NewMatchDNSMsgTSIGName", func() {
+		var (
+			m   matcher.DnsMsgMatcher
+			err error
+		)
+		When("arg is string", func() {
+			When("valid domain name", func() {
+				BeforeEach(func() {
+					m, err = matcher.NewMatchDNSMsgTSIGName("key.example.jp")
+				})
+				It("returns matcher", func() {
+					Expect(err).To(Succeed())
+					Expect(m).NotTo(BeNil())
+				})
+			})
+			When("invalid domain name", func() {
+				BeforeEach(func() {
+					m, err = matcher.NewMatchDNSMsgTSIGName("..")
+				})
+				It("returns error", func() {
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
+		When("arg is invalid type", func() {
+			BeforeEach(func() {
+				m, err = matcher.NewMatchDNSMsgTSIGName(true)
+			})
+			It("returns error", func() {
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+	Context("UnmarshalArg", func() {
+		var (
+			err error
+			mc  *matcher.MatcherConfig
+		)
+		BeforeEach(func() {
+			mc = &matcher.MatcherConfig{}
+		})
+		When("valid arg", func() {
+			BeforeEach(func() {
+				err = json.Unmarshal(matchDNSMsgTSIGNameValidData, mc)
+			})
+			It("not returns error", func() {
+				Expect(err).To(Succeed())
+				Expect(mc).To(Equal(&matcher.MatcherConfig{
+					Name: "TSIGName",
+					Type: matcher.MatcherTypeDnsMsg,
+					Arg:  "key.example.jp.",
+				}))
+			})
+		})
+		When("invalid arg", func() {
+			BeforeEach(func() {
+				err = json.Unmarshal(matchDNSMsgTSIGNameFailData, mc)
+			})
+			It("returns error", func() {
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+	Context("Match", func() {
+		var (
+			err error
+			m   matcher.DnsMsgMatcher
+			msg *dns.Msg
+		)
+		BeforeEach(func() {
+			m, err = matcher.NewMatchDNSMsgTSIGName("Key.Example.JP")
+			Expect(err).To(Succeed())
+			msg = &dns.Msg{}
+			msg.SetQuestion("example.jp.", dns.TypeSOA)
+		})
+		When("msg has no TSIG", func() {
+			It("returns false", func() {
+				Expect(m.Match(msg)).To(BeFalse())
+			})
+		})
+		When("TSIG key name is different", func() {
+			BeforeEach(func() {
+				msg.SetTsig("other.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+			})
+			It("returns false", func() {
+				Expect(m.Match(msg)).To(BeFalse())
+			})
+		})
+		When("TSIG key name is same", func() {
+			BeforeEach(func() {
+				msg.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+			})
+			It("returns true", func() {
+				Expect(m.Match(msg)).To(BeTrue())
+			})
+		})
+	})
+})
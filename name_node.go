@@ -39,6 +39,7 @@ type NameNode struct {
 	class         dns.Class
 	rrsetValue    atomic.Value
 	childrenValue atomic.Value
+	parent        atomic.Pointer[NameNode]
 }
 
 // NewNameNode create NameNode
@@ -132,7 +133,13 @@ func (n *NameNode) SetValue(nn NameNodeInterface) error {
 	}
 	n.Lock()
 	defer n.Unlock()
-	n.childrenValue.Store(nn.CopyChildNodes())
+	children := nn.CopyChildNodes()
+	for _, child := range children {
+		if c, ok := child.(*NameNode); ok {
+			c.parent.Store(n)
+		}
+	}
+	n.childrenValue.Store(children)
 	n.rrsetValue.Store(nn.CopyRRSetMap())
 	return nil
 }
@@ -207,6 +214,9 @@ func (n *NameNode) AddChildNameNode(nn NameNodeInterface) error {
 	cMap := n.children()
 	cMap[nn.GetName()] = nn
 	n.childrenValue.Store(cMap)
+	if c, ok := nn.(*NameNode); ok {
+		c.parent.Store(n)
+	}
 	return nil
 }
 
@@ -219,13 +229,32 @@ func (n *NameNode) RemoveChildNameNode(name string) error {
 	if Equals(n.GetName(), name) {
 		return ErrRemoveItself
 	}
+	n.removeChild(name, nil)
+	return nil
+}
+
+// removeChild removes child node by name.
+// If target is not nil, child node is removed only when it is target and it is still empty.
+func (n *NameNode) removeChild(name string, target *NameNode) {
 	n.Lock()
-	defer n.Unlock()
+	if target != nil {
+		// lock order is parent then child.
+		// emptiness is re-checked under both locks, because rrset or child may be added after prune checked it.
+		target.Lock()
+		if target.RRSetLen() > 0 || len(target.children()) > 0 {
+			target.Unlock()
+			n.Unlock()
+			return
+		}
+	}
 	newChild := map[string]NameNodeInterface{}
 	var delete bool
 	for childName, child := range n.children() {
-		if Equals(child.GetName(), name) {
+		if Equals(child.GetName(), name) && (target == nil || child == target) {
 			delete = true
+			if c, ok := child.(*NameNode); ok {
+				c.parent.CompareAndSwap(n, nil)
+			}
 			continue
 		}
 		newChild[childName] = child
@@ -233,7 +262,13 @@ func (n *NameNode) RemoveChildNameNode(name string) error {
 	if delete {
 		n.childrenValue.Store(newChild)
 	}
-	return nil
+	if target != nil {
+		target.Unlock()
+	}
+	n.Unlock()
+	if delete {
+		n.prune()
+	}
 }
 
 // SetRRSet is implement of NameNodeInterface.SetRRSet
@@ -250,12 +285,12 @@ func (n *NameNode) SetRRSet(set RRSetInterface) error {
 	case dns.TypeNSEC, dns.TypeRRSIG:
 	default:
 		if !IsEmptyRRSet(rrsetMap[dns.TypeCNAME]) {
-			if n.RRSetLen() > 1 {
+			if dataRRSetLen(rrsetMap) > 1 {
 				return ErrConflictCNAME
 			}
 		}
 		if !IsEmptyRRSet(rrsetMap[dns.TypeDNAME]) {
-			if n.RRSetLen() > 1 {
+			if dataRRSetLen(rrsetMap) > 1 {
 				return ErrConflictDNAME
 			}
 		}
@@ -264,16 +299,41 @@ func (n *NameNode) SetRRSet(set RRSetInterface) error {
 	return nil
 }
 
+// dataRRSetLen returns number of not empty rrsets excluding NSEC and RRSIG.
+func dataRRSetLen(rrsetMap map[uint16]RRSetInterface) int {
+	i := 0
+	for rrtype, set := range rrsetMap {
+		if rrtype == dns.TypeNSEC || rrtype == dns.TypeRRSIG || IsEmptyRRSet(set) {
+			continue
+		}
+		i++
+	}
+	return i
+}
+
 // RemoveRRSet is implement of NameNodeInterface.RemoveRRSet
+// If node becomes empty non-terminal which has no children, node is removed from parent.
 func (n *NameNode) RemoveRRSet(rrtype uint16) error {
 	n.Lock()
-	defer n.Unlock()
 	rrsetMap := n.rrsetMap()
 	delete(rrsetMap, rrtype)
 	n.rrsetValue.Store(rrsetMap)
+	n.Unlock()
+	n.prune()
 	return nil
 }
 
+// prune removes the node from parent when node has no rrset and no children.
+// Parent node is also pruned recursively up to the node which has no parent (zone apex).
+func (n *NameNode) prune() {
+	if n.RRSetLen() > 0 || len(n.children()) > 0 {
+		return
+	}
+	if parent := n.parent.Load(); parent != nil {
+		parent.removeChild(n.GetName(), n)
+	}
+}
+
 // RRSetLen is implement of NameNodeInterface.RRSetLen
 func (n *NameNode) RRSetLen() int {
 	i := 0
@@ -294,6 +294,70 @@ var _ = Describe("NameNode", func() {
 			Expect(node.GetRRSet(dns.TypeA)).To(BeNil())
 		})
 	})
+	Context("Test for pruning empty non-terminal", func() {
+		When("node becomes empty and has children", func() {
+			BeforeEach(func() {
+				Expect(blue.RemoveRRSet(dns.TypeA)).To(Succeed())
+			})
+			It("is not removed", func() {
+				_, ok := root.GetNameNode("blue.www4.example.jp.")
+				Expect(ok).To(BeTrue())
+			})
+		})
+		When("child is removed and node becomes empty leaf", func() {
+			BeforeEach(func() {
+				Expect(alpha.RemoveChildNameNode("beta.alpha.blue.www4.example.jp.")).To(Succeed())
+			})
+			It("is removed from parent", func() {
+				_, ok := root.GetNameNode("alpha.blue.www4.example.jp.")
+				Expect(ok).To(BeFalse())
+				_, ok = root.GetNameNode("blue.www4.example.jp.")
+				Expect(ok).To(BeTrue())
+			})
+		})
+		When("last rrset is removed from leaf", func() {
+			BeforeEach(func() {
+				Expect(alpha.RemoveChildNameNode("beta.alpha.blue.www4.example.jp.")).To(Succeed())
+				Expect(blue.RemoveRRSet(dns.TypeA)).To(Succeed())
+			})
+			It("is removed up to the apex", func() {
+				_, ok := root.GetNameNode("blue.www4.example.jp.")
+				Expect(ok).To(BeFalse())
+				_, ok = root.GetNameNode("www4.example.jp.")
+				Expect(ok).To(BeFalse())
+				_, ok = root.GetNameNode("www1.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(root.RRSetLen()).To(Equal(2))
+			})
+		})
+		When("empty rrset is set into leaf", func() {
+			BeforeEach(func() {
+				Expect(alpha.RemoveChildNameNode("beta.alpha.blue.www4.example.jp.")).To(Succeed())
+				Expect(blue.SetRRSet(MustNewRRSet("blue.www4.example.jp.", 300, dns.ClassINET, dns.TypeA, nil))).To(Succeed())
+			})
+			It("is not removed, so that the node held by caller is still in tree", func() {
+				nn, ok := root.GetNameNode("blue.www4.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(nn).To(BeIdenticalTo(blue))
+				Expect(blue.SetRRSet(MustNewRRSet("blue.www4.example.jp.", 300, dns.ClassINET, dns.TypeA, []dns.RR{
+					MustNewRR("blue.www4.example.jp. 300 IN A 192.168.0.1"),
+				}))).To(Succeed())
+				nn, ok = root.GetNameNode("blue.www4.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(nn.GetRRSet(dns.TypeA).Len()).To(Equal(1))
+			})
+		})
+		When("all rrsets of apex are removed", func() {
+			BeforeEach(func() {
+				Expect(root.RemoveRRSet(dns.TypeA)).To(Succeed())
+				Expect(root.RemoveRRSet(dns.TypeAAAA)).To(Succeed())
+			})
+			It("apex is not removed", func() {
+				_, ok := root.GetNameNode("example.jp.")
+				Expect(ok).To(BeTrue())
+			})
+		})
+	})
 	Context("Test for RRSetLen", func() {
 		It("returns the number of not empty rrset", func() {
 			Expect(root.RRSetLen()).To(Equal(2))
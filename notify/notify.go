@@ -0,0 +1,282 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/tsig"
+)
+
+var (
+	DefaultRetry         = 3
+	DefaultRetryInterval = 2 * time.Second
+	DefaultTimeout       = 2 * time.Second
+
+	// ErrRcode returns when NOTIFY response rcode is not NOERROR.
+	ErrRcode = fmt.Errorf("NOTIFY response rcode is not NOERROR")
+	// ErrInvalidResponse returns when NOTIFY response is not valid.
+	ErrInvalidResponse = fmt.Errorf("invalid NOTIFY response")
+)
+
+// SendOption is option for Send.
+type SendOption struct {
+	// Client is used for sending NOTIFY. If nil, UDP client with DefaultTimeout is used.
+	Client *dns.Client
+	// Retry is number of retries after first attempt.
+	Retry *int
+	// RetryInterval is interval between attempts.
+	RetryInterval *time.Duration
+	// MsgHook is called with NOTIFY message before sending to each secondary. It can be used for TSIG.
+	MsgHook func(addr string, msg *dns.Msg)
+}
+
+func (o *SendOption) GetClient() *dns.Client {
+	if o.Client == nil {
+		return &dns.Client{Net: "udp", Timeout: DefaultTimeout}
+	}
+	return o.Client
+}
+
+func (o *SendOption) GetRetry() int {
+	if o.Retry == nil {
+		return DefaultRetry
+	}
+	return *o.Retry
+}
+
+func (o *SendOption) GetRetryInterval() time.Duration {
+	if o.RetryInterval == nil {
+		return DefaultRetryInterval
+	}
+	return *o.RetryInterval
+}
+
+// Result is the result of NOTIFY to a secondary.
+type Result struct {
+	// Addr is secondary address
+	Addr string
+	// Response is the last response. If no response received, it is nil.
+	Response *dns.Msg
+	// Attempts is number of sent NOTIFY messages.
+	Attempts int
+	// Err is nil when NOERROR response is received.
+	Err error
+}
+
+// NewNotifyMsg returns NOTIFY message for zone.
+// It has zone SOA in answer section (rfc1996#section-3.7).
+func NewNotifyMsg(z dnsutils.ZoneInterface) (*dns.Msg, error) {
+	soa, err := dnsutils.GetSOA(z)
+	if err != nil {
+		return nil, err
+	}
+	msg := &dns.Msg{}
+	msg.SetNotify(z.GetName())
+	msg.Question[0].Qclass = uint16(z.GetClass())
+	msg.Answer = []dns.RR{soa}
+	return msg, nil
+}
+
+// Send sends NOTIFY for zone to secondaries concurrently and returns results in order of addrs.
+// It retries until NOERROR response is received, other rcode is received or retry count is exceeded.
+func Send(ctx context.Context, z dnsutils.ZoneInterface, addrs []string, opt *SendOption) ([]*Result, error) {
+	if opt == nil {
+		opt = &SendOption{}
+	}
+	msg, err := NewNotifyMsg(z)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*Result, len(addrs))
+	wg := &sync.WaitGroup{}
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			results[i] = send(ctx, msg.Copy(), addr, opt)
+		}(i, addr)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func send(ctx context.Context, msg *dns.Msg, addr string, opt *SendOption) *Result {
+	res := &Result{Addr: addr}
+	c := opt.GetClient()
+	for i := 0; i <= opt.GetRetry(); i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				res.Err = ctx.Err()
+				return res
+			case <-time.After(opt.GetRetryInterval()):
+			}
+		}
+		msg.Id = dns.Id()
+		if opt.MsgHook != nil {
+			opt.MsgHook(addr, msg)
+		}
+		res.Attempts++
+		resp, _, err := c.ExchangeContext(ctx, msg, addr)
+		if err != nil {
+			res.Err = err
+			continue
+		}
+		res.Response = resp
+		res.Err = checkResponse(msg, resp)
+		return res
+	}
+	return res
+}
+
+func checkResponse(req, resp *dns.Msg) error {
+	if !resp.Response || resp.Opcode != dns.OpcodeNotify {
+		return ErrInvalidResponse
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("%w: %s", ErrRcode, dns.RcodeToString[resp.Rcode])
+	}
+	if len(resp.Question) > 0 && !dnsutils.Equals(resp.Question[0].Name, req.Question[0].Name) {
+		return ErrInvalidResponse
+	}
+	return nil
+}
+
+// ZoneGetter returns zone by name.
+// view.View implements it.
+type ZoneGetter interface {
+	GetZone(name string) (dnsutils.ZoneInterface, bool)
+}
+
+// ZoneGetterFunc is function implement of ZoneGetter.
+type ZoneGetterFunc func(name string) (dnsutils.ZoneInterface, bool)
+
+// GetZone calls f(name).
+func (f ZoneGetterFunc) GetZone(name string) (dnsutils.ZoneInterface, bool) {
+	return f(name)
+}
+
+// Notification is accepted NOTIFY.
+type Notification struct {
+	// Zone is the notified zone.
+	Zone dnsutils.ZoneInterface
+	// SOA is the SOA in answer section. If not exist, it is nil.
+	SOA *dns.SOA
+	// Remote is the address of sender.
+	Remote net.Addr
+}
+
+// IsNewer returns true when notified SOA serial is newer than zone, or SOA is not present.
+func (n *Notification) IsNewer() bool {
+	if n.SOA == nil {
+		return true
+	}
+	soa, err := dnsutils.GetSOA(n.Zone)
+	if err != nil {
+		return true
+	}
+	return dnsutils.CompareSerial(n.SOA.Serial, soa.Serial) > 0
+}
+
+// Receiver checks incoming NOTIFY messages.
+type Receiver struct {
+	// Allow is allowed sender networks. If empty, all senders are refused.
+	Allow []*net.IPNet
+	// Zones returns known zones.
+	Zones ZoneGetter
+	// RequireTSIG refuses NOTIFY without TSIG.
+	// NOTIFY with invalid TSIG is always rejected.
+	RequireTSIG bool
+	// KeyRing verifies TSIG of NOTIFY. If nil, NOTIFY with TSIG is rejected by BADKEY.
+	// The dns.Server should use the same key ring as TsigProvider.
+	KeyRing *tsig.KeyRing
+	// OnNotify is called by ServeDNS after response is written.
+	OnNotify func(*Notification)
+}
+
+func (r *Receiver) isAllowed(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+	for _, n := range r.Allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check checks NOTIFY request and returns response message.
+// If NOTIFY is accepted, it also returns Notification.
+//   - not NOTIFY opcode: NOTIMP
+//   - no question or QTYPE is not SOA: FORMERR
+//   - sender is not allowed: REFUSED
+//   - TSIG is required but request is not signed: REFUSED
+//   - TSIG is invalid: NOTAUTH with TSIG error (BADKEY, BADSIG or BADTIME), even if TSIG is not required
+//   - zone is unknown: NOTAUTH
+//
+// When TSIG is verified, response has TSIG RR.
+func (r *Receiver) Check(w dns.ResponseWriter, req *dns.Msg) (*dns.Msg, *Notification) {
+	res := &dns.Msg{}
+	if req.Opcode != dns.OpcodeNotify {
+		return res.SetRcode(req, dns.RcodeNotImplemented), nil
+	}
+	if len(req.Question) != 1 || req.Question[0].Qtype != dns.TypeSOA {
+		return res.SetRcodeFormatError(req), nil
+	}
+	if !r.isAllowed(w.RemoteAddr()) {
+		return res.SetRcode(req, dns.RcodeRefused), nil
+	}
+	if req.IsTsig() != nil {
+		if r.KeyRing == nil {
+			return tsig.NewErrorResponse(req, dns.RcodeNotAuth, dns.RcodeBadKey), nil
+		}
+		if rcode, tsigErr := r.KeyRing.CheckRequest(w, req); rcode != dns.RcodeSuccess {
+			return tsig.NewErrorResponse(req, rcode, tsigErr), nil
+		}
+	} else if r.RequireTSIG {
+		return res.SetRcode(req, dns.RcodeRefused), nil
+	}
+	var (
+		z  dnsutils.ZoneInterface
+		ok bool
+	)
+	if r.Zones != nil {
+		z, ok = r.Zones.GetZone(req.Question[0].Name)
+	}
+	if !ok || z.GetClass() != dns.Class(req.Question[0].Qclass) {
+		res.SetRcode(req, dns.RcodeNotAuth)
+		tsig.SetTSIG(res, req, dns.RcodeSuccess)
+		return res, nil
+	}
+	n := &Notification{Zone: z, Remote: w.RemoteAddr()}
+	for _, rr := range req.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && dnsutils.Equals(soa.Hdr.Name, z.GetName()) {
+			n.SOA = soa
+		}
+	}
+	res.SetReply(req)
+	res.Authoritative = true
+	tsig.SetTSIG(res, req, dns.RcodeSuccess)
+	return res, n
+}
+
+// ServeDNS is implement of dns.Handler.
+func (r *Receiver) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	res, n := r.Check(w, req)
+	w.WriteMsg(res)
+	if n != nil && r.OnNotify != nil {
+		r.OnNotify(n)
+	}
+}
@@ -0,0 +1,383 @@
+package notify_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/notify"
+	"github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/tsig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestNotify(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "notify Suite")
+}
+
+type countHandler struct {
+	mu    sync.Mutex
+	count int
+	drop  int
+	rcode int
+}
+
+func (h *countHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	h.mu.Lock()
+	h.count++
+	drop := h.count <= h.drop
+	h.mu.Unlock()
+	if drop {
+		return
+	}
+	res := &dns.Msg{}
+	res.SetRcode(r, h.rcode)
+	w.WriteMsg(res)
+}
+
+func startUDPServer(h dns.Handler) (*dns.Server, string) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).To(Succeed())
+	startCh := make(chan struct{})
+	svc := &dns.Server{PacketConn: pc, Net: "udp", Handler: h, NotifyStartedFunc: func() { close(startCh) }}
+	go svc.ActivateAndServe()
+	<-startCh
+	return svc, pc.LocalAddr().String()
+}
+
+var _ = Describe("notify", func() {
+	var (
+		z   *dnsutils.Zone
+		soa = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 10 3600 900 85400 300")
+	)
+	BeforeEach(func() {
+		var err error
+		z, err = dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+		Expect(err).To(Succeed())
+		Expect(z.GetRootNode().SetRRSet(dnsutils.NewRRSetFromRR(soa))).To(Succeed())
+	})
+	Context("NewNotifyMsg", func() {
+		It("returns NOTIFY message with SOA", func() {
+			msg, err := notify.NewNotifyMsg(z)
+			Expect(err).To(Succeed())
+			Expect(msg.Opcode).To(Equal(dns.OpcodeNotify))
+			Expect(msg.Authoritative).To(BeTrue())
+			Expect(msg.Question).To(Equal([]dns.Question{{Name: "example.jp.", Qtype: dns.TypeSOA, Qclass: dns.ClassINET}}))
+			Expect(msg.Answer).To(Equal([]dns.RR{soa}))
+		})
+		It("returns error when zone has no SOA", func() {
+			z, _ := dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+			_, err := notify.NewNotifyMsg(z)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("Send", func() {
+		var (
+			svcs     []*dns.Server
+			handlers []*countHandler
+			addrs    []string
+			opt      *notify.SendOption
+			results  []*notify.Result
+			err      error
+		)
+		BeforeEach(func() {
+			svcs, handlers, addrs = nil, nil, nil
+			for _, h := range []*countHandler{{rcode: dns.RcodeSuccess}, {rcode: dns.RcodeSuccess, drop: 1}, {rcode: dns.RcodeRefused}} {
+				svc, addr := startUDPServer(h)
+				svcs = append(svcs, svc)
+				handlers = append(handlers, h)
+				addrs = append(addrs, addr)
+			}
+			retry := 2
+			interval := 10 * time.Millisecond
+			opt = &notify.SendOption{
+				Client:        &dns.Client{Net: "udp", Timeout: 200 * time.Millisecond},
+				Retry:         &retry,
+				RetryInterval: &interval,
+			}
+		})
+		AfterEach(func() {
+			for _, svc := range svcs {
+				svc.Shutdown()
+			}
+		})
+		When("secondaries respond", func() {
+			BeforeEach(func() {
+				results, err = notify.Send(context.Background(), z, addrs, opt)
+			})
+			It("returns results in order", func() {
+				Expect(err).To(Succeed())
+				Expect(results).To(HaveLen(3))
+				for i, res := range results {
+					Expect(res.Addr).To(Equal(addrs[i]))
+				}
+			})
+			It("succeeds with NOERROR", func() {
+				Expect(results[0].Err).To(Succeed())
+				Expect(results[0].Attempts).To(Equal(1))
+				Expect(results[0].Response.Rcode).To(Equal(dns.RcodeSuccess))
+			})
+			It("retries on timeout", func() {
+				Expect(results[1].Err).To(Succeed())
+				Expect(results[1].Attempts).To(Equal(2))
+			})
+			It("does not retry on error rcode", func() {
+				Expect(results[2].Err).To(MatchError(notify.ErrRcode))
+				Expect(results[2].Attempts).To(Equal(1))
+			})
+		})
+		When("secondary does not respond", func() {
+			BeforeEach(func() {
+				handlers[0].mu.Lock()
+				handlers[0].drop = 10
+				handlers[0].mu.Unlock()
+				results, err = notify.Send(context.Background(), z, addrs[:1], opt)
+			})
+			It("returns error after retries", func() {
+				Expect(err).To(Succeed())
+				Expect(results[0].Err).To(HaveOccurred())
+				Expect(results[0].Attempts).To(Equal(3))
+				Expect(results[0].Response).To(BeNil())
+			})
+		})
+		When("zone has no SOA", func() {
+			BeforeEach(func() {
+				z, _ = dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+				_, err = notify.Send(context.Background(), z, addrs, opt)
+			})
+			It("returns error", func() {
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+	Context("Receiver", func() {
+		var (
+			r        *notify.Receiver
+			w        *testtool.ResponseWriter
+			req      *dns.Msg
+			res      *dns.Msg
+			n        *notify.Notification
+			kr       *tsig.KeyRing
+			newerSOA = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 11 3600 900 85400 300")
+		)
+		BeforeEach(func() {
+			_, allow, _ := net.ParseCIDR("10.0.0.0/8")
+			r = &notify.Receiver{
+				Allow: []*net.IPNet{allow},
+				Zones: notify.ZoneGetterFunc(func(name string) (dnsutils.ZoneInterface, bool) {
+					if dnsutils.Equals(name, "example.jp.") {
+						return z, true
+					}
+					return nil, false
+				}),
+			}
+			var err error
+			kr, err = tsig.NewKeyRing(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})
+			Expect(err).To(Succeed())
+			w = &testtool.ResponseWriter{}
+			req = &dns.Msg{}
+			req.SetNotify("example.jp.")
+			req.Answer = []dns.RR{newerSOA}
+		})
+		When("valid NOTIFY", func() {
+			BeforeEach(func() {
+				res, n = r.Check(w, req)
+			})
+			It("returns NOERROR with AA", func() {
+				Expect(res.Rcode).To(Equal(dns.RcodeSuccess))
+				Expect(res.Authoritative).To(BeTrue())
+				Expect(res.Opcode).To(Equal(dns.OpcodeNotify))
+				Expect(n).NotTo(BeNil())
+				Expect(n.Zone).To(Equal(z))
+				Expect(n.SOA).To(Equal(newerSOA))
+				Expect(n.IsNewer()).To(BeTrue())
+			})
+		})
+		When("SOA is not newer", func() {
+			BeforeEach(func() {
+				req.Answer = []dns.RR{soa}
+				_, n = r.Check(w, req)
+			})
+			It("IsNewer returns false", func() {
+				Expect(n.IsNewer()).To(BeFalse())
+			})
+		})
+		When("opcode is not NOTIFY", func() {
+			BeforeEach(func() {
+				req.Opcode = dns.OpcodeQuery
+				res, n = r.Check(w, req)
+			})
+			It("returns NOTIMP", func() {
+				Expect(res.Rcode).To(Equal(dns.RcodeNotImplemented))
+				Expect(n).To(BeNil())
+			})
+		})
+		When("qtype is not SOA", func() {
+			BeforeEach(func() {
+				req.Question[0].Qtype = dns.TypeA
+				res, n = r.Check(w, req)
+			})
+			It("returns FORMERR", func() {
+				Expect(res.Rcode).To(Equal(dns.RcodeFormatError))
+				Expect(n).To(BeNil())
+			})
+		})
+		When("sender is not allowed", func() {
+			BeforeEach(func() {
+				w.RemoteAddress = &net.UDPAddr{IP: net.ParseIP("192.168.0.1"), Port: 53}
+				res, n = r.Check(w, req)
+			})
+			It("returns REFUSED", func() {
+				Expect(res.Rcode).To(Equal(dns.RcodeRefused))
+				Expect(n).To(BeNil())
+			})
+		})
+		When("TSIG is required but not signed", func() {
+			BeforeEach(func() {
+				r.RequireTSIG = true
+				res, n = r.Check(w, req)
+			})
+			It("returns REFUSED", func() {
+				Expect(res.Rcode).To(Equal(dns.RcodeRefused))
+				Expect(n).To(BeNil())
+			})
+		})
+		When("TSIG is valid", func() {
+			BeforeEach(func() {
+				r.KeyRing = kr
+				req.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+				res, n = r.Check(w, testtool.MustSignMsg(req, kr))
+			})
+			It("returns signed NOERROR", func() {
+				Expect(res.Rcode).To(Equal(dns.RcodeSuccess))
+				Expect(res.IsTsig()).NotTo(BeNil())
+				Expect(res.IsTsig().Error).To(Equal(uint16(dns.RcodeSuccess)))
+				Expect(n).NotTo(BeNil())
+			})
+		})
+		When("key ring is not set", func() {
+			BeforeEach(func() {
+				req.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+				res, n = r.Check(w, testtool.MustSignMsg(req, kr))
+			})
+			It("returns NOTAUTH with BADKEY", func() {
+				Expect(res.Rcode).To(Equal(dns.RcodeNotAuth))
+				Expect(res.IsTsig().Error).To(Equal(uint16(dns.RcodeBadKey)))
+				Expect(n).To(BeNil())
+			})
+		})
+		When("TSIG is invalid", func() {
+			BeforeEach(func() {
+				r.KeyRing = kr
+				req.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+				w.ErrTsigStatus = dns.ErrSig
+			})
+			It("returns NOTAUTH with BADSIG even if TSIG is not required", func() {
+				res, n = r.Check(w, req)
+				Expect(res.Rcode).To(Equal(dns.RcodeNotAuth))
+				Expect(res.IsTsig()).NotTo(BeNil())
+				Expect(res.IsTsig().Error).To(Equal(uint16(dns.RcodeBadSig)))
+				Expect(n).To(BeNil())
+			})
+			It("returns NOTAUTH with BADTIME", func() {
+				r.RequireTSIG = true
+				w.ErrTsigStatus = dns.ErrTime
+				res, n = r.Check(w, req)
+				Expect(res.Rcode).To(Equal(dns.RcodeNotAuth))
+				Expect(res.IsTsig().Error).To(Equal(uint16(dns.RcodeBadTime)))
+				Expect(n).To(BeNil())
+			})
+			It("does not call OnNotify", func() {
+				called := false
+				r.OnNotify = func(*notify.Notification) { called = true }
+				r.ServeDNS(w, req)
+				Expect(called).To(BeFalse())
+			})
+		})
+		When("zone is unknown", func() {
+			BeforeEach(func() {
+				req.SetNotify("example.com.")
+				res, n = r.Check(w, req)
+			})
+			It("returns NOTAUTH", func() {
+				Expect(res.Rcode).To(Equal(dns.RcodeNotAuth))
+				Expect(n).To(BeNil())
+			})
+		})
+		When("receives NOTIFY by Send", func() {
+			var (
+				svc     *dns.Server
+				addr    string
+				ch      chan *notify.Notification
+				results []*notify.Result
+			)
+			BeforeEach(func() {
+				_, allow, _ := net.ParseCIDR("127.0.0.0/8")
+				r.Allow = []*net.IPNet{allow}
+				ch = make(chan *notify.Notification, 1)
+				r.OnNotify = func(n *notify.Notification) { ch <- n }
+				svc, addr = startUDPServer(r)
+				var err error
+				results, err = notify.Send(context.Background(), z, []string{addr}, nil)
+				Expect(err).To(Succeed())
+			})
+			AfterEach(func() {
+				svc.Shutdown()
+			})
+			It("calls OnNotify", func() {
+				Expect(results[0].Err).To(Succeed())
+				Eventually(ch).Should(Receive(&n))
+				Expect(n.SOA.Serial).To(Equal(uint32(10)))
+			})
+		})
+		When("server has no TsigProvider", func() {
+			var (
+				svc  *dns.Server
+				addr string
+				ch   chan *notify.Notification
+				opt  *notify.SendOption
+			)
+			BeforeEach(func() {
+				_, allow, _ := net.ParseCIDR("127.0.0.0/8")
+				r.Allow = []*net.IPNet{allow}
+				r.KeyRing = kr
+				ch = make(chan *notify.Notification, 1)
+				r.OnNotify = func(n *notify.Notification) { ch <- n }
+				svc, addr = startUDPServer(r)
+				retry := 0
+				opt = &notify.SendOption{
+					Retry: &retry,
+					MsgHook: func(_ string, msg *dns.Msg) {
+						msg.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+					},
+				}
+			})
+			AfterEach(func() {
+				svc.Shutdown()
+			})
+			It("rejects forged TSIG", func() {
+				forged, err := tsig.NewKeyRing(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "Zm9yZ2Vk"})
+				Expect(err).To(Succeed())
+				opt.Client = &dns.Client{Net: "udp", Timeout: time.Second, TsigProvider: forged}
+				results, err := notify.Send(context.Background(), z, []string{addr}, opt)
+				Expect(err).To(Succeed())
+				Expect(results[0].Err).To(HaveOccurred())
+				Consistently(ch, 100*time.Millisecond).ShouldNot(Receive())
+			})
+			It("accepts valid TSIG", func() {
+				opt.Client = &dns.Client{Net: "udp", Timeout: time.Second, TsigProvider: kr}
+				results, err := notify.Send(context.Background(), z, []string{addr}, opt)
+				Expect(err).To(Succeed())
+				// response is not signed by the server without TsigProvider.
+				Expect(results[0].Err).To(HaveOccurred())
+				Eventually(ch).Should(Receive(&n))
+			})
+		})
+	})
+})
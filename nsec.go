@@ -23,19 +23,41 @@ func CreateDoE(z ZoneInterface, opt SignOption, generator Generator) error {
 }
 
 func createNSEC(z ZoneInterface, generator RRSetGenerator) error {
-	var nodes = map[string]NameNodeInterface{}
-	var names []string
 	if generator == nil {
 		generator = &DefaultGenerator{}
 	}
+	nsecs, err := nsecRRs(z)
+	if err != nil {
+		return err
+	}
+	for _, nsec := range nsecs {
+		nni, ok := z.GetRootNode().GetNameNode(nsec.Hdr.Name)
+		if !ok {
+			return ErrBadZone
+		}
+		set, err := NewRRSetFromRRWithGenerator(nsec, generator)
+		if err != nil {
+			return err
+		}
+		if err := nni.SetRRSet(set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nsecRRs returns NSEC RRs of zone in canonical order.
+func nsecRRs(z ZoneInterface) ([]*dns.NSEC, error) {
+	var nodes = map[string]NameNodeInterface{}
+	var names []string
 	soa, err := GetSOA(z)
 	if err != nil {
-		return ErrBadZone
+		return nil, ErrBadZone
 	}
 
 	zoneCuts, _, err := GetZoneCuts(z.GetRootNode())
 	if err != nil {
-		return ErrBadZone
+		return nil, ErrBadZone
 	}
 
 	// get next domain names
@@ -57,6 +79,7 @@ func createNSEC(z ZoneInterface, generator RRSetGenerator) error {
 	})
 
 	SortNames(names)
+	var nsecs []*dns.NSEC
 	for i, name := range names {
 		nsec := &dns.NSEC{
 			Hdr: dns.RR_Header{
@@ -84,19 +107,9 @@ func createNSEC(z ZoneInterface, generator RRSetGenerator) error {
 			}
 		}
 		sort.SliceStable(nsec.TypeBitMap, func(i, j int) bool { return nsec.TypeBitMap[i] < nsec.TypeBitMap[j] })
-
-		set, err := generator.NewRRSet(name, soa.Minttl, dns.ClassINET, dns.TypeNSEC)
-		if err != nil {
-			return err
-		}
-		if err := set.AddRR(nsec); err != nil {
-			return err
-		}
-		if err := nodes[name].SetRRSet(set); err != nil {
-			return err
-		}
+		nsecs = append(nsecs, nsec)
 	}
-	return nil
+	return nsecs, nil
 }
 
 var (
@@ -104,19 +117,35 @@ var (
 )
 
 func createNSEC3(z ZoneInterface, opt SignOption, generator Generator) error {
-	var nodes = map[string]NameNodeInterface{}
-	var hashCheckName = map[string]struct{}{}
-	var names []string
-	soa, err := GetSOA(z)
+	nsec3param, err := nsec3ParamRR(z, opt)
 	if err != nil {
-		return ErrBadZone
+		return err
+	}
+	nsec3ParamRRRet, err := NewRRSetFromRRWithGenerator(nsec3param, generator)
+	if err != nil {
+		return fmt.Errorf("failed to create nsec3param")
 	}
+	if err := z.GetRootNode().SetRRSet(nsec3ParamRRRet); err != nil {
+		return fmt.Errorf("failed to set nsec3param")
+	}
+	nsec3s, err := nsec3RRs(z, opt)
+	if err != nil {
+		return err
+	}
+	for _, nsec3 := range nsec3s {
+		if err := CreateOrReplaceRRSetFromRRs(z.GetRootNode(), []dns.RR{nsec3}, generator); err != nil {
+			return fmt.Errorf("failed to create NSEC3 %s: %w", nsec3.Header().Name, err)
+		}
+	}
+	return nil
+}
 
-	zoneCuts, _, err := GetZoneCuts(z.GetRootNode())
+func nsec3ParamRR(z ZoneInterface, opt SignOption) (*dns.NSEC3PARAM, error) {
+	soa, err := GetSOA(z)
 	if err != nil {
-		return ErrBadZone
+		return nil, ErrBadZone
 	}
-	nsec3param := &dns.NSEC3PARAM{
+	return &dns.NSEC3PARAM{
 		Hdr: dns.RR_Header{
 			Name:   soa.Hdr.Name,
 			Rrtype: dns.TypeNSEC3PARAM,
@@ -126,18 +155,31 @@ func createNSEC3(z ZoneInterface, opt SignOption, generator Generator) error {
 		Hash:       dns.SHA1,
 		Iterations: opt.GetNSEC3Iterate(),
 		Salt:       opt.GetNSEC3Salt(),
-	}
+	}, nil
+}
 
-	nsec3ParamRRRet, err := NewRRSetFromRRWithGenerator(nsec3param, generator)
+// nsec3RRs returns NSEC3 RRs of zone in hash order.
+// NSEC3PARAM must be set to zone apex before.
+func nsec3RRs(z ZoneInterface, opt SignOption) ([]*dns.NSEC3, error) {
+	var nodes = map[string]NameNodeInterface{}
+	var hashCheckName = map[string]struct{}{}
+	var names []string
+	soa, err := GetSOA(z)
 	if err != nil {
-		return fmt.Errorf("failed to create nsec3param")
+		return nil, ErrBadZone
 	}
-	if err := z.GetRootNode().SetRRSet(nsec3ParamRRRet); err != nil {
-		return fmt.Errorf("failed to set nsec3param")
+
+	zoneCuts, _, err := GetZoneCuts(z.GetRootNode())
+	if err != nil {
+		return nil, ErrBadZone
 	}
 
 	// get next domain names
 	err = z.GetRootNode().IterateNameNode(func(nni NameNodeInterface) error {
+		// owner names of existing NSEC3 RRs are not hashed
+		if !IsEmptyRRSet(nni.GetRRSet(dns.TypeNSEC3)) {
+			return nil
+		}
 		parent, static := zoneCuts.GetNameNode(nni.GetName())
 		if parent.GetName() != z.GetName() {
 			if !static && parent.GetRRSet(dns.TypeNS) != nil {
@@ -146,16 +188,20 @@ func createNSEC3(z ZoneInterface, opt SignOption, generator Generator) error {
 		}
 		nodes[nni.GetName()] = nni
 		names = append(names, nni.GetName())
-
-		hashCheckName[nni.GetName()] = struct{}{}
-		labels := dns.SplitDomainName(nni.GetName())
-		if len(labels) > 0 && labels[0] != "*" {
-			hashCheckName["*."+nni.GetName()] = struct{}{}
-		}
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create name list: %w", err)
+		return nil, fmt.Errorf("failed to create name list: %w", err)
+	}
+	if opt.GetNSEC3OptOut() {
+		names = optOutNames(z, nodes, names)
+	}
+	for _, name := range names {
+		hashCheckName[name] = struct{}{}
+		labels := dns.SplitDomainName(name)
+		if len(labels) > 0 && labels[0] != "*" {
+			hashCheckName["*."+name] = struct{}{}
+		}
 	}
 
 	// collision check and make hash owner name
@@ -165,7 +211,7 @@ func createNSEC3(z ZoneInterface, opt SignOption, generator Generator) error {
 		hashName := dns.HashName(name, dns.SHA1, opt.GetNSEC3Iterate(), opt.GetNSEC3Salt())
 		hashMap[name] = hashName
 		if _, exist := hashCheck[hashName]; exist {
-			return errors.Join(ErrCollision, fmt.Errorf("collision %s %s", hashCheck[hashName], name))
+			return nil, errors.Join(ErrCollision, fmt.Errorf("collision %s %s", hashCheck[hashName], name))
 		} else {
 			hashCheck[hashName] = name
 		}
@@ -174,6 +220,7 @@ func createNSEC3(z ZoneInterface, opt SignOption, generator Generator) error {
 		cmp, _ := CompareName(hashMap[names[i]], hashMap[names[j]])
 		return cmp < 0
 	})
+	var nsec3s []*dns.NSEC3
 	for i, name := range names {
 		nsec3 := &dns.NSEC3{
 			Hdr: dns.RR_Header{
@@ -190,6 +237,9 @@ func createNSEC3(z ZoneInterface, opt SignOption, generator Generator) error {
 			SaltLength: uint8(len(opt.GetNSEC3Salt()) / 2),
 			HashLength: 20, // SHA-1
 		}
+		if opt.GetNSEC3OptOut() {
+			nsec3.Flags = 1
+		}
 		if i+1 < len(names) {
 			nsec3.NextDomain = strings.ToLower(hashMap[names[i+1]])
 		} else {
@@ -220,10 +270,24 @@ func createNSEC3(z ZoneInterface, opt SignOption, generator Generator) error {
 		}
 
 		sort.SliceStable(nsec3.TypeBitMap, func(i, j int) bool { return nsec3.TypeBitMap[i] < nsec3.TypeBitMap[j] })
+		nsec3s = append(nsec3s, nsec3)
+	}
+	return nsec3s, nil
+}
 
-		if err := CreateOrReplaceRRSetFromRRs(z.GetRootNode(), []dns.RR{nsec3}, generator); err != nil {
-			return fmt.Errorf("failed to create NSEC3 %s cover %s : %w", nsec3.Header().Name, name, err)
+// optOutNames returns names which need NSEC3 RR with opt-out.
+// Insecure delegations are left out, and so are ENTs which only exist above them.
+func optOutNames(z ZoneInterface, nodes map[string]NameNodeInterface, names []string) []string {
+	var nnis []NameNodeInterface
+	for _, name := range names {
+		nnis = append(nnis, nodes[name])
+	}
+	required := optOutRequiredNames(z.GetName(), nnis)
+	var res []string
+	for _, name := range names {
+		if _, ok := required[dns.CanonicalName(name)]; ok || name == z.GetName() {
+			res = append(res, name)
 		}
 	}
-	return nil
+	return res
 }
@@ -3,6 +3,7 @@ package dnsutils_test
 import (
 	"bytes"
 	_ "embed"
+	"strings"
 
 	"github.com/miekg/dns"
 	"github.com/mimuret/dnsutils"
@@ -144,6 +145,60 @@ var _ = Describe("Test nsec.go", func() {
 					Expect(dnsutils.IsEqualsAllTree(z.GetRootNode(), nsec3SignedZone.GetRootNode(), false)).To(BeTrue())
 				})
 			})
+			Context("with opt-out", func() {
+				var opt dnsutils.SignOption
+				hasNSEC3 := func(name string) bool {
+					hash := strings.ToLower(dns.HashName(name, dns.SHA1, 0, ""))
+					nni, ok := z.GetRootNode().GetNameNode(hash + ".example.jp.")
+					return ok && nni.GetRRSet(dns.TypeNSEC3) != nil
+				}
+				BeforeEach(func() {
+					delegations := strings.Join([]string{
+						"a.ent.example.jp. 3600 IN NS ns.example.com.",
+						"b.ent2.example.jp. 3600 IN NS ns.example.com.",
+						"c.ent2.example.jp. 3600 IN NS ns.example.com.",
+						"c.ent2.example.jp. 3600 IN DS 1 8 2 41AD6EC23454A202D05BD75D9C323825C9822B9850CB1793CAB2DA2814C74140",
+					}, "\n")
+					z = &dnsutils.Zone{}
+					err = z.Read(strings.NewReader(string(testSignZone) + "\n" + delegations + "\n"))
+					Expect(err).To(Succeed())
+					opt = nsec3SignOption
+					opt.NSEC3OptOut = true
+				})
+				It("leaves out insecure delegations", func() {
+					Expect(dnsutils.CreateDoE(z, opt, nil)).To(Succeed())
+					var nsec3RRs []*dns.NSEC3
+					z.GetRootNode().IterateNameNode(func(nni dnsutils.NameNodeInterface) error {
+						rrs, err := dnsutils.GetTyped[*dns.NSEC3](nni, dns.TypeNSEC3)
+						Expect(err).To(Succeed())
+						nsec3RRs = append(nsec3RRs, rrs...)
+						return nil
+					})
+					// example.jp. \000 * hoge test.hoge www.hoge sub1 ent2 c.ent2
+					Expect(nsec3RRs).To(HaveLen(9))
+					for _, nsec3 := range nsec3RRs {
+						Expect(nsec3.Flags).To(Equal(uint8(1)))
+					}
+					Expect(hasNSEC3("sub1.example.jp.")).To(BeTrue())
+					Expect(hasNSEC3("hoge.example.jp.")).To(BeTrue())
+					Expect(hasNSEC3("ent2.example.jp.")).To(BeTrue())
+					Expect(hasNSEC3("c.ent2.example.jp.")).To(BeTrue())
+					Expect(hasNSEC3("sub2.example.jp.")).To(BeFalse())
+					Expect(hasNSEC3("ent.example.jp.")).To(BeFalse())
+					Expect(hasNSEC3("a.ent.example.jp.")).To(BeFalse())
+					Expect(hasNSEC3("b.ent2.example.jp.")).To(BeFalse())
+					param, err := dnsutils.GetFirstTyped[*dns.NSEC3PARAM](z.GetRootNode(), dns.TypeNSEC3PARAM)
+					Expect(err).To(Succeed())
+					Expect(param.Flags).To(Equal(uint8(0)))
+				})
+				It("can be verified", func() {
+					Expect(dnsutils.Sign(z, opt, dnskeys, nil)).To(Succeed())
+					report, err := dnsutils.VerifyZone(z, nil)
+					Expect(err).To(Succeed())
+					Expect(report.Err()).To(Succeed())
+					Expect(report.InsecureDelegations).To(ConsistOf("a.ent.example.jp.", "b.ent2.example.jp.", "sub2.example.jp."))
+				})
+			})
 		})
 	})
 })
@@ -0,0 +1,280 @@
+package dnsutils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Resign re-signs zone after changes incrementally.
+// old is the name node tree before changes, and z keeps signatures copied from old.
+// Only rrsets which are different from old are signed, and NSEC or NSEC3 RRs are replaced
+// only when their chain links or type bitmaps are changed.
+// RRSIGs of unchanged rrsets are kept without verification unless they are made by a key not in dnskeys
+// or expire within the refresh window (SignOption.Refresh).
+// If ZONEMD is enabled, it is updated and signed.
+func Resign(z ZoneInterface, old NameNodeInterface, opt SignOption, dnskeys []*DNSKEY, generator Generator) error {
+	if generator == nil {
+		generator = &DefaultGenerator{}
+	}
+	if len(dnskeys) == 0 {
+		return fmt.Errorf("empty DNSKEYs")
+	}
+	if err := removeStaleSignature(z, opt); err != nil {
+		return fmt.Errorf("failed to remove signatures: %w", err)
+	}
+	if opt.GetZONEMDEnabled() {
+		if err := AddZONEMDPlaceholder(z, nil, generator); err != nil {
+			return fmt.Errorf("failed to add ZONEMD: %w", err)
+		}
+	}
+	if err := patchDoE(z, opt, generator); err != nil {
+		return fmt.Errorf("failed to update NSEC or NSEC3: %w", err)
+	}
+	type target struct {
+		nni        NameNodeInterface
+		apex, auth bool
+	}
+	// RRSIGs are updated after walking, because name node which loses all rrsets is pruned.
+	var targets []target
+	err := z.GetRootNode().IterateNameNodeWithValue(func(nni NameNodeInterface, a any) (any, error) {
+		auth := a.(bool)
+		apex := nni == z.GetRootNode()
+		if !apex && nni.GetRRSet(dns.TypeNS) != nil {
+			targets = append(targets, target{nni: nni, auth: true})
+			return false, nil
+		}
+		targets = append(targets, target{nni: nni, apex: apex, auth: auth})
+		return auth, nil
+	}, true)
+	if err != nil {
+		return fmt.Errorf("failed to get name nodes: %w", err)
+	}
+	now := time.Now()
+	for _, t := range targets {
+		if err := resignNode(t.nni, old, opt, dnskeys, generator, now, t.apex, t.auth); err != nil {
+			return fmt.Errorf("failed to sign %s: %w", t.nni.GetName(), err)
+		}
+	}
+	if opt.GetZONEMDEnabled() {
+		if err := UpdateZONEMDDigest(z, generator); err != nil {
+			return fmt.Errorf("failed to update ZONEMD digest: %w", err)
+		}
+		apex := z.GetRootNode()
+		rrsigs, err := refreshRRSIGs(apex.GetRRSet(dns.TypeZONEMD), nil, opt, dnskeys, now, &SignResult{}, false)
+		if err != nil {
+			return fmt.Errorf("failed to sign ZONEMD: %w", err)
+		}
+		if err := setRRSIGs(apex, rrsigs, generator); err != nil {
+			return fmt.Errorf("failed to sign ZONEMD: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeStaleSignature removes RRSIG and NSEC rrsets of name nodes which have no other rrsets,
+// and NSEC or NSEC3 rrsets which are not used by opt.DoEMethod.
+func removeStaleSignature(z ZoneInterface, opt SignOption) error {
+	unused := dns.TypeNSEC3
+	if opt.DoEMethod == DenialOfExistenceMethodNSEC3 {
+		unused = dns.TypeNSEC
+	}
+	var nodes []NameNodeInterface
+	z.GetRootNode().IterateNameNode(func(nni NameNodeInterface) error {
+		nodes = append(nodes, nni)
+		return nil
+	})
+	for _, nni := range nodes {
+		if nni.GetRRSet(unused) != nil {
+			if err := nni.RemoveRRSet(unused); err != nil {
+				return err
+			}
+		}
+		if hasDataRRSet(nni) || !IsEmptyRRSet(nni.GetRRSet(dns.TypeNSEC3)) {
+			continue
+		}
+		for _, rrtype := range []uint16{dns.TypeRRSIG, dns.TypeNSEC} {
+			if nni.GetRRSet(rrtype) == nil {
+				continue
+			}
+			if err := nni.RemoveRRSet(rrtype); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasDataRRSet returns true if name node has rrsets other than RRSIG, NSEC and NSEC3.
+func hasDataRRSet(nni NameNodeInterface) bool {
+	for rrtype, set := range nni.CopyRRSetMap() {
+		switch rrtype {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+		default:
+			if !IsEmptyRRSet(set) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// patchDoE updates NSEC or NSEC3 RRs which are different from the chain of current zone,
+// and removes NSEC or NSEC3 RRs which are out of the chain.
+func patchDoE(z ZoneInterface, opt SignOption, generator Generator) error {
+	var rrs []dns.RR
+	switch opt.DoEMethod {
+	case DenialOfExistenceMethodNSEC, "":
+		nsecs, err := nsecRRs(z)
+		if err != nil {
+			return err
+		}
+		for _, nsec := range nsecs {
+			rrs = append(rrs, nsec)
+		}
+	case DenialOfExistenceMethodNSEC3:
+		nsec3param, err := nsec3ParamRR(z, opt)
+		if err != nil {
+			return err
+		}
+		if err := patchRR(z, nsec3param, generator); err != nil {
+			return fmt.Errorf("failed to set nsec3param: %w", err)
+		}
+		nsec3s, err := nsec3RRs(z, opt)
+		if err != nil {
+			return err
+		}
+		for _, nsec3 := range nsec3s {
+			rrs = append(rrs, nsec3)
+		}
+	default:
+		return fmt.Errorf("not support: %s", opt.DoEMethod)
+	}
+	rrtype := dns.TypeNSEC
+	if opt.DoEMethod == DenialOfExistenceMethodNSEC3 {
+		rrtype = dns.TypeNSEC3
+	}
+	chain := map[string]struct{}{}
+	for _, rr := range rrs {
+		chain[dns.CanonicalName(rr.Header().Name)] = struct{}{}
+		if err := patchRR(z, rr, generator); err != nil {
+			return fmt.Errorf("failed to set %s: %w", rr.Header().Name, err)
+		}
+	}
+	var outs []NameNodeInterface
+	z.GetRootNode().IterateNameNode(func(nni NameNodeInterface) error {
+		if _, ok := chain[dns.CanonicalName(nni.GetName())]; !ok && nni.GetRRSet(rrtype) != nil {
+			outs = append(outs, nni)
+		}
+		return nil
+	})
+	for _, nni := range outs {
+		if err := nni.RemoveRRSet(rrtype); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchRR replaces rrset by rr if the rrset is different from rr.
+func patchRR(z ZoneInterface, rr dns.RR, generator Generator) error {
+	set, err := NewRRSetFromRRWithGenerator(rr, generator)
+	if err != nil {
+		return err
+	}
+	if nni, ok := z.GetRootNode().GetNameNode(rr.Header().Name); ok {
+		if cur := nni.GetRRSet(rr.Header().Rrtype); !IsEmptyRRSet(cur) && IsCompleteEqualsRRSet(cur, set) {
+			return nil
+		}
+	}
+	return CreateOrReplaceRRSetFromRRs(z.GetRootNode(), []dns.RR{rr}, generator)
+}
+
+// resignNode updates RRSIGs of name node.
+// rrsets which are different from old are signed, and RRSIGs of other rrsets are refreshed without verification.
+// RRSIG rrset is not changed if all RRSIGs are kept.
+func resignNode(nni, old NameNodeInterface, opt SignOption, dnskeys []*DNSKEY, generator Generator, now time.Time, apex, auth bool) error {
+	cur, err := GetTyped[*dns.RRSIG](nni, dns.TypeRRSIG)
+	if err != nil {
+		return err
+	}
+	res := &SignResult{}
+	var rrsigs []*dns.RRSIG
+	if auth {
+		err = nni.IterateNameRRSet(func(ri RRSetInterface) error {
+			if ri.GetRRtype() == dns.TypeNS && !apex {
+				return nil
+			}
+			if ri.GetRRtype() == dns.TypeRRSIG || ri.Len() == 0 {
+				return nil
+			}
+			// ZONEMD is signed after updating digest
+			if ri.GetRRtype() == dns.TypeZONEMD && apex && opt.GetZONEMDEnabled() {
+				return nil
+			}
+			olds := cur
+			if !isUnchangedRRSet(old, ri) {
+				olds = nil
+			}
+			rrs, err := refreshRRSIGs(ri, olds, opt, dnskeys, now, res, false)
+			if err != nil {
+				return err
+			}
+			rrsigs = append(rrsigs, rrs...)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to sign rrset: %w", err)
+		}
+	}
+	if res.Created == 0 && len(rrsigs) == len(cur) {
+		return nil
+	}
+	if len(rrsigs) == 0 {
+		return nni.RemoveRRSet(dns.TypeRRSIG)
+	}
+	set, err := generator.NewRRSet(nni.GetName(), 0, nni.GetClass(), dns.TypeRRSIG)
+	if err != nil {
+		return err
+	}
+	for _, rrsig := range rrsigs {
+		if err := set.AddRR(rrsig); err != nil {
+			return err
+		}
+	}
+	return nni.SetRRSet(set)
+}
+
+// isUnchangedRRSet returns true if old has the same rrset as ri.
+func isUnchangedRRSet(old NameNodeInterface, ri RRSetInterface) bool {
+	if old == nil {
+		return false
+	}
+	nni, ok := old.GetNameNode(ri.GetName())
+	if !ok {
+		return false
+	}
+	set := nni.GetRRSet(ri.GetRRtype())
+	return !IsEmptyRRSet(set) && IsCompleteEqualsRRSet(set, ri)
+}
+
+// stripSignature removes RRSIG, NSEC and NSEC3 rrsets from all name nodes.
+func stripSignature(z ZoneInterface) error {
+	var nodes []NameNodeInterface
+	z.GetRootNode().IterateNameNode(func(nni NameNodeInterface) error {
+		nodes = append(nodes, nni)
+		return nil
+	})
+	for _, nni := range nodes {
+		for _, rrtype := range []uint16{dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3} {
+			if nni.GetRRSet(rrtype) == nil {
+				continue
+			}
+			if err := nni.RemoveRRSet(rrtype); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
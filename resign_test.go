@@ -0,0 +1,167 @@
+package dnsutils_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test resign.go", func() {
+	var (
+		err        error
+		z          *dnsutils.Zone
+		old        dnsutils.NameNodeInterface
+		dnskeys    []*dnsutils.DNSKEY
+		inception  = uint32(1704067200)
+		inception2 = uint32(1704153600)
+		expiration = uint32(1893456000)
+		opt        dnsutils.SignOption
+		newSOA     = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 2 3600 900 85400 300")
+		newA       = testtool.MustNewRR("new.example.jp. 3600 IN A 192.168.0.2")
+	)
+	readZone := func() *dnsutils.Zone {
+		z := &dnsutils.Zone{}
+		Expect(z.Read(bytes.NewBuffer(testSignZone))).To(Succeed())
+		return z
+	}
+	change := func(z *dnsutils.Zone) {
+		Expect(z.GetRootNode().SetRRSet(dnsutils.NewRRSetFromRR(newSOA))).To(Succeed())
+		nn, err := dnsutils.GetNameNodeOrCreate(z.GetRootNode(), "new.example.jp.", nil)
+		Expect(err).To(Succeed())
+		Expect(nn.SetRRSet(dnsutils.NewRRSetFromRR(newA))).To(Succeed())
+		Expect(dnsutils.SetNameNode(z.GetRootNode(), nn, nil)).To(Succeed())
+		nn, ok := z.GetRootNode().GetNameNode("test.hoge.example.jp.")
+		Expect(ok).To(BeTrue())
+		Expect(nn.RemoveRRSet(dns.TypeA)).To(Succeed())
+	}
+	rrsigOf := func(z *dnsutils.Zone, name string, rrtype uint16) *dns.RRSIG {
+		nn, ok := z.GetRootNode().GetNameNode(name)
+		Expect(ok).To(BeTrue(), name)
+		rrsigs, err := dnsutils.GetTyped[*dns.RRSIG](nn, dns.TypeRRSIG)
+		Expect(err).To(Succeed())
+		for _, rrsig := range rrsigs {
+			if rrsig.TypeCovered == rrtype {
+				return rrsig
+			}
+		}
+		return nil
+	}
+	BeforeEach(func() {
+		ksk, err := dnsutils.ReadDNSKEY(bytes.NewBuffer(testDnskeyED25519KSKPriv), bytes.NewBuffer(testDnskeyED25519KSKPub))
+		Expect(err).To(Succeed())
+		zsk, err := dnsutils.ReadDNSKEY(bytes.NewBuffer(testDnskeyED25519ZSKPriv), bytes.NewBuffer(testDnskeyED25519ZSKPub))
+		Expect(err).To(Succeed())
+		dnskeys = []*dnsutils.DNSKEY{ksk, zsk}
+		opt = dnsutils.SignOption{
+			DoEMethod:     dnsutils.DenialOfExistenceMethodNSEC,
+			Inception:     &inception,
+			Expiration:    &expiration,
+			ZONEMDEnabled: &False,
+			CDSEnabled:    &False,
+		}
+	})
+	JustBeforeEach(func() {
+		z = readZone()
+		Expect(dnsutils.Sign(z, opt, dnskeys, nil)).To(Succeed())
+		old, err = dnsutils.CopyNameNodeTree(z.GetRootNode(), nil)
+		Expect(err).To(Succeed())
+		change(z)
+	})
+	Context("Resign", func() {
+		When("NSEC", func() {
+			It("returns the same zone as full signing", func() {
+				Expect(dnsutils.Resign(z, old, opt, dnskeys, nil)).To(Succeed())
+				expected := readZone()
+				change(expected)
+				Expect(dnsutils.Sign(expected, opt, dnskeys, nil)).To(Succeed())
+				Expect(dnsutils.IsEqualsAllTree(z.GetRootNode(), expected.GetRootNode(), true)).To(BeTrue())
+			})
+			It("signs only changed rrsets", func() {
+				opt.Inception = &inception2
+				Expect(dnsutils.Resign(z, old, opt, dnskeys, nil)).To(Succeed())
+				Expect(rrsigOf(z, "example.jp.", dns.TypeSOA).Inception).To(Equal(inception2))
+				Expect(rrsigOf(z, "new.example.jp.", dns.TypeA).Inception).To(Equal(inception2))
+				Expect(rrsigOf(z, "new.example.jp.", dns.TypeNSEC).Inception).To(Equal(inception2))
+				// NSEC next names are changed
+				Expect(rrsigOf(z, "www.hoge.example.jp.", dns.TypeNSEC).Inception).To(Equal(inception2))
+				Expect(rrsigOf(z, "*.example.jp.", dns.TypeNSEC).Inception).To(Equal(inception2))
+				Expect(rrsigOf(z, "\\000.example.jp.", dns.TypeNSEC).Inception).To(Equal(inception))
+				Expect(rrsigOf(z, "example.jp.", dns.TypeNS).Inception).To(Equal(inception))
+				Expect(rrsigOf(z, "example.jp.", dns.TypeDNSKEY).Inception).To(Equal(inception))
+				Expect(rrsigOf(z, "www.hoge.example.jp.", dns.TypeCNAME).Inception).To(Equal(inception))
+				_, ok := z.GetRootNode().GetNameNode("test.hoge.example.jp.")
+				Expect(ok).To(BeFalse())
+			})
+			It("keeps RRSIGs of unchanged rrsets without verification", func() {
+				nn, ok := z.GetRootNode().GetNameNode("www.hoge.example.jp.")
+				Expect(ok).To(BeTrue())
+				var rrs []dns.RR
+				for _, rr := range nn.GetRRSet(dns.TypeRRSIG).GetRRs() {
+					rrsig := dns.Copy(rr).(*dns.RRSIG)
+					if rrsig.TypeCovered == dns.TypeCNAME {
+						rrsig.Signature = "AAAA" + rrsig.Signature[4:]
+					}
+					rrs = append(rrs, rrsig)
+				}
+				Expect(dnsutils.CreateOrReplaceRRSetFromRRs(z.GetRootNode(), rrs, nil)).To(Succeed())
+				broken := rrsigOf(z, "www.hoge.example.jp.", dns.TypeCNAME).String()
+				ns := rrsigOf(z, "example.jp.", dns.TypeNS).String()
+
+				opt.Inception = &inception2
+				Expect(dnsutils.Resign(z, old, opt, dnskeys, nil)).To(Succeed())
+				Expect(rrsigOf(z, "www.hoge.example.jp.", dns.TypeCNAME).String()).To(Equal(broken))
+				Expect(rrsigOf(z, "www.hoge.example.jp.", dns.TypeNSEC).Inception).To(Equal(inception2))
+				Expect(rrsigOf(z, "example.jp.", dns.TypeNS).String()).To(Equal(ns))
+			})
+		})
+		When("NSEC3 and ZONEMD", func() {
+			BeforeEach(func() {
+				opt.DoEMethod = dnsutils.DenialOfExistenceMethodNSEC3
+				opt.ZONEMDEnabled = &True
+			})
+			It("returns the same zone as full signing", func() {
+				Expect(dnsutils.Resign(z, old, opt, dnskeys, nil)).To(Succeed())
+				expected := readZone()
+				change(expected)
+				Expect(dnsutils.Sign(expected, opt, dnskeys, nil)).To(Succeed())
+				Expect(dnsutils.IsEqualsAllTree(z.GetRootNode(), expected.GetRootNode(), true)).To(BeTrue())
+				ok, err := dnsutils.VerifyAnyZONEMDDigest(z)
+				Expect(err).To(Succeed())
+				Expect(ok).To(BeTrue())
+			})
+		})
+		When("old RRSIGs are in refresh window", func() {
+			BeforeEach(func() {
+				soon := uint32(time.Now().Add(24 * time.Hour).Unix())
+				opt.Expiration = &soon
+			})
+			It("regenerates them", func() {
+				opt.Inception = &inception2
+				opt.Expiration = &expiration
+				Expect(dnsutils.Resign(z, old, opt, dnskeys, nil)).To(Succeed())
+				Expect(rrsigOf(z, "example.jp.", dns.TypeNS).Inception).To(Equal(inception2))
+				Expect(rrsigOf(z, "example.jp.", dns.TypeNS).Expiration).To(Equal(expiration))
+				Expect(rrsigOf(z, "www.hoge.example.jp.", dns.TypeCNAME).Inception).To(Equal(inception2))
+			})
+		})
+		When("old RRSIGs are made by removed key", func() {
+			It("does not reuse them", func() {
+				zsk, err := dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, dns.ED25519, dnsutils.KeyRoleZSK, 3600, 0)
+				Expect(err).To(Succeed())
+				Expect(dnsutils.Resign(z, old, opt, []*dnsutils.DNSKEY{dnskeys[0], zsk}, nil)).To(Succeed())
+				Expect(rrsigOf(z, "example.jp.", dns.TypeNS).KeyTag).To(Equal(zsk.GetRR().KeyTag()))
+				Expect(rrsigOf(z, "www.hoge.example.jp.", dns.TypeCNAME).KeyTag).To(Equal(zsk.GetRR().KeyTag()))
+			})
+		})
+		When("DNSKEYs are empty", func() {
+			It("returns error", func() {
+				Expect(dnsutils.Resign(z, old, opt, nil, nil)).NotTo(Succeed())
+			})
+		})
+	})
+})
@@ -0,0 +1,352 @@
+package dnsutils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// KeyState is state of managed key at a time.
+type KeyState string
+
+const (
+	// KeyStateGenerated is key which is neither published nor used yet.
+	KeyStateGenerated KeyState = "generated"
+	// KeyStatePublished is key which is in DNSKEY rrset and doesn't sign yet.
+	KeyStatePublished KeyState = "published"
+	// KeyStateActive is key which signs.
+	KeyStateActive KeyState = "active"
+	// KeyStateRetired is key which is in DNSKEY rrset and doesn't sign any more.
+	KeyStateRetired KeyState = "retired"
+	// KeyStateRemoved is key which is neither published nor used any more.
+	KeyStateRemoved KeyState = "removed"
+)
+
+var (
+	ErrRolloverKeyRole   = fmt.Errorf("invalid key role for rollover")
+	ErrRolloverAlgorithm = fmt.Errorf("invalid algorithm for rollover")
+	ErrNoSigningKey      = fmt.Errorf("no signing key")
+	ErrNoPublishedKey    = fmt.Errorf("no published key")
+)
+
+// ManagedKey is DNSKEY with timings. RFC 7583.
+// Zero time means the event is not scheduled.
+type ManagedKey struct {
+	Key *DNSKEY
+	// Publish is time when key is added to DNSKEY rrset.
+	Publish time.Time
+	// Activate is time when key starts signing.
+	Activate time.Time
+	// Retire is time when key stops signing.
+	Retire time.Time
+	// Remove is time when key is removed from DNSKEY rrset.
+	Remove time.Time
+	// DSPublish and DSRemove are period when CDS and CDNSKEY of KSK are published.
+	// If they are zero, Publish and Remove are used.
+	DSPublish time.Time
+	DSRemove  time.Time
+}
+
+// NewManagedKey creates ManagedKey which is published and active at t.
+func NewManagedKey(key *DNSKEY, t time.Time) *ManagedKey {
+	return &ManagedKey{Key: key, Publish: t, Activate: t}
+}
+
+func reached(t, now time.Time) bool {
+	return !t.IsZero() && !now.Before(t)
+}
+
+func inPeriod(start, end, now time.Time) bool {
+	return reached(start, now) && !reached(end, now)
+}
+
+// IsPublished returns true if key is in DNSKEY rrset at now.
+func (k *ManagedKey) IsPublished(now time.Time) bool {
+	return inPeriod(k.Publish, k.Remove, now)
+}
+
+// IsSigning returns true if key signs at now.
+func (k *ManagedKey) IsSigning(now time.Time) bool {
+	return inPeriod(k.Activate, k.Retire, now)
+}
+
+// IsDSPublished returns true if CDS and CDNSKEY of KSK are published at now.
+func (k *ManagedKey) IsDSPublished(now time.Time) bool {
+	if !k.Key.IsKSK() {
+		return false
+	}
+	start, end := k.DSPublish, k.DSRemove
+	if start.IsZero() {
+		start = k.Publish
+	}
+	if end.IsZero() {
+		end = k.Remove
+	}
+	return inPeriod(start, end, now)
+}
+
+// State returns state of key at now.
+func (k *ManagedKey) State(now time.Time) KeyState {
+	switch {
+	case k.IsSigning(now):
+		return KeyStateActive
+	case k.IsPublished(now) && reached(k.Retire, now):
+		return KeyStateRetired
+	case k.IsPublished(now):
+		return KeyStatePublished
+	case reached(k.Publish, now) || reached(k.Activate, now):
+		return KeyStateRemoved
+	}
+	return KeyStateGenerated
+}
+
+func (k *ManagedKey) times() []time.Time {
+	return []time.Time{k.Publish, k.Activate, k.Retire, k.Remove, k.DSPublish, k.DSRemove}
+}
+
+// NextKeyEvent returns earliest scheduled time after now.
+// If there is no event, it returns false.
+func NextKeyEvent(keys []*ManagedKey, now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, k := range keys {
+		for _, t := range k.times() {
+			if t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+var (
+	DefaultRolloverDNSKEYTTL              = time.Hour
+	DefaultRolloverMaxZoneTTL             = time.Hour * 24
+	DefaultRolloverDSTTL                  = time.Hour * 24
+	DefaultRolloverPropagationDelay       = time.Minute * 5
+	DefaultRolloverParentPropagationDelay = time.Hour
+	DefaultRolloverRegistrationDelay      = time.Hour * 24
+)
+
+// RolloverOption is timing parameters of rollover. RFC 7583 section 3.
+type RolloverOption struct {
+	// DNSKEYTTL is TTL of DNSKEY rrset. (TTLkey)
+	DNSKEYTTL *time.Duration
+	// MaxZoneTTL is maximum TTL of signed rrsets. (TTLsig)
+	MaxZoneTTL *time.Duration
+	// DSTTL is TTL of DS rrset in parent zone. (TTLds)
+	DSTTL *time.Duration
+	// PropagationDelay is time to propagate zone to all secondaries. (Dprp)
+	PropagationDelay *time.Duration
+	// ParentPropagationDelay is Dprp of parent zone. (DprpP)
+	ParentPropagationDelay *time.Duration
+	// RegistrationDelay is time to register DS to parent zone. (Dreg)
+	RegistrationDelay *time.Duration
+}
+
+func (o *RolloverOption) GetDNSKEYTTL() time.Duration {
+	if o == nil || o.DNSKEYTTL == nil {
+		return DefaultRolloverDNSKEYTTL
+	}
+	return *o.DNSKEYTTL
+}
+
+func (o *RolloverOption) GetMaxZoneTTL() time.Duration {
+	if o == nil || o.MaxZoneTTL == nil {
+		return DefaultRolloverMaxZoneTTL
+	}
+	return *o.MaxZoneTTL
+}
+
+func (o *RolloverOption) GetDSTTL() time.Duration {
+	if o == nil || o.DSTTL == nil {
+		return DefaultRolloverDSTTL
+	}
+	return *o.DSTTL
+}
+
+func (o *RolloverOption) GetPropagationDelay() time.Duration {
+	if o == nil || o.PropagationDelay == nil {
+		return DefaultRolloverPropagationDelay
+	}
+	return *o.PropagationDelay
+}
+
+func (o *RolloverOption) GetParentPropagationDelay() time.Duration {
+	if o == nil || o.ParentPropagationDelay == nil {
+		return DefaultRolloverParentPropagationDelay
+	}
+	return *o.ParentPropagationDelay
+}
+
+func (o *RolloverOption) GetRegistrationDelay() time.Duration {
+	if o == nil || o.RegistrationDelay == nil {
+		return DefaultRolloverRegistrationDelay
+	}
+	return *o.RegistrationDelay
+}
+
+// keyInterval is time until all caches have new DNSKEY rrset.
+func (o *RolloverOption) keyInterval() time.Duration {
+	return o.GetPropagationDelay() + o.GetDNSKEYTTL()
+}
+
+// sigInterval is time until all caches have new signatures.
+func (o *RolloverOption) sigInterval() time.Duration {
+	return o.GetPropagationDelay() + o.GetMaxZoneTTL()
+}
+
+// dsInterval is time until all caches have new DS rrset.
+func (o *RolloverOption) dsInterval() time.Duration {
+	return o.GetRegistrationDelay() + o.GetParentPropagationDelay() + o.GetDSTTL()
+}
+
+// PlanZSKRollover schedules ZSK pre-publication rollover starting at start. RFC 7583 section 3.2.1.
+// next is published at start and becomes active after DNSKEY rrset is propagated.
+// current is retired at the same time, and removed after its signatures expire from caches.
+// CSKs are not supported.
+func PlanZSKRollover(current, next *ManagedKey, start time.Time, opt *RolloverOption) error {
+	if current.Key.IsCSK() || next.Key.IsCSK() {
+		return fmt.Errorf("%w: CSK rollover is not supported", ErrRolloverKeyRole)
+	}
+	if current.Key.IsKSK() || next.Key.IsKSK() {
+		return fmt.Errorf("%w: ZSK rollover requires ZSKs", ErrRolloverKeyRole)
+	}
+	if current.Key.GetRR().Algorithm != next.Key.GetRR().Algorithm {
+		return fmt.Errorf("%w: use algorithm rollover", ErrRolloverAlgorithm)
+	}
+	next.Publish = start
+	next.Activate = start.Add(opt.keyInterval())
+	current.Retire = next.Activate
+	current.Remove = current.Retire.Add(opt.sigInterval())
+	return nil
+}
+
+// PlanKSKRollover schedules KSK double-DS rollover starting at start. RFC 7583 section 3.3.2.
+// CDS and CDNSKEY of next are published at start, before DNSKEY of next is published.
+// It is intended by double-DS, the parent has DS of both keys before DNSKEY is switched.
+// After new DS is propagated in parent zone, DNSKEY is switched from current to next.
+// CDS and CDNSKEY of current are removed after new DNSKEY rrset is propagated.
+// CSKs are not supported, because new CSK can't sign before its DNSKEY is propagated.
+func PlanKSKRollover(current, next *ManagedKey, start time.Time, opt *RolloverOption) error {
+	if current.Key.IsCSK() || next.Key.IsCSK() {
+		return fmt.Errorf("%w: CSK rollover is not supported", ErrRolloverKeyRole)
+	}
+	if !current.Key.IsKSK() || !next.Key.IsKSK() {
+		return fmt.Errorf("%w: KSK rollover requires KSKs", ErrRolloverKeyRole)
+	}
+	if current.Key.GetRR().Algorithm != next.Key.GetRR().Algorithm {
+		return fmt.Errorf("%w: use algorithm rollover", ErrRolloverAlgorithm)
+	}
+	swap := start.Add(opt.dsInterval())
+	next.DSPublish = start
+	next.Publish = swap
+	next.Activate = swap
+	current.Retire = swap
+	current.Remove = swap
+	current.DSRemove = swap.Add(opt.keyInterval())
+	return nil
+}
+
+// PlanAlgorithmRollover schedules conservative algorithm rollover starting at start. RFC 6781 section 4.1.4.
+//  1. next keys start signing at start.
+//  2. next keys are published after new signatures are propagated.
+//  3. CDS and CDNSKEY are switched to next KSKs after new DNSKEY rrset is propagated.
+//  4. current keys are removed from DNSKEY rrset after new DS is propagated.
+//  5. current keys stop signing after DNSKEY rrset is propagated.
+func PlanAlgorithmRollover(current, next []*ManagedKey, start time.Time, opt *RolloverOption) error {
+	if !hasKSKAndZSK(current) || !hasKSKAndZSK(next) {
+		return fmt.Errorf("%w: algorithm rollover requires KSK and ZSK", ErrRolloverKeyRole)
+	}
+	algorithms := map[uint8]struct{}{}
+	for _, k := range current {
+		algorithms[k.Key.GetRR().Algorithm] = struct{}{}
+	}
+	for _, k := range next {
+		if _, ok := algorithms[k.Key.GetRR().Algorithm]; ok {
+			return fmt.Errorf("%w: %s is used by current keys", ErrRolloverAlgorithm, dns.AlgorithmToString[k.Key.GetRR().Algorithm])
+		}
+	}
+	publish := start.Add(opt.sigInterval())
+	dsSwap := publish.Add(opt.keyInterval())
+	remove := dsSwap.Add(opt.dsInterval())
+	retire := remove.Add(opt.keyInterval())
+	for _, k := range next {
+		k.Activate = start
+		k.Publish = publish
+		if k.Key.IsKSK() {
+			k.DSPublish = dsSwap
+		}
+	}
+	for _, k := range current {
+		if k.Key.IsKSK() {
+			k.DSRemove = dsSwap
+		}
+		k.Remove = remove
+		k.Retire = retire
+	}
+	return nil
+}
+
+func hasKSKAndZSK(keys []*ManagedKey) bool {
+	var ksk, zsk bool
+	for _, k := range keys {
+		ksk = ksk || k.Key.IsKSK()
+		zsk = zsk || k.Key.IsZSK()
+	}
+	return ksk && zsk
+}
+
+// SigningPlan is keys used by signing at a time.
+type SigningPlan struct {
+	// Published is keys in DNSKEY rrset.
+	Published []*DNSKEY
+	// Signing is keys which sign zone.
+	Signing []*DNSKEY
+	// DS is KSKs whose CDS and CDNSKEY are published.
+	// It may have keys which are not in Published, e.g. next KSK of double-DS rollover.
+	DS []*DNSKEY
+}
+
+// PlanSigning returns SigningPlan of keys at now.
+func PlanSigning(keys []*ManagedKey, now time.Time) *SigningPlan {
+	p := &SigningPlan{}
+	for _, k := range keys {
+		if k.IsPublished(now) {
+			p.Published = append(p.Published, k.Key)
+		}
+		if k.IsSigning(now) {
+			p.Signing = append(p.Signing, k.Key)
+		}
+		if k.IsDSPublished(now) {
+			p.DS = append(p.DS, k.Key)
+		}
+	}
+	return p
+}
+
+// Sign signs zone by plan.
+// Existing DNSKEY, CDS, CDNSKEY and signatures are replaced.
+func (p *SigningPlan) Sign(z ZoneInterface, opt SignOption, generator Generator) error {
+	if generator == nil {
+		generator = &DefaultGenerator{}
+	}
+	if len(p.Published) == 0 {
+		return ErrNoPublishedKey
+	}
+	if len(p.Signing) == 0 {
+		return ErrNoSigningKey
+	}
+	for _, rrtype := range []uint16{dns.TypeDNSKEY, dns.TypeCDS, dns.TypeCDNSKEY} {
+		if z.GetRootNode().GetRRSet(rrtype) == nil {
+			continue
+		}
+		if err := z.GetRootNode().RemoveRRSet(rrtype); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", dns.TypeToString[rrtype], err)
+		}
+	}
+	if err := stripSignature(z); err != nil {
+		return fmt.Errorf("failed to remove signatures: %w", err)
+	}
+	return sign(z, opt, p.Published, p.Signing, p.DS, generator)
+}
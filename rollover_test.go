@@ -0,0 +1,265 @@
+package dnsutils_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test rollover.go", func() {
+	var (
+		t0         = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		start      = t0.Add(time.Hour * 24 * 30)
+		hour       = time.Hour
+		day        = time.Hour * 24
+		zero       = time.Duration(0)
+		opt        *dnsutils.RolloverOption
+		ksk, zsk   *dnsutils.ManagedKey
+		inception  = uint32(1704067200)
+		expiration = uint32(1893456000)
+	)
+	newKey := func(alg uint8, role dnsutils.KeyRole) *dnsutils.ManagedKey {
+		key, err := dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, alg, role, 3600, 0)
+		Expect(err).To(Succeed())
+		return &dnsutils.ManagedKey{Key: key}
+	}
+	keyTags := func(keys []*dnsutils.DNSKEY) []uint16 {
+		tags := []uint16{}
+		for _, k := range keys {
+			tags = append(tags, k.GetRR().KeyTag())
+		}
+		return tags
+	}
+	tagsOf := func(keys ...*dnsutils.ManagedKey) []uint16 {
+		tags := []uint16{}
+		for _, k := range keys {
+			tags = append(tags, k.Key.GetRR().KeyTag())
+		}
+		return tags
+	}
+	BeforeEach(func() {
+		opt = &dnsutils.RolloverOption{
+			DNSKEYTTL:              &hour,
+			MaxZoneTTL:             &day,
+			DSTTL:                  &day,
+			PropagationDelay:       &zero,
+			ParentPropagationDelay: &hour,
+			RegistrationDelay:      &day,
+		}
+		ksk = newKey(dns.ED25519, dnsutils.KeyRoleKSK)
+		ksk.Publish, ksk.Activate = t0, t0
+		zsk = dnsutils.NewManagedKey(newKey(dns.ED25519, dnsutils.KeyRoleZSK).Key, t0)
+	})
+	Context("ManagedKey", func() {
+		It("returns state", func() {
+			k := &dnsutils.ManagedKey{
+				Key:      zsk.Key,
+				Publish:  t0,
+				Activate: t0.Add(hour),
+				Retire:   t0.Add(2 * hour),
+				Remove:   t0.Add(3 * hour),
+			}
+			Expect(k.State(t0.Add(-time.Second))).To(Equal(dnsutils.KeyStateGenerated))
+			Expect(k.State(t0)).To(Equal(dnsutils.KeyStatePublished))
+			Expect(k.State(t0.Add(hour))).To(Equal(dnsutils.KeyStateActive))
+			Expect(k.State(t0.Add(2 * hour))).To(Equal(dnsutils.KeyStateRetired))
+			Expect(k.State(t0.Add(3 * hour))).To(Equal(dnsutils.KeyStateRemoved))
+			Expect(k.IsDSPublished(t0)).To(BeFalse())
+			Expect(ksk.IsDSPublished(t0)).To(BeTrue())
+		})
+		It("returns next event", func() {
+			next, ok := dnsutils.NextKeyEvent([]*dnsutils.ManagedKey{ksk, zsk}, t0)
+			Expect(ok).To(BeFalse())
+			Expect(next.IsZero()).To(BeTrue())
+			zsk.Retire = t0.Add(2 * hour)
+			ksk.Remove = t0.Add(hour)
+			next, ok = dnsutils.NextKeyEvent([]*dnsutils.ManagedKey{ksk, zsk}, t0)
+			Expect(ok).To(BeTrue())
+			Expect(next).To(Equal(t0.Add(hour)))
+		})
+	})
+	Context("PlanZSKRollover", func() {
+		It("schedules pre-publication rollover", func() {
+			next := newKey(dns.ED25519, dnsutils.KeyRoleZSK)
+			Expect(dnsutils.PlanZSKRollover(zsk, next, start, opt)).To(Succeed())
+			Expect(next.Publish).To(Equal(start))
+			Expect(next.Activate).To(Equal(start.Add(hour)))
+			Expect(zsk.Retire).To(Equal(start.Add(hour)))
+			Expect(zsk.Remove).To(Equal(start.Add(hour + day)))
+
+			keys := []*dnsutils.ManagedKey{ksk, zsk, next}
+			p := dnsutils.PlanSigning(keys, start.Add(-time.Second))
+			Expect(keyTags(p.Published)).To(Equal(tagsOf(ksk, zsk)))
+			Expect(keyTags(p.Signing)).To(Equal(tagsOf(ksk, zsk)))
+			Expect(keyTags(p.DS)).To(Equal(tagsOf(ksk)))
+			p = dnsutils.PlanSigning(keys, start)
+			Expect(keyTags(p.Published)).To(Equal(tagsOf(ksk, zsk, next)))
+			Expect(keyTags(p.Signing)).To(Equal(tagsOf(ksk, zsk)))
+			p = dnsutils.PlanSigning(keys, start.Add(hour))
+			Expect(keyTags(p.Published)).To(Equal(tagsOf(ksk, zsk, next)))
+			Expect(keyTags(p.Signing)).To(Equal(tagsOf(ksk, next)))
+			Expect(zsk.State(start.Add(hour))).To(Equal(dnsutils.KeyStateRetired))
+			p = dnsutils.PlanSigning(keys, start.Add(hour+day))
+			Expect(keyTags(p.Published)).To(Equal(tagsOf(ksk, next)))
+			Expect(keyTags(p.Signing)).To(Equal(tagsOf(ksk, next)))
+		})
+		It("returns error for invalid keys", func() {
+			Expect(dnsutils.PlanZSKRollover(ksk, newKey(dns.ED25519, dnsutils.KeyRoleZSK), start, opt)).To(MatchError(dnsutils.ErrRolloverKeyRole))
+			Expect(dnsutils.PlanZSKRollover(zsk, newKey(dns.ECDSAP256SHA256, dnsutils.KeyRoleZSK), start, opt)).To(MatchError(dnsutils.ErrRolloverAlgorithm))
+		})
+		It("returns error for CSKs", func() {
+			csk := newKey(dns.ED25519, dnsutils.KeyRoleCSK)
+			err := dnsutils.PlanZSKRollover(csk, newKey(dns.ED25519, dnsutils.KeyRoleCSK), start, opt)
+			Expect(err).To(MatchError(dnsutils.ErrRolloverKeyRole))
+			Expect(err.Error()).To(ContainSubstring("CSK"))
+			Expect(dnsutils.PlanZSKRollover(zsk, csk, start, opt)).To(MatchError(dnsutils.ErrRolloverKeyRole))
+		})
+	})
+	Context("PlanKSKRollover", func() {
+		It("schedules double-DS rollover", func() {
+			next := newKey(dns.ED25519, dnsutils.KeyRoleKSK)
+			Expect(dnsutils.PlanKSKRollover(ksk, next, start, opt)).To(Succeed())
+			swap := start.Add(day + hour + day)
+			Expect(next.DSPublish).To(Equal(start))
+			Expect(next.Publish).To(Equal(swap))
+			Expect(ksk.Remove).To(Equal(swap))
+			Expect(ksk.DSRemove).To(Equal(swap.Add(hour)))
+
+			keys := []*dnsutils.ManagedKey{ksk, zsk, next}
+			p := dnsutils.PlanSigning(keys, start)
+			Expect(keyTags(p.Published)).To(Equal(tagsOf(ksk, zsk)))
+			Expect(keyTags(p.Signing)).To(Equal(tagsOf(ksk, zsk)))
+			Expect(keyTags(p.DS)).To(Equal(tagsOf(ksk, next)))
+			p = dnsutils.PlanSigning(keys, swap)
+			Expect(keyTags(p.Published)).To(Equal(tagsOf(zsk, next)))
+			Expect(keyTags(p.Signing)).To(Equal(tagsOf(zsk, next)))
+			Expect(keyTags(p.DS)).To(Equal(tagsOf(ksk, next)))
+			Expect(ksk.State(swap)).To(Equal(dnsutils.KeyStateRemoved))
+			p = dnsutils.PlanSigning(keys, swap.Add(hour))
+			Expect(keyTags(p.DS)).To(Equal(tagsOf(next)))
+		})
+		It("returns error for invalid keys", func() {
+			Expect(dnsutils.PlanKSKRollover(zsk, newKey(dns.ED25519, dnsutils.KeyRoleKSK), start, opt)).To(MatchError(dnsutils.ErrRolloverKeyRole))
+		})
+		It("returns error for CSKs", func() {
+			csk := newKey(dns.ED25519, dnsutils.KeyRoleCSK)
+			err := dnsutils.PlanKSKRollover(csk, newKey(dns.ED25519, dnsutils.KeyRoleCSK), start, opt)
+			Expect(err).To(MatchError(dnsutils.ErrRolloverKeyRole))
+			Expect(err.Error()).To(ContainSubstring("CSK"))
+			Expect(dnsutils.PlanKSKRollover(ksk, csk, start, opt)).To(MatchError(dnsutils.ErrRolloverKeyRole))
+			Expect(ksk.Retire.IsZero()).To(BeTrue())
+		})
+	})
+	Context("PlanAlgorithmRollover", func() {
+		It("schedules conservative algorithm rollover", func() {
+			nextKSK := newKey(dns.ECDSAP256SHA256, dnsutils.KeyRoleKSK)
+			nextZSK := newKey(dns.ECDSAP256SHA256, dnsutils.KeyRoleZSK)
+			current := []*dnsutils.ManagedKey{ksk, zsk}
+			next := []*dnsutils.ManagedKey{nextKSK, nextZSK}
+			Expect(dnsutils.PlanAlgorithmRollover(current, next, start, opt)).To(Succeed())
+			keys := append(current, next...)
+
+			publish := start.Add(day)
+			dsSwap := publish.Add(hour)
+			remove := dsSwap.Add(day + hour + day)
+			retire := remove.Add(hour)
+
+			p := dnsutils.PlanSigning(keys, start)
+			Expect(keyTags(p.Published)).To(Equal(tagsOf(ksk, zsk)))
+			Expect(keyTags(p.Signing)).To(Equal(tagsOf(ksk, zsk, nextKSK, nextZSK)))
+			Expect(keyTags(p.DS)).To(Equal(tagsOf(ksk)))
+			p = dnsutils.PlanSigning(keys, publish)
+			Expect(keyTags(p.Published)).To(Equal(tagsOf(ksk, zsk, nextKSK, nextZSK)))
+			Expect(keyTags(p.DS)).To(Equal(tagsOf(ksk)))
+			p = dnsutils.PlanSigning(keys, dsSwap)
+			Expect(keyTags(p.DS)).To(Equal(tagsOf(nextKSK)))
+			p = dnsutils.PlanSigning(keys, remove)
+			Expect(keyTags(p.Published)).To(Equal(tagsOf(nextKSK, nextZSK)))
+			Expect(keyTags(p.Signing)).To(Equal(tagsOf(ksk, zsk, nextKSK, nextZSK)))
+			p = dnsutils.PlanSigning(keys, retire)
+			Expect(keyTags(p.Published)).To(Equal(tagsOf(nextKSK, nextZSK)))
+			Expect(keyTags(p.Signing)).To(Equal(tagsOf(nextKSK, nextZSK)))
+			Expect(ksk.State(retire)).To(Equal(dnsutils.KeyStateRemoved))
+		})
+		It("returns error for invalid keys", func() {
+			Expect(dnsutils.PlanAlgorithmRollover([]*dnsutils.ManagedKey{ksk, zsk}, []*dnsutils.ManagedKey{newKey(dns.ED25519, dnsutils.KeyRoleKSK), newKey(dns.ED25519, dnsutils.KeyRoleZSK)}, start, opt)).To(MatchError(dnsutils.ErrRolloverAlgorithm))
+			Expect(dnsutils.PlanAlgorithmRollover([]*dnsutils.ManagedKey{ksk, zsk}, []*dnsutils.ManagedKey{newKey(dns.ECDSAP256SHA256, dnsutils.KeyRoleZSK)}, start, opt)).To(MatchError(dnsutils.ErrRolloverKeyRole))
+		})
+	})
+	Context("SigningPlan.Sign", func() {
+		var (
+			z       *dnsutils.Zone
+			signOpt dnsutils.SignOption
+		)
+		BeforeEach(func() {
+			z = &dnsutils.Zone{}
+			Expect(z.Read(bytes.NewBuffer(testSignZone))).To(Succeed())
+			signOpt = dnsutils.SignOption{
+				DoEMethod:  dnsutils.DenialOfExistenceMethodNSEC,
+				Inception:  &inception,
+				Expiration: &expiration,
+			}
+		})
+		It("signs zone in each phase of ZSK rollover", func() {
+			next := newKey(dns.ED25519, dnsutils.KeyRoleZSK)
+			Expect(dnsutils.PlanZSKRollover(zsk, next, start, opt)).To(Succeed())
+			keys := []*dnsutils.ManagedKey{ksk, zsk, next}
+			for _, now := range []time.Time{t0, start, start.Add(hour), start.Add(hour + day)} {
+				p := dnsutils.PlanSigning(keys, now)
+				Expect(p.Sign(z, signOpt, nil)).To(Succeed())
+				dnskeys, err := dnsutils.GetTyped[*dns.DNSKEY](z.GetRootNode(), dns.TypeDNSKEY)
+				Expect(err).To(Succeed())
+				Expect(dnskeys).To(HaveLen(len(p.Published)))
+				cds, err := dnsutils.GetTyped[*dns.CDS](z.GetRootNode(), dns.TypeCDS)
+				Expect(err).To(Succeed())
+				Expect(cds).To(HaveLen(1))
+				report, err := dnsutils.VerifyZone(z, []dns.RR{ksk.Key.GetRR()})
+				Expect(err).To(Succeed())
+				Expect(report.Err()).To(Succeed(), now.String())
+			}
+		})
+		It("signs verifiable zone at every event of algorithm rollover", func() {
+			nextKSK := newKey(dns.ECDSAP256SHA256, dnsutils.KeyRoleKSK)
+			nextZSK := newKey(dns.ECDSAP256SHA256, dnsutils.KeyRoleZSK)
+			Expect(dnsutils.PlanAlgorithmRollover([]*dnsutils.ManagedKey{ksk, zsk}, []*dnsutils.ManagedKey{nextKSK, nextZSK}, start, opt)).To(Succeed())
+			keys := []*dnsutils.ManagedKey{ksk, zsk, nextKSK, nextZSK}
+			events := 0
+			for now, ok := t0, true; ok; now, ok = dnsutils.NextKeyEvent(keys, now) {
+				p := dnsutils.PlanSigning(keys, now)
+				Expect(p.Sign(z, signOpt, nil)).To(Succeed())
+				var anchors []dns.RR
+				for _, k := range p.DS {
+					anchors = append(anchors, k.GetRR())
+				}
+				report, err := dnsutils.VerifyZone(z, anchors)
+				Expect(err).To(Succeed())
+				Expect(report.Err()).To(Succeed(), now.String())
+				events++
+			}
+			Expect(events).To(Equal(6))
+		})
+		It("publishes CDS of KSKs in DS period", func() {
+			next := newKey(dns.ED25519, dnsutils.KeyRoleKSK)
+			Expect(dnsutils.PlanKSKRollover(ksk, next, start, opt)).To(Succeed())
+			p := dnsutils.PlanSigning([]*dnsutils.ManagedKey{ksk, zsk, next}, start)
+			Expect(p.Sign(z, signOpt, nil)).To(Succeed())
+			cds, err := dnsutils.GetTyped[*dns.CDS](z.GetRootNode(), dns.TypeCDS)
+			Expect(err).To(Succeed())
+			Expect(cds).To(HaveLen(2))
+			dnskeys, err := dnsutils.GetTyped[*dns.DNSKEY](z.GetRootNode(), dns.TypeDNSKEY)
+			Expect(err).To(Succeed())
+			Expect(dnskeys).To(HaveLen(2))
+			// double-DS: CDS of next is published before its DNSKEY
+			Expect(keyTags(p.DS)).To(ContainElement(next.Key.GetRR().KeyTag()))
+			Expect(keyTags(p.Published)).NotTo(ContainElement(next.Key.GetRR().KeyTag()))
+		})
+		It("returns error without keys", func() {
+			Expect((&dnsutils.SigningPlan{}).Sign(z, signOpt, nil)).To(MatchError(dnsutils.ErrNoPublishedKey))
+			Expect((&dnsutils.SigningPlan{Published: []*dnsutils.DNSKEY{zsk.Key}}).Sign(z, signOpt, nil)).To(MatchError(dnsutils.ErrNoSigningKey))
+		})
+	})
+})
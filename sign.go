@@ -1,6 +1,7 @@
 package dnsutils
 
 import (
+	"bytes"
 	"crypto"
 	"fmt"
 	"io"
@@ -19,16 +20,22 @@ const (
 var (
 	DefaultBeforeSign time.Duration = time.Hour
 	DefaultExpiry     time.Duration = time.Hour * 24 * 14
+	// DefaultRefresh is default signature refresh window of SignIncremental.
+	DefaultRefresh time.Duration = time.Hour * 24 * 3
 )
 
 type SignOption struct {
-	BeforeSign   *time.Duration
-	Expiry       *time.Duration
-	Inception    *uint32
-	Expiration   *uint32
+	BeforeSign *time.Duration
+	Expiry     *time.Duration
+	Inception  *uint32
+	Expiration *uint32
+	// Refresh is window before expiration in which RRSIGs are regenerated by SignIncremental.
+	Refresh      *time.Duration
 	DoEMethod    DenialOfExistenceMethod
 	NSEC3Salt    string
 	NSEC3Iterate uint16
+	// NSEC3OptOut leaves out NSEC3 RRs of insecure delegations and sets opt-out flag. RFC 5155 section 6.
+	NSEC3OptOut bool
 
 	DNSKEYTTL *uint32
 
@@ -51,6 +58,13 @@ func (o *SignOption) GetExpiry() time.Duration {
 	return *o.Expiry
 }
 
+func (o *SignOption) GetRefresh() time.Duration {
+	if o.Refresh == nil {
+		return DefaultRefresh
+	}
+	return *o.Refresh
+}
+
 func (o *SignOption) GetInception() uint32 {
 	if o.Inception == nil {
 		return uint32(time.Now().UTC().Add(-o.GetBeforSign()).Unix())
@@ -80,6 +94,10 @@ func (o *SignOption) GetNSEC3Iterate() uint16 {
 	return o.NSEC3Iterate
 }
 
+func (o *SignOption) GetNSEC3OptOut() bool {
+	return o.NSEC3OptOut
+}
+
 func (o *SignOption) GetZONEMDEnabled() bool {
 	if o.ZONEMDEnabled == nil {
 		return true
@@ -103,8 +121,11 @@ func (o *SignOption) GetCDNSKEYEnabled() bool {
 type DNSKEY struct {
 	rr     *dns.DNSKEY
 	signer crypto.Signer
+	csk    bool
 }
 
+// ReadDNSKEY reads BIND .private and .key files.
+// If .private has Role metadata line of CSK, the key is read as CSK.
 func ReadDNSKEY(priv, pub io.Reader) (*DNSKEY, error) {
 	var dnskey *dns.DNSKEY
 	zp := dns.NewZoneParser(pub, "", "")
@@ -116,7 +137,11 @@ func ReadDNSKEY(priv, pub io.Reader) (*DNSKEY, error) {
 	if dnskey == nil {
 		return nil, fmt.Errorf("DNSKEY not found")
 	}
-	privateKey, err := dnskey.ReadPrivateKey(priv, "")
+	privData, err := io.ReadAll(priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	privateKey, err := dnskey.ReadPrivateKey(bytes.NewReader(privData), "")
 	if err != nil {
 		return nil, fmt.Errorf("DNSKEY not found")
 	}
@@ -124,6 +149,7 @@ func ReadDNSKEY(priv, pub io.Reader) (*DNSKEY, error) {
 	return &DNSKEY{
 		rr:     dnskey,
 		signer: signer,
+		csk:    dnskey.Flags == 257 && readKeyRole(privData) == KeyRoleCSK,
 	}, nil
 }
 
@@ -140,11 +166,21 @@ func (d *DNSKEY) IsKSK() bool {
 }
 
 func (d *DNSKEY) IsZSK() bool {
-	return d.rr.Flags == 256
+	return d.rr.Flags == 256 || d.csk
+}
+
+// IsCSK returns true if key is generated as CSK, which signs all rrsets.
+func (d *DNSKEY) IsCSK() bool {
+	return d.csk
 }
 
 func Sign(z ZoneInterface, opt SignOption, dnskeys []*DNSKEY, generator Generator) error {
-	if err := AddDNSKEY(z, opt, dnskeys, generator); err != nil {
+	return sign(z, opt, dnskeys, dnskeys, dnskeys, generator)
+}
+
+// sign publishes DNSKEYs and CDS/CDNSKEY of KSKs in dsKeys, and signs zone by signing keys.
+func sign(z ZoneInterface, opt SignOption, published, signing, dsKeys []*DNSKEY, generator Generator) error {
+	if err := addDNSKEY(z, opt, published, dsKeys, generator); err != nil {
 		return fmt.Errorf("failed to add DNSKEY: %w", err)
 	}
 	if opt.GetZONEMDEnabled() {
@@ -155,14 +191,14 @@ func Sign(z ZoneInterface, opt SignOption, dnskeys []*DNSKEY, generator Generato
 	if err := CreateDoE(z, opt, generator); err != nil {
 		return fmt.Errorf("failed to add NSEC or NSEC3: %w", err)
 	}
-	if err := SignZone(z, opt, dnskeys, generator); err != nil {
+	if err := SignZone(z, opt, signing, generator); err != nil {
 		return fmt.Errorf("failed to sign zone: %w", err)
 	}
 	if opt.GetZONEMDEnabled() {
 		if err := UpdateZONEMDDigest(z, generator); err != nil {
 			return fmt.Errorf("failed to update ZONEMD digest: %w", err)
 		}
-		if err := SignNode(z.GetRootNode(), opt, dnskeys, generator, true, true); err != nil {
+		if err := SignNode(z.GetRootNode(), opt, signing, generator, true, true); err != nil {
 			return fmt.Errorf("failed to sign zone apex: %w", err)
 		}
 	}
@@ -170,6 +206,12 @@ func Sign(z ZoneInterface, opt SignOption, dnskeys []*DNSKEY, generator Generato
 }
 
 func AddDNSKEY(z ZoneInterface, opt SignOption, dnskeys []*DNSKEY, generator Generator) error {
+	return addDNSKEY(z, opt, dnskeys, dnskeys, generator)
+}
+
+// addDNSKEY adds dnskeys to DNSKEY rrset, and CDS and CDNSKEY of KSKs in dsKeys.
+// dsKeys need not be in dnskeys. (double-DS KSK rollover)
+func addDNSKEY(z ZoneInterface, opt SignOption, dnskeys, dsKeys []*DNSKEY, generator Generator) error {
 	if len(dnskeys) == 0 {
 		return fmt.Errorf("empty DNSKEYs")
 	}
@@ -191,6 +233,10 @@ func AddDNSKEY(z ZoneInterface, opt SignOption, dnskeys []*DNSKEY, generator Gen
 		if err := rrset.AddRR(rr); err != nil {
 			return fmt.Errorf("failed to add DNSKEY RR to rrset: %w", err)
 		}
+	}
+	for _, dnskey := range dsKeys {
+		rr := dnskey.GetRR()
+		rr.Hdr.Ttl = rrset.GetTTL()
 		if opt.GetCDSEnabled() && dnskey.IsKSK() {
 			if err := cdsRRSet.AddRR(rr.ToDS(dns.SHA256).ToCDS()); err != nil {
 				return fmt.Errorf("failed to add CDS RR to rrset: %w", err)
@@ -273,24 +319,37 @@ func SignNode(nni NameNodeInterface, opt SignOption, dnskeys []*DNSKEY, generato
 func SignRRSet(ri RRSetInterface, opt SignOption, dnskeys []*DNSKEY) ([]*dns.RRSIG, error) {
 	var rrs []*dns.RRSIG
 	for _, dnskey := range dnskeys {
-		if (ri.GetRRtype() == dns.TypeDNSKEY && dnskey.IsKSK()) ||
-			(ri.GetRRtype() != dns.TypeDNSKEY && dnskey.IsZSK()) {
-			rrsig := &dns.RRSIG{
-				Hdr: dns.RR_Header{
-					Ttl: ri.GetTTL(),
-				},
-				KeyTag:     dnskey.GetRR().KeyTag(),
-				SignerName: dnskey.GetRR().Header().Name,
-				Algorithm:  dnskey.GetRR().Algorithm,
-				Inception:  opt.GetInception(),
-				Expiration: opt.GetExpiration(),
-			}
-
-			if err := rrsig.Sign(dnskey.GetSigner(), ri.GetRRs()); err != nil {
-				return nil, fmt.Errorf("failed to sign: %w", err)
+		if isSigningKey(ri, dnskey) {
+			rrsig, err := signRRSetWithKey(ri, opt, dnskey)
+			if err != nil {
+				return nil, err
 			}
 			rrs = append(rrs, rrsig)
 		}
 	}
 	return rrs, nil
 }
+
+// isSigningKey returns true if dnskey signs rrset.
+// KSK signs DNSKEY rrset, and ZSK signs other rrsets.
+func isSigningKey(ri RRSetInterface, dnskey *DNSKEY) bool {
+	return (ri.GetRRtype() == dns.TypeDNSKEY && dnskey.IsKSK()) ||
+		(ri.GetRRtype() != dns.TypeDNSKEY && dnskey.IsZSK())
+}
+
+func signRRSetWithKey(ri RRSetInterface, opt SignOption, dnskey *DNSKEY) (*dns.RRSIG, error) {
+	rrsig := &dns.RRSIG{
+		Hdr: dns.RR_Header{
+			Ttl: ri.GetTTL(),
+		},
+		KeyTag:     dnskey.GetRR().KeyTag(),
+		SignerName: dnskey.GetRR().Header().Name,
+		Algorithm:  dnskey.GetRR().Algorithm,
+		Inception:  opt.GetInception(),
+		Expiration: opt.GetExpiration(),
+	}
+	if err := rrsig.Sign(dnskey.GetSigner(), ri.GetRRs()); err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return rrsig, nil
+}
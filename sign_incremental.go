@@ -0,0 +1,203 @@
+package dnsutils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// SignResult is number of RRSIGs processed by SignIncremental.
+type SignResult struct {
+	// Kept is number of RRSIGs which are kept.
+	Kept int
+	// Created is number of RRSIGs which are newly generated.
+	Created int
+	// Removed is number of RRSIGs which are dropped.
+	// It includes RRSIGs replaced by new ones and RRSIGs of inactive keys.
+	Removed int
+}
+
+// SignIncremental signs zone keeping existing RRSIGs as far as possible.
+// An existing RRSIG is kept when its key is in dnskeys, it still verifies the current rrset
+// and it is valid until the refresh window (SignOption.Refresh) before expiration.
+// Other RRSIGs are removed, and missing RRSIGs are generated.
+// NSEC or NSEC3 chain and ZONEMD are rebuilt.
+func SignIncremental(z ZoneInterface, opt SignOption, dnskeys []*DNSKEY, generator Generator) (*SignResult, error) {
+	if generator == nil {
+		generator = &DefaultGenerator{}
+	}
+	if len(dnskeys) == 0 {
+		return nil, fmt.Errorf("empty DNSKEYs")
+	}
+	olds, total, err := collectRRSIGs(z.GetRootNode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get RRSIGs: %w", err)
+	}
+	if err := AddDNSKEY(z, opt, dnskeys, generator); err != nil {
+		return nil, fmt.Errorf("failed to add DNSKEY: %w", err)
+	}
+	res, err := signWithRRSIGs(z, olds, opt, dnskeys, generator)
+	if err != nil {
+		return nil, err
+	}
+	res.Removed = total - res.Kept
+	return res, nil
+}
+
+// signWithRRSIGs removes signatures of zone and signs it again.
+// RRSIGs in olds are reused when findReusableRRSIG accepts them.
+func signWithRRSIGs(z ZoneInterface, olds map[string][]*dns.RRSIG, opt SignOption, dnskeys []*DNSKEY, generator Generator) (*SignResult, error) {
+	if err := stripSignature(z); err != nil {
+		return nil, fmt.Errorf("failed to remove signatures: %w", err)
+	}
+	if opt.GetZONEMDEnabled() {
+		if err := AddZONEMDPlaceholder(z, nil, generator); err != nil {
+			return nil, fmt.Errorf("failed to add ZONEMD: %w", err)
+		}
+	}
+	if err := CreateDoE(z, opt, generator); err != nil {
+		return nil, fmt.Errorf("failed to add NSEC or NSEC3: %w", err)
+	}
+	res := &SignResult{}
+	now := time.Now()
+	err := z.GetRootNode().IterateNameNodeWithValue(func(nni NameNodeInterface, a any) (any, error) {
+		auth := a.(bool)
+		apex := nni == z.GetRootNode()
+		if !apex && nni.GetRRSet(dns.TypeNS) != nil {
+			return false, signNodeIncremental(nni, olds, opt, dnskeys, generator, now, res, false)
+		}
+		if !auth {
+			return false, nil
+		}
+		return true, signNodeIncremental(nni, olds, opt, dnskeys, generator, now, res, apex)
+	}, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign zone: %w", err)
+	}
+	if opt.GetZONEMDEnabled() {
+		if err := UpdateZONEMDDigest(z, generator); err != nil {
+			return nil, fmt.Errorf("failed to update ZONEMD digest: %w", err)
+		}
+		apex := z.GetRootNode()
+		rrsigs, err := refreshRRSIGs(apex.GetRRSet(dns.TypeZONEMD), olds[dns.CanonicalName(apex.GetName())], opt, dnskeys, now, res, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign ZONEMD: %w", err)
+		}
+		if err := setRRSIGs(apex, rrsigs, generator); err != nil {
+			return nil, fmt.Errorf("failed to sign ZONEMD: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// collectRRSIGs returns RRSIGs of name node tree by canonical owner name and number of them.
+func collectRRSIGs(root NameNodeInterface) (map[string][]*dns.RRSIG, int, error) {
+	olds := map[string][]*dns.RRSIG{}
+	total := 0
+	err := root.IterateNameNode(func(nni NameNodeInterface) error {
+		rrsigs, err := GetTyped[*dns.RRSIG](nni, dns.TypeRRSIG)
+		if err != nil {
+			return err
+		}
+		if len(rrsigs) > 0 {
+			olds[dns.CanonicalName(nni.GetName())] = rrsigs
+			total += len(rrsigs)
+		}
+		return nil
+	})
+	return olds, total, err
+}
+
+func signNodeIncremental(nni NameNodeInterface, olds map[string][]*dns.RRSIG, opt SignOption, dnskeys []*DNSKEY, generator Generator, now time.Time, res *SignResult, apex bool) error {
+	var rrsigs []*dns.RRSIG
+	err := nni.IterateNameRRSet(func(ri RRSetInterface) error {
+		if ri.GetRRtype() == dns.TypeNS && !apex {
+			return nil
+		}
+		if ri.GetRRtype() == dns.TypeRRSIG || ri.Len() == 0 {
+			return nil
+		}
+		// ZONEMD is signed after updating digest
+		if ri.GetRRtype() == dns.TypeZONEMD && apex && opt.GetZONEMDEnabled() {
+			return nil
+		}
+		rrs, err := refreshRRSIGs(ri, olds[dns.CanonicalName(nni.GetName())], opt, dnskeys, now, res, true)
+		if err != nil {
+			return err
+		}
+		rrsigs = append(rrsigs, rrs...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign rrset: %w", err)
+	}
+	return setRRSIGs(nni, rrsigs, generator)
+}
+
+// refreshRRSIGs returns RRSIGs of rrset.
+// For each signing key, a reusable RRSIG in olds is kept, otherwise a new one is generated.
+// If verify is false, signatures of olds are trusted without verification.
+func refreshRRSIGs(ri RRSetInterface, olds []*dns.RRSIG, opt SignOption, dnskeys []*DNSKEY, now time.Time, res *SignResult, verify bool) ([]*dns.RRSIG, error) {
+	if IsEmptyRRSet(ri) {
+		return nil, nil
+	}
+	var rrsigs []*dns.RRSIG
+	for _, dnskey := range dnskeys {
+		if !isSigningKey(ri, dnskey) {
+			continue
+		}
+		if rrsig := findReusableRRSIG(ri, olds, dnskey, now, opt.GetRefresh(), verify); rrsig != nil {
+			rrsigs = append(rrsigs, rrsig)
+			res.Kept++
+			continue
+		}
+		rrsig, err := signRRSetWithKey(ri, opt, dnskey)
+		if err != nil {
+			return nil, err
+		}
+		rrsigs = append(rrsigs, rrsig)
+		res.Created++
+	}
+	return rrsigs, nil
+}
+
+func findReusableRRSIG(ri RRSetInterface, olds []*dns.RRSIG, dnskey *DNSKEY, now time.Time, refresh time.Duration, verify bool) *dns.RRSIG {
+	key := dnskey.GetRR()
+	for _, rrsig := range olds {
+		if rrsig.TypeCovered != ri.GetRRtype() ||
+			rrsig.KeyTag != key.KeyTag() ||
+			rrsig.Algorithm != key.Algorithm ||
+			!Equals(rrsig.SignerName, key.Header().Name) {
+			continue
+		}
+		if rrsig.OrigTtl != ri.GetTTL() || rrsig.Hdr.Ttl != ri.GetTTL() {
+			continue
+		}
+		if !rrsig.ValidityPeriod(now) || !rrsig.ValidityPeriod(now.Add(refresh)) {
+			continue
+		}
+		if verify && rrsig.Verify(key, ri.GetRRs()) != nil {
+			continue
+		}
+		return rrsig
+	}
+	return nil
+}
+
+// setRRSIGs adds rrsigs to RRSIG rrset of name node.
+func setRRSIGs(nni NameNodeInterface, rrsigs []*dns.RRSIG, generator Generator) error {
+	if len(rrsigs) == 0 {
+		return nil
+	}
+	set, err := GetRRSetOrCreate(nni, dns.TypeRRSIG, 0, generator)
+	if err != nil {
+		return err
+	}
+	for _, rrsig := range rrsigs {
+		if err := set.AddRR(rrsig); err != nil {
+			return err
+		}
+	}
+	return nni.SetRRSet(set)
+}
@@ -0,0 +1,128 @@
+package dnsutils_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test sign_incremental.go", func() {
+	var (
+		z          *dnsutils.Zone
+		dnskeys    []*dnsutils.DNSKEY
+		inception  = uint32(1704067200)
+		inception2 = uint32(1704153600)
+		expiration = uint32(1893456000)
+		opt        dnsutils.SignOption
+		newA       = testtool.MustNewRR("new.example.jp. 3600 IN A 192.168.0.2")
+	)
+	readZone := func() *dnsutils.Zone {
+		z := &dnsutils.Zone{}
+		Expect(z.Read(bytes.NewBuffer(testSignZone))).To(Succeed())
+		return z
+	}
+	change := func(z *dnsutils.Zone) {
+		nn, err := dnsutils.GetNameNodeOrCreate(z.GetRootNode(), "new.example.jp.", nil)
+		Expect(err).To(Succeed())
+		Expect(nn.SetRRSet(dnsutils.NewRRSetFromRR(newA))).To(Succeed())
+		Expect(dnsutils.SetNameNode(z.GetRootNode(), nn, nil)).To(Succeed())
+	}
+	countRRSIGs := func(z *dnsutils.Zone, match func(*dns.RRSIG) bool) int {
+		n := 0
+		z.GetRootNode().IterateNameNode(func(nni dnsutils.NameNodeInterface) error {
+			rrsigs, err := dnsutils.GetTyped[*dns.RRSIG](nni, dns.TypeRRSIG)
+			Expect(err).To(Succeed())
+			for _, rrsig := range rrsigs {
+				if match(rrsig) {
+					n++
+				}
+			}
+			return nil
+		})
+		return n
+	}
+	all := func(*dns.RRSIG) bool { return true }
+	BeforeEach(func() {
+		ksk, err := dnsutils.ReadDNSKEY(bytes.NewBuffer(testDnskeyED25519KSKPriv), bytes.NewBuffer(testDnskeyED25519KSKPub))
+		Expect(err).To(Succeed())
+		zsk, err := dnsutils.ReadDNSKEY(bytes.NewBuffer(testDnskeyED25519ZSKPriv), bytes.NewBuffer(testDnskeyED25519ZSKPub))
+		Expect(err).To(Succeed())
+		dnskeys = []*dnsutils.DNSKEY{ksk, zsk}
+		opt = dnsutils.SignOption{
+			DoEMethod:     dnsutils.DenialOfExistenceMethodNSEC,
+			Inception:     &inception,
+			Expiration:    &expiration,
+			ZONEMDEnabled: &True,
+			CDSEnabled:    &False,
+		}
+		z = readZone()
+	})
+	Context("SignIncremental", func() {
+		When("zone is not signed", func() {
+			It("returns the same zone as full signing", func() {
+				res, err := dnsutils.SignIncremental(z, opt, dnskeys, nil)
+				Expect(err).To(Succeed())
+				expected := readZone()
+				Expect(dnsutils.Sign(expected, opt, dnskeys, nil)).To(Succeed())
+				Expect(dnsutils.IsEqualsAllTree(z.GetRootNode(), expected.GetRootNode(), true)).To(BeTrue())
+				Expect(res).To(Equal(&dnsutils.SignResult{Created: countRRSIGs(z, all)}))
+			})
+		})
+		When("zone is signed", func() {
+			var total int
+			BeforeEach(func() {
+				Expect(dnsutils.Sign(z, opt, dnskeys, nil)).To(Succeed())
+				total = countRRSIGs(z, all)
+				opt.Inception = &inception2
+			})
+			It("keeps all valid RRSIGs", func() {
+				res, err := dnsutils.SignIncremental(z, opt, dnskeys, nil)
+				Expect(err).To(Succeed())
+				Expect(res).To(Equal(&dnsutils.SignResult{Kept: total}))
+				Expect(countRRSIGs(z, func(rrsig *dns.RRSIG) bool { return rrsig.Inception == inception2 })).To(Equal(0))
+				ok, err := dnsutils.VerifyAnyZONEMDDigest(z)
+				Expect(err).To(Succeed())
+				Expect(ok).To(BeTrue())
+			})
+			It("regenerates RRSIGs of changed rrsets", func() {
+				change(z)
+				res, err := dnsutils.SignIncremental(z, opt, dnskeys, nil)
+				Expect(err).To(Succeed())
+				// new A, new NSEC, previous NSEC, ZONEMD
+				Expect(res.Created).To(Equal(4))
+				Expect(res.Removed).To(Equal(2))
+				Expect(res.Kept).To(Equal(total - 2))
+				Expect(countRRSIGs(z, func(rrsig *dns.RRSIG) bool { return rrsig.Inception == inception2 })).To(Equal(4))
+				ok, err := dnsutils.VerifyAnyZONEMDDigest(z)
+				Expect(err).To(Succeed())
+				Expect(ok).To(BeTrue())
+			})
+			It("regenerates RRSIGs in refresh window", func() {
+				refresh := time.Duration(expiration-uint32(time.Now().Unix())+3600) * time.Second
+				opt.Refresh = &refresh
+				res, err := dnsutils.SignIncremental(z, opt, dnskeys, nil)
+				Expect(err).To(Succeed())
+				Expect(res).To(Equal(&dnsutils.SignResult{Created: total, Removed: total}))
+				Expect(countRRSIGs(z, func(rrsig *dns.RRSIG) bool { return rrsig.Inception == inception2 })).To(Equal(total))
+			})
+			It("removes RRSIGs of inactive keys", func() {
+				dnskeys = dnskeys[:1]
+				res, err := dnsutils.SignIncremental(z, opt, dnskeys, nil)
+				Expect(err).To(Succeed())
+				Expect(res).To(Equal(&dnsutils.SignResult{Kept: 1, Removed: total - 1}))
+				Expect(countRRSIGs(z, all)).To(Equal(1))
+			})
+		})
+		When("DNSKEYs are empty", func() {
+			It("returns error", func() {
+				_, err := dnsutils.SignIncremental(z, opt, nil, nil)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
@@ -37,3 +37,17 @@ func MustNewZone(name string, class dns.Class) *dnsutils.Zone {
 	}
 	return zone
 }
+
+// MustSignMsg returns copy of msg which has TSIG MAC generated by provider.
+// msg must have TSIG RR by dns.Msg.SetTsig.
+func MustSignMsg(msg *dns.Msg, provider dns.TsigProvider) *dns.Msg {
+	bs, _, err := dns.TsigGenerateWithProvider(msg, provider, "", false)
+	if err != nil {
+		panic(err)
+	}
+	signed := &dns.Msg{}
+	if err := signed.Unpack(bs); err != nil {
+		panic(err)
+	}
+	return signed
+}
@@ -3,10 +3,12 @@ package testtool_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/mimuret/dnsutils"
 	. "github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/tsig"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -66,6 +68,31 @@ var _ = Describe("testtool", func() {
 			})
 		})
 	})
+	Context("MustSignMsg", func() {
+		var kr *tsig.KeyRing
+		BeforeEach(func() {
+			var err error
+			kr, err = tsig.NewKeyRing(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})
+			Expect(err).To(Succeed())
+		})
+		When("msg has no TSIG", func() {
+			It("raises panic", func() {
+				Expect(func() { MustSignMsg(&dns.Msg{}, kr) }).Should(Panic())
+			})
+		})
+		When("msg has TSIG", func() {
+			It("returns signed msg", func() {
+				msg := &dns.Msg{}
+				msg.SetQuestion("example.jp.", dns.TypeSOA)
+				msg.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+				signed := MustSignMsg(msg, kr)
+				Expect(signed.IsTsig().MAC).NotTo(BeEmpty())
+				bs, err := signed.Pack()
+				Expect(err).To(Succeed())
+				Expect(dns.TsigVerifyWithProvider(bs, kr, "", false)).To(Succeed())
+			})
+		})
+	})
 	Context("TestGenerator", func() {
 		var (
 			g   *TestGenerator
@@ -0,0 +1,184 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+)
+
+var (
+	// ErrHistoryNotFound returns when difference sequences for requested serial are not available.
+	ErrHistoryNotFound = fmt.Errorf("history not found")
+)
+
+// Diff is a difference sequence of IXFR (rfc1995).
+type Diff struct {
+	// OldSOA is SOA before change
+	OldSOA *dns.SOA
+	// Deleted is RRs which are deleted
+	Deleted []dns.RR
+	// NewSOA is SOA after change
+	NewSOA *dns.SOA
+	// Added is RRs which are added
+	Added []dns.RR
+}
+
+// RRs returns RRs of difference sequence in IXFR order.
+func (d *Diff) RRs() []dns.RR {
+	rrs := make([]dns.RR, 0, len(d.Deleted)+len(d.Added)+2)
+	rrs = append(rrs, d.OldSOA)
+	rrs = append(rrs, d.Deleted...)
+	rrs = append(rrs, d.NewSOA)
+	rrs = append(rrs, d.Added...)
+	return rrs
+}
+
+// HistoryProvider provides difference sequences of zone.
+type HistoryProvider interface {
+	// GetDiffs returns difference sequences from serial to the latest.
+	// If they are not available, it returns ErrHistoryNotFound.
+	GetDiffs(zone string, serial uint32) ([]*Diff, error)
+}
+
+// MemoryHistory is in-memory implement of HistoryProvider.
+// It keeps at most Max difference sequences per zone. If Max is 0, it is unlimited.
+type MemoryHistory struct {
+	Max   int
+	mu    sync.RWMutex
+	diffs map[string][]*Diff
+}
+
+// NewMemoryHistory creates MemoryHistory.
+func NewMemoryHistory(max int) *MemoryHistory {
+	return &MemoryHistory{Max: max, diffs: map[string][]*Diff{}}
+}
+
+// AddDiff adds difference sequence of zone.
+// If d.OldSOA serial is not equal to the latest serial, old history is discarded.
+func (h *MemoryHistory) AddDiff(zone string, d *Diff) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.diffs == nil {
+		h.diffs = map[string][]*Diff{}
+	}
+	zone = dns.CanonicalName(zone)
+	diffs := h.diffs[zone]
+	if len(diffs) > 0 && diffs[len(diffs)-1].NewSOA.Serial != d.OldSOA.Serial {
+		diffs = nil
+	}
+	diffs = append(diffs, d)
+	if h.Max > 0 && len(diffs) > h.Max {
+		diffs = diffs[len(diffs)-h.Max:]
+	}
+	h.diffs[zone] = diffs
+}
+
+// GetDiffs is implement of HistoryProvider.GetDiffs
+func (h *MemoryHistory) GetDiffs(zone string, serial uint32) ([]*Diff, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	diffs := h.diffs[dns.CanonicalName(zone)]
+	for i, d := range diffs {
+		if d.OldSOA.Serial == serial {
+			return append([]*Diff(nil), diffs[i:]...), nil
+		}
+	}
+	return nil, ErrHistoryNotFound
+}
+
+// GetIXFRSerial returns client SOA serial from authority section of IXFR request.
+func GetIXFRSerial(q *dns.Msg) (uint32, bool) {
+	if len(q.Question) == 0 {
+		return 0, false
+	}
+	for _, rr := range q.Ns {
+		if soa, ok := rr.(*dns.SOA); ok && dnsutils.Equals(soa.Hdr.Name, q.Question[0].Name) {
+			return soa.Serial, true
+		}
+	}
+	return 0, false
+}
+
+// TransferZoneIXFR transfers zone for IXFR request.
+// If client SOA serial is not older than zone, it sends single SOA.
+// If difference sequences from client serial are available from hp, it sends them.
+// Otherwise, it sends AXFR-style response (rfc1995#section-4).
+// Over UDP, when the response does not fit in a message or it is AXFR-style,
+// it sends single SOA so that client retries over TCP (rfc1995#section-2).
+func TransferZoneIXFR(z dnsutils.ZoneInterface, hp HistoryProvider, w dns.ResponseWriter, q *dns.Msg, tr *dns.Transfer) error {
+	soa, err := dnsutils.GetSOA(z)
+	if err != nil {
+		return err
+	}
+	udp := w.LocalAddr() != nil && w.LocalAddr().Network() == "udp"
+	axfrStyle := func() error {
+		if udp {
+			return transferRRs(w, q, tr, []dns.RR{soa})
+		}
+		return TransferZone(z, w, q, tr)
+	}
+	serial, ok := GetIXFRSerial(q)
+	if !ok {
+		return axfrStyle()
+	}
+	if dnsutils.CompareSerial(serial, soa.Serial) >= 0 {
+		return transferRRs(w, q, tr, []dns.RR{soa})
+	}
+	if hp == nil {
+		return axfrStyle()
+	}
+	diffs, err := hp.GetDiffs(z.GetName(), serial)
+	if errors.Is(err, ErrHistoryNotFound) {
+		return axfrStyle()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get history: %w", err)
+	}
+	if !isValidDiffs(diffs, serial, soa.Serial) {
+		return axfrStyle()
+	}
+	rrs := []dns.RR{soa}
+	for _, d := range diffs {
+		rrs = append(rrs, d.RRs()...)
+	}
+	rrs = append(rrs, soa)
+	if udp && !fitUDP(q, rrs) {
+		rrs = []dns.RR{soa}
+	}
+	return transferRRs(w, q, tr, rrs)
+}
+
+func transferRRs(w dns.ResponseWriter, q *dns.Msg, tr *dns.Transfer, rrs []dns.RR) error {
+	t := NewTransfer(tr)
+	t.Start(w, q)
+	t.SendRR(rrs)
+	return t.Finish()
+}
+
+func isValidDiffs(diffs []*Diff, from, to uint32) bool {
+	if len(diffs) == 0 {
+		return false
+	}
+	serial := from
+	for _, d := range diffs {
+		if d.OldSOA == nil || d.NewSOA == nil || d.OldSOA.Serial != serial {
+			return false
+		}
+		serial = d.NewSOA.Serial
+	}
+	return serial == to
+}
+
+func fitUDP(q *dns.Msg, rrs []dns.RR) bool {
+	size := dns.MinMsgSize
+	if opt := q.IsEdns0(); opt != nil && int(opt.UDPSize()) > size {
+		size = int(opt.UDPSize())
+	}
+	m := &dns.Msg{}
+	m.SetReply(q)
+	m.Answer = rrs
+	return m.Len() <= size
+}
@@ -0,0 +1,301 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+)
+
+var (
+	// ErrIXFRFormat returns when IXFR response is not valid.
+	ErrIXFRFormat = fmt.Errorf("invalid IXFR response")
+	// ErrIXFRSOAOnly returns when IXFR response is single SOA which is newer than client serial.
+	// It means the response does not fit in UDP message, client should retry over TCP.
+	ErrIXFRSOAOnly = fmt.Errorf("IXFR response has only newer SOA")
+	// ErrSerialMismatch returns when SOA serial of zone does not match the difference sequence.
+	ErrSerialMismatch = fmt.Errorf("serial mismatch")
+)
+
+// IXFRResultType is type of IXFR response.
+type IXFRResultType int
+
+const (
+	// IXFRUpToDate means the zone is up to date.
+	IXFRUpToDate IXFRResultType = iota
+	// IXFRIncremental means the response has difference sequences.
+	IXFRIncremental
+	// IXFRFull means the response is AXFR-style.
+	IXFRFull
+)
+
+// IXFRResult is parsed IXFR response.
+type IXFRResult struct {
+	Type IXFRResultType
+	// SOA is the latest SOA of primary.
+	SOA *dns.SOA
+	// Diffs is difference sequences. It is set when Type is IXFRIncremental.
+	Diffs []*Diff
+	// Zone is transferred zone. It is set when Type is IXFRFull.
+	Zone *dnsutils.Zone
+}
+
+// IXFRIn requests IXFR with SOA of z to addr and applies the response to z.
+// Changes are applied all at once or not at all.
+// If opt is nil, default option is used.
+func IXFRIn(z dnsutils.ZoneInterface, addr string, opt *InOption) (*IXFRResult, error) {
+	soa, err := dnsutils.GetSOA(z)
+	if err != nil {
+		return nil, err
+	}
+	q := &dns.Msg{}
+	q.SetIxfr(z.GetName(), soa.Serial, soa.Ns, soa.Mbox)
+	q.Question[0].Qclass = uint16(z.GetClass())
+	return IXFRInWithMsg(z, q, addr, opt)
+}
+
+// IXFRInWithMsg requests IXFR by q to addr and applies the response to z.
+// It is used for TSIG signed request.
+func IXFRInWithMsg(z dnsutils.ZoneInterface, q *dns.Msg, addr string, opt *InOption) (*IXFRResult, error) {
+	if opt == nil {
+		opt = &InOption{}
+	}
+	serial, ok := GetIXFRSerial(q)
+	if !ok {
+		return nil, fmt.Errorf("IXFR request has no SOA")
+	}
+	envCh, err := opt.getTransfer().In(q, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request IXFR: %w", err)
+	}
+	var rrs []dns.RR
+	for env := range envCh {
+		if env.Error != nil {
+			return nil, fmt.Errorf("failed to transfer: %w", env.Error)
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	o := *opt
+	o.Class = z.GetClass()
+	res, err := ParseIXFR(z.GetName(), serial, rrs, &o)
+	if err != nil {
+		return nil, err
+	}
+	if err := ApplyIXFR(z, res, &o); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ParseIXFR parses IXFR response RRs.
+// serial is the client SOA serial in IXFR request.
+// It checks that serials of difference sequences are continuous from serial to the latest.
+func ParseIXFR(zone string, serial uint32, rrs []dns.RR, opt *InOption) (*IXFRResult, error) {
+	if opt == nil {
+		opt = &InOption{}
+	}
+	zone = dns.CanonicalName(zone)
+	isSOA := func(rr dns.RR) (*dns.SOA, bool) {
+		soa, ok := rr.(*dns.SOA)
+		if !ok || !dnsutils.Equals(soa.Hdr.Name, zone) {
+			return nil, false
+		}
+		return soa, true
+	}
+	if len(rrs) == 0 {
+		return nil, fmt.Errorf("%w: empty response", ErrIXFRFormat)
+	}
+	latest, ok := isSOA(rrs[0])
+	if !ok {
+		return nil, fmt.Errorf("%w: first RR is not SOA", ErrIXFRFormat)
+	}
+	res := &IXFRResult{SOA: latest}
+	if len(rrs) == 1 {
+		if dnsutils.CompareSerial(serial, latest.Serial) >= 0 {
+			res.Type = IXFRUpToDate
+			return res, nil
+		}
+		return nil, ErrIXFRSOAOnly
+	}
+	if second, ok := isSOA(rrs[1]); !ok || second.Serial == latest.Serial {
+		// AXFR-style
+		envCh := make(chan *dns.Envelope, 1)
+		envCh <- &dns.Envelope{RR: rrs}
+		close(envCh)
+		z, err := ReadAXFR(zone, envCh, opt)
+		if err != nil {
+			return nil, err
+		}
+		res.Type = IXFRFull
+		res.Zone = z
+		return res, nil
+	}
+
+	res.Type = IXFRIncremental
+	cur := serial
+	i := 1
+	for {
+		if i == len(rrs)-1 {
+			// last SOA
+			if soa, ok := isSOA(rrs[i]); ok && dns.IsDuplicate(soa, latest) && cur == latest.Serial {
+				return res, nil
+			}
+			return nil, fmt.Errorf("%w: last SOA is different", ErrIXFRFormat)
+		}
+		oldSOA, ok := isSOA(rrs[i])
+		if !ok {
+			return nil, fmt.Errorf("%w: difference sequence does not start with SOA", ErrIXFRFormat)
+		}
+		if oldSOA.Serial != cur {
+			return nil, fmt.Errorf("%w: expected serial %d, got %d", ErrSerialMismatch, cur, oldSOA.Serial)
+		}
+		d := &Diff{OldSOA: oldSOA}
+		for i++; i < len(rrs); i++ {
+			if soa, ok := isSOA(rrs[i]); ok {
+				d.NewSOA = soa
+				break
+			}
+			d.Deleted = append(d.Deleted, rrs[i])
+		}
+		if d.NewSOA == nil {
+			return nil, fmt.Errorf("%w: new SOA not found", ErrIXFRFormat)
+		}
+		for i++; i < len(rrs); i++ {
+			if _, ok := isSOA(rrs[i]); ok {
+				break
+			}
+			d.Added = append(d.Added, rrs[i])
+		}
+		if i >= len(rrs) {
+			return nil, fmt.Errorf("%w: last SOA not found", ErrIXFRFormat)
+		}
+		if dnsutils.CompareSerial(d.NewSOA.Serial, d.OldSOA.Serial) <= 0 {
+			return nil, fmt.Errorf("%w: serial %d is not newer than %d", ErrSerialMismatch, d.NewSOA.Serial, d.OldSOA.Serial)
+		}
+		cur = d.NewSOA.Serial
+		res.Diffs = append(res.Diffs, d)
+	}
+}
+
+// ApplyIXFR applies IXFR result to z all at once.
+// When InOption.VerifyZONEMD is true, ZONEMD of new zone data is verified before applying.
+func ApplyIXFR(z dnsutils.ZoneInterface, res *IXFRResult, opt *InOption) error {
+	if opt == nil {
+		opt = &InOption{}
+	}
+	switch res.Type {
+	case IXFRUpToDate:
+		return nil
+	case IXFRFull:
+		return z.GetRootNode().SetValue(res.Zone.GetRootNode())
+	case IXFRIncremental:
+		return ApplyDiffs(z, res.Diffs, opt)
+	}
+	return fmt.Errorf("unknown IXFR result type %d", res.Type)
+}
+
+type workZone struct {
+	dnsutils.ZoneInterface
+	root dnsutils.NameNodeInterface
+}
+
+func (w *workZone) GetRootNode() dnsutils.NameNodeInterface { return w.root }
+
+// ApplyDiffs applies difference sequences to z all at once.
+// Changes are applied to copy of zone tree, and the tree is replaced when all difference sequences are applied.
+// It returns ErrSerialMismatch when SOA serial of zone does not match OldSOA of difference sequence.
+func ApplyDiffs(z dnsutils.ZoneInterface, diffs []*Diff, opt *InOption) error {
+	if opt == nil {
+		opt = &InOption{}
+	}
+	root, err := dnsutils.CopyNameNodeTree(z.GetRootNode(), opt.Generator)
+	if err != nil {
+		return fmt.Errorf("failed to copy zone: %w", err)
+	}
+	wz := &workZone{ZoneInterface: z, root: root}
+	for _, d := range diffs {
+		if err := applyDiff(wz, d, opt.Generator); err != nil {
+			return err
+		}
+	}
+	if opt.VerifyZONEMD {
+		ok, err := dnsutils.VerifyAnyZONEMDDigest(wz)
+		if errors.Is(err, dnsutils.ErrZONEMDVerifySkip) {
+			if opt.RequireZONEMD {
+				return fmt.Errorf("%w: ZONEMD not found", ErrZONEMDVerify)
+			}
+		} else if err != nil {
+			return fmt.Errorf("%w: %v", ErrZONEMDVerify, err)
+		} else if !ok {
+			return ErrZONEMDVerify
+		}
+	}
+	return z.GetRootNode().SetValue(root)
+}
+
+func applyDiff(z dnsutils.ZoneInterface, d *Diff, generator dnsutils.Generator) error {
+	if generator == nil {
+		generator = &dnsutils.DefaultGenerator{}
+	}
+	soa, err := dnsutils.GetSOA(z)
+	if err != nil {
+		return err
+	}
+	if soa.Serial != d.OldSOA.Serial {
+		return fmt.Errorf("%w: zone serial %d, difference sequence serial %d", ErrSerialMismatch, soa.Serial, d.OldSOA.Serial)
+	}
+	for _, rr := range d.Deleted {
+		nn, ok := z.GetRootNode().GetNameNode(rr.Header().Name)
+		if !ok {
+			return fmt.Errorf("%w: deleted RR not found: %s", ErrIXFRFormat, rr.String())
+		}
+		set := nn.GetRRSet(rr.Header().Rrtype)
+		if set == nil {
+			return fmt.Errorf("%w: deleted RR not found: %s", ErrIXFRFormat, rr.String())
+		}
+		l := set.Len()
+		if err := set.RemoveRR(rr); err != nil {
+			return fmt.Errorf("failed to remove RR: %w", err)
+		}
+		if set.Len() == l {
+			return fmt.Errorf("%w: deleted RR not found: %s", ErrIXFRFormat, rr.String())
+		}
+		if set.Len() == 0 {
+			if err := nn.RemoveRRSet(set.GetRRtype()); err != nil {
+				return fmt.Errorf("failed to remove rrset: %w", err)
+			}
+			continue
+		}
+		if err := nn.SetRRSet(set); err != nil {
+			return fmt.Errorf("failed to set rrset: %w", err)
+		}
+	}
+	rrs := append([]dns.RR{d.NewSOA}, d.Added...)
+	for _, rr := range rrs {
+		if !dns.IsSubDomain(z.GetName(), rr.Header().Name) {
+			return fmt.Errorf("%w: %s out of zone data", ErrIXFRFormat, rr.Header().Name)
+		}
+		nn, err := dnsutils.GetNameNodeOrCreate(z.GetRootNode(), rr.Header().Name, generator)
+		if err != nil {
+			return fmt.Errorf("failed to get name node: %w", err)
+		}
+		set := nn.GetRRSet(rr.Header().Rrtype)
+		if rr.Header().Rrtype == dns.TypeSOA || dnsutils.IsEmptyRRSet(set) {
+			set, err = generator.NewRRSet(rr.Header().Name, rr.Header().Ttl, dns.Class(rr.Header().Class), rr.Header().Rrtype)
+			if err != nil {
+				return fmt.Errorf("failed to create rrset: %w", err)
+			}
+		}
+		if err := set.AddRR(rr); err != nil {
+			return fmt.Errorf("failed to add RR %s: %w", rr.String(), err)
+		}
+		if err := nn.SetRRSet(set); err != nil {
+			return fmt.Errorf("failed to set rrset: %w", err)
+		}
+		if err := dnsutils.SetNameNode(z.GetRootNode(), nn, generator); err != nil {
+			return fmt.Errorf("failed to set name node: %w", err)
+		}
+	}
+	return nil
+}
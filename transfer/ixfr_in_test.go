@@ -0,0 +1,213 @@
+package transfer_test
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/transfer"
+
+	. "github.com/onsi/ginkgo"
+
+	. "github.com/onsi/gomega"
+)
+
+type ixfrPrimaryHandler struct {
+	z dnsutils.ZoneInterface
+	h transfer.HistoryProvider
+}
+
+func (h *ixfrPrimaryHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	transfer.TransferZoneIXFR(h.z, h.h, w, r, nil)
+}
+
+var _ = Describe("ixfr_in", func() {
+	var (
+		err       error
+		res       *transfer.IXFRResult
+		secondary *dnsutils.Zone
+		soa1      = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 1 3600 900 85400 300").(*dns.SOA)
+		soa2      = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 2 3600 900 85400 300").(*dns.SOA)
+		soa3      = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 3 3600 900 85400 300").(*dns.SOA)
+		help      = testtool.MustNewRR("help.example.jp. 3600 IN A 192.168.2.1")
+		newRR     = testtool.MustNewRR("new.example.jp. 3600 IN A 192.168.0.10")
+		mail      = testtool.MustNewRR("mail.example.jp. 3600 IN A 192.168.1.4")
+		d1, d2    *transfer.Diff
+	)
+	BeforeEach(func() {
+		secondary = &dnsutils.Zone{}
+		Expect(secondary.Read(bytes.NewBuffer(testZoneNormal))).To(Succeed())
+		d1 = &transfer.Diff{OldSOA: soa1, Deleted: []dns.RR{help}, NewSOA: soa2, Added: []dns.RR{newRR}}
+		d2 = &transfer.Diff{OldSOA: soa2, NewSOA: soa3, Added: []dns.RR{mail}}
+	})
+	Context("ParseIXFR", func() {
+		When("response is single SOA", func() {
+			It("returns IXFRUpToDate", func() {
+				res, err = transfer.ParseIXFR("example.jp.", 1, []dns.RR{soa1}, nil)
+				Expect(err).To(Succeed())
+				Expect(res.Type).To(Equal(transfer.IXFRUpToDate))
+			})
+			It("returns ErrIXFRSOAOnly when SOA is newer", func() {
+				_, err = transfer.ParseIXFR("example.jp.", 1, []dns.RR{soa2}, nil)
+				Expect(err).To(Equal(transfer.ErrIXFRSOAOnly))
+			})
+		})
+		When("response is AXFR-style", func() {
+			BeforeEach(func() {
+				res, err = transfer.ParseIXFR("example.jp.", 1, []dns.RR{soa3, help, soa3}, nil)
+			})
+			It("returns IXFRFull", func() {
+				Expect(err).To(Succeed())
+				Expect(res.Type).To(Equal(transfer.IXFRFull))
+				Expect(res.Zone).NotTo(BeNil())
+			})
+		})
+		When("response is difference sequences", func() {
+			BeforeEach(func() {
+				rrs := []dns.RR{soa3}
+				rrs = append(rrs, d1.RRs()...)
+				rrs = append(rrs, d2.RRs()...)
+				rrs = append(rrs, soa3)
+				res, err = transfer.ParseIXFR("example.jp.", 1, rrs, nil)
+			})
+			It("returns IXFRIncremental", func() {
+				Expect(err).To(Succeed())
+				Expect(res.Type).To(Equal(transfer.IXFRIncremental))
+				Expect(res.Diffs).To(Equal([]*transfer.Diff{d1, d2}))
+			})
+		})
+		When("serial is not continuous", func() {
+			BeforeEach(func() {
+				rrs := []dns.RR{soa3}
+				rrs = append(rrs, d2.RRs()...)
+				rrs = append(rrs, soa3)
+				_, err = transfer.ParseIXFR("example.jp.", 1, rrs, nil)
+			})
+			It("returns ErrSerialMismatch", func() {
+				Expect(err).To(MatchError(transfer.ErrSerialMismatch))
+			})
+		})
+		When("last SOA not found", func() {
+			BeforeEach(func() {
+				rrs := []dns.RR{soa3}
+				rrs = append(rrs, d1.RRs()...)
+				rrs = append(rrs, d2.RRs()...)
+				_, err = transfer.ParseIXFR("example.jp.", 1, rrs, nil)
+			})
+			It("returns ErrIXFRFormat", func() {
+				Expect(err).To(MatchError(transfer.ErrIXFRFormat))
+			})
+		})
+		When("first RR is not SOA", func() {
+			BeforeEach(func() {
+				_, err = transfer.ParseIXFR("example.jp.", 1, []dns.RR{help, soa3}, nil)
+			})
+			It("returns ErrIXFRFormat", func() {
+				Expect(err).To(MatchError(transfer.ErrIXFRFormat))
+			})
+		})
+	})
+	Context("ApplyDiffs", func() {
+		When("valid diffs", func() {
+			BeforeEach(func() {
+				err = transfer.ApplyDiffs(secondary, []*transfer.Diff{d1, d2}, nil)
+			})
+			It("applies all changes", func() {
+				Expect(err).To(Succeed())
+				soa, _ := dnsutils.GetSOA(secondary)
+				Expect(soa.Serial).To(Equal(uint32(3)))
+				_, ok := secondary.GetRootNode().GetNameNode("help.example.jp.")
+				Expect(ok).To(BeFalse())
+				nn, ok := secondary.GetRootNode().GetNameNode("new.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(nn.GetRRSet(dns.TypeA).GetRRs()).To(Equal([]dns.RR{newRR}))
+				nn, ok = secondary.GetRootNode().GetNameNode("mail.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(nn.GetRRSet(dns.TypeA).Len()).To(Equal(4))
+			})
+		})
+		When("zone serial does not match", func() {
+			BeforeEach(func() {
+				err = transfer.ApplyDiffs(secondary, []*transfer.Diff{d2}, nil)
+			})
+			It("returns ErrSerialMismatch", func() {
+				Expect(err).To(MatchError(transfer.ErrSerialMismatch))
+			})
+		})
+		When("second diff fails", func() {
+			BeforeEach(func() {
+				d2.Deleted = []dns.RR{testtool.MustNewRR("notexist.example.jp. 3600 IN A 192.168.0.1")}
+				err = transfer.ApplyDiffs(secondary, []*transfer.Diff{d1, d2}, nil)
+			})
+			It("does not change zone", func() {
+				Expect(err).To(MatchError(transfer.ErrIXFRFormat))
+				soa, _ := dnsutils.GetSOA(secondary)
+				Expect(soa.Serial).To(Equal(uint32(1)))
+				_, ok := secondary.GetRootNode().GetNameNode("help.example.jp.")
+				Expect(ok).To(BeTrue())
+				_, ok = secondary.GetRootNode().GetNameNode("new.example.jp.")
+				Expect(ok).To(BeFalse())
+			})
+		})
+	})
+	Context("IXFRIn", func() {
+		var (
+			primary *dnsutils.Zone
+			hist    *transfer.MemoryHistory
+			svc     *dns.Server
+			addr    string
+		)
+		BeforeEach(func() {
+			primary = &dnsutils.Zone{}
+			Expect(primary.Read(bytes.NewBuffer(testZoneNormal))).To(Succeed())
+			Expect(transfer.ApplyDiffs(primary, []*transfer.Diff{d1, d2}, nil)).To(Succeed())
+			hist = transfer.NewMemoryHistory(0)
+			hist.AddDiff("example.jp.", d1)
+			hist.AddDiff("example.jp.", d2)
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).To(Succeed())
+			addr = l.Addr().String()
+			startCh := make(chan struct{})
+			svc = &dns.Server{Listener: l, Net: "tcp", Handler: &ixfrPrimaryHandler{z: primary, h: hist}, NotifyStartedFunc: func() { close(startCh) }}
+			go svc.ActivateAndServe()
+			<-startCh
+		})
+		AfterEach(func() {
+			svc.Shutdown()
+		})
+		When("history is available", func() {
+			BeforeEach(func() {
+				res, err = transfer.IXFRIn(secondary, addr, nil)
+			})
+			It("applies difference sequences", func() {
+				Expect(err).To(Succeed())
+				Expect(res.Type).To(Equal(transfer.IXFRIncremental))
+				Expect(dnsutils.IsEqualsAllTree(secondary.GetRootNode(), primary.GetRootNode(), true)).To(BeTrue())
+			})
+		})
+		When("history is not available", func() {
+			BeforeEach(func() {
+				hist = transfer.NewMemoryHistory(0)
+				svc.Handler = &ixfrPrimaryHandler{z: primary, h: hist}
+				res, err = transfer.IXFRIn(secondary, addr, nil)
+			})
+			It("replaces zone by AXFR-style response", func() {
+				Expect(err).To(Succeed())
+				Expect(res.Type).To(Equal(transfer.IXFRFull))
+				Expect(dnsutils.IsEqualsAllTree(secondary.GetRootNode(), primary.GetRootNode(), true)).To(BeTrue())
+			})
+		})
+		When("zone is up to date", func() {
+			BeforeEach(func() {
+				Expect(transfer.ApplyDiffs(secondary, []*transfer.Diff{d1, d2}, nil)).To(Succeed())
+				res, err = transfer.IXFRIn(secondary, addr, nil)
+			})
+			It("returns IXFRUpToDate", func() {
+				Expect(err).To(Succeed())
+				Expect(res.Type).To(Equal(transfer.IXFRUpToDate))
+			})
+		})
+	})
+})
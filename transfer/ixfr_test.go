@@ -0,0 +1,202 @@
+package transfer_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/transfer"
+
+	. "github.com/onsi/ginkgo"
+
+	. "github.com/onsi/gomega"
+)
+
+type errHistory struct{}
+
+func (errHistory) GetDiffs(string, uint32) ([]*transfer.Diff, error) {
+	return nil, fmt.Errorf("error")
+}
+
+var _ = Describe("ixfr", func() {
+	var (
+		err  error
+		w    *testtool.ResponseWriter
+		z    *dnsutils.Zone
+		h    *transfer.MemoryHistory
+		req  *dns.Msg
+		soa1 = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 1 3600 900 85400 300").(*dns.SOA)
+		soa2 = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 2 3600 900 85400 300").(*dns.SOA)
+		soa3 = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 3 3600 900 85400 300").(*dns.SOA)
+		d1   = &transfer.Diff{
+			OldSOA:  soa1,
+			Deleted: []dns.RR{testtool.MustNewRR("old.example.jp. 3600 IN A 192.168.0.1")},
+			NewSOA:  soa2,
+			Added:   []dns.RR{testtool.MustNewRR("new.example.jp. 3600 IN A 192.168.0.1")},
+		}
+		d2 = &transfer.Diff{
+			OldSOA: soa2,
+			NewSOA: soa3,
+			Added:  []dns.RR{testtool.MustNewRR("new2.example.jp. 3600 IN A 192.168.0.1")},
+		}
+		answers = func() []dns.RR {
+			var rrs []dns.RR
+			for _, m := range w.Msgs {
+				rrs = append(rrs, m.Answer...)
+			}
+			return rrs
+		}
+		newReq = func(serial uint32) *dns.Msg {
+			m := &dns.Msg{}
+			m.SetIxfr("example.jp.", serial, "localhost.", "root.localhost.")
+			return m
+		}
+	)
+	BeforeEach(func() {
+		w = &testtool.ResponseWriter{LocalAddress: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}}
+		z = &dnsutils.Zone{}
+		Expect(z.Read(bytes.NewBuffer(testZoneNormal))).To(Succeed())
+		Expect(z.GetRootNode().SetRRSet(dnsutils.NewRRSetFromRR(soa3))).To(Succeed())
+		h = transfer.NewMemoryHistory(0)
+		h.AddDiff("example.jp.", d1)
+		h.AddDiff("example.jp.", d2)
+	})
+	Context("GetIXFRSerial", func() {
+		It("returns serial of authority SOA", func() {
+			serial, ok := transfer.GetIXFRSerial(newReq(10))
+			Expect(ok).To(BeTrue())
+			Expect(serial).To(Equal(uint32(10)))
+			req = &dns.Msg{}
+			req.SetAxfr("example.jp.")
+			_, ok = transfer.GetIXFRSerial(req)
+			Expect(ok).To(BeFalse())
+		})
+	})
+	Context("MemoryHistory", func() {
+		It("returns diffs from serial", func() {
+			diffs, err := h.GetDiffs("example.jp", 2)
+			Expect(err).To(Succeed())
+			Expect(diffs).To(Equal([]*transfer.Diff{d2}))
+			_, err = h.GetDiffs("example.jp", 3)
+			Expect(err).To(Equal(transfer.ErrHistoryNotFound))
+		})
+		It("keeps Max diffs", func() {
+			h = transfer.NewMemoryHistory(1)
+			h.AddDiff("example.jp.", d1)
+			h.AddDiff("example.jp.", d2)
+			_, err = h.GetDiffs("example.jp", 1)
+			Expect(err).To(Equal(transfer.ErrHistoryNotFound))
+		})
+		It("discards history when serial is not continuous", func() {
+			h = transfer.NewMemoryHistory(0)
+			h.AddDiff("example.jp.", d2)
+			h.AddDiff("example.jp.", d1)
+			_, err = h.GetDiffs("example.jp", 2)
+			Expect(err).To(Equal(transfer.ErrHistoryNotFound))
+		})
+	})
+	Context("TransferZoneIXFR", func() {
+		When("client is up to date", func() {
+			BeforeEach(func() {
+				err = transfer.TransferZoneIXFR(z, h, w, newReq(3), nil)
+			})
+			It("sends single SOA", func() {
+				Expect(err).To(Succeed())
+				Expect(answers()).To(Equal([]dns.RR{soa3}))
+			})
+		})
+		When("AXFR-style response is requested over UDP", func() {
+			BeforeEach(func() {
+				w.LocalAddress = &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+				err = transfer.TransferZoneIXFR(z, transfer.NewMemoryHistory(0), w, newReq(1), nil)
+			})
+			It("sends single SOA", func() {
+				Expect(err).To(Succeed())
+				Expect(answers()).To(Equal([]dns.RR{soa3}))
+			})
+		})
+		When("history is available", func() {
+			BeforeEach(func() {
+				err = transfer.TransferZoneIXFR(z, h, w, newReq(1), nil)
+			})
+			It("sends difference sequences", func() {
+				Expect(err).To(Succeed())
+				expect := []dns.RR{soa3}
+				expect = append(expect, d1.RRs()...)
+				expect = append(expect, d2.RRs()...)
+				expect = append(expect, soa3)
+				Expect(answers()).To(Equal(expect))
+			})
+		})
+		When("history is not available", func() {
+			BeforeEach(func() {
+				err = transfer.TransferZoneIXFR(z, h, w, newReq(0), nil)
+			})
+			It("sends AXFR-style response", func() {
+				Expect(err).To(Succeed())
+				rrs := answers()
+				Expect(len(rrs)).To(BeNumerically(">", 3))
+				Expect(rrs[0]).To(Equal(soa3))
+				Expect(rrs[1].Header().Rrtype).NotTo(Equal(dns.TypeSOA))
+				Expect(rrs[len(rrs)-1]).To(Equal(soa3))
+			})
+		})
+		When("history provider is nil", func() {
+			BeforeEach(func() {
+				err = transfer.TransferZoneIXFR(z, nil, w, newReq(1), nil)
+			})
+			It("sends AXFR-style response", func() {
+				Expect(err).To(Succeed())
+				Expect(answers()[1].Header().Rrtype).NotTo(Equal(dns.TypeSOA))
+			})
+		})
+		When("request has no SOA", func() {
+			BeforeEach(func() {
+				req = &dns.Msg{}
+				req.SetQuestion("example.jp.", dns.TypeIXFR)
+				err = transfer.TransferZoneIXFR(z, h, w, req, nil)
+			})
+			It("sends AXFR-style response", func() {
+				Expect(err).To(Succeed())
+				Expect(answers()[1].Header().Rrtype).NotTo(Equal(dns.TypeSOA))
+			})
+		})
+		When("history provider returns error", func() {
+			BeforeEach(func() {
+				err = transfer.TransferZoneIXFR(z, errHistory{}, w, newReq(1), nil)
+			})
+			It("returns error", func() {
+				Expect(err).To(HaveOccurred())
+			})
+		})
+		When("response does not fit UDP message", func() {
+			BeforeEach(func() {
+				w.LocalAddress = &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+				d := &transfer.Diff{OldSOA: soa2, NewSOA: soa3}
+				for i := 0; i < 50; i++ {
+					d.Added = append(d.Added, testtool.MustNewRR(fmt.Sprintf("host%d.example.jp. 3600 IN A 192.168.0.1", i)))
+				}
+				h = transfer.NewMemoryHistory(0)
+				h.AddDiff("example.jp.", d)
+				err = transfer.TransferZoneIXFR(z, h, w, newReq(2), nil)
+			})
+			It("sends single SOA", func() {
+				Expect(err).To(Succeed())
+				Expect(answers()).To(Equal([]dns.RR{soa3}))
+			})
+		})
+		When("AXFR-style response is requested over UDP", func() {
+			BeforeEach(func() {
+				w.LocalAddress = &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+				err = transfer.TransferZoneIXFR(z, transfer.NewMemoryHistory(0), w, newReq(1), nil)
+			})
+			It("sends single SOA", func() {
+				Expect(err).To(Succeed())
+				Expect(answers()).To(Equal([]dns.RR{soa3}))
+			})
+		})
+	})
+})
@@ -0,0 +1,35 @@
+package transfer
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/tsig"
+)
+
+// ErrTSIG returns when request does not have valid TSIG.
+var ErrTSIG = fmt.Errorf("TSIG verification failed")
+
+// CheckTSIG checks TSIG of transfer request by key ring.
+// If the request does not have valid TSIG, it writes error response and returns ErrTSIG.
+// The dns.Server must use the key ring as TsigProvider.
+func CheckTSIG(kr *tsig.KeyRing, w dns.ResponseWriter, q *dns.Msg) error {
+	rcode, tsigErr := kr.CheckRequest(w, q)
+	if rcode == dns.RcodeSuccess {
+		return nil
+	}
+	if err := w.WriteMsg(tsig.NewErrorResponse(q, rcode, tsigErr)); err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+	return fmt.Errorf("%w: %s %s", ErrTSIG, dns.RcodeToString[rcode], dns.RcodeToString[int(tsigErr)])
+}
+
+// TransferZoneTSIG transfers zone when request has valid TSIG of key ring.
+// Every message of the transfer is signed by the ResponseWriter.
+func TransferZoneTSIG(kr *tsig.KeyRing, z dnsutils.ZoneInterface, w dns.ResponseWriter, q *dns.Msg, tr *dns.Transfer) error {
+	if err := CheckTSIG(kr, w, q); err != nil {
+		return err
+	}
+	return TransferZone(z, w, q, tr)
+}
@@ -0,0 +1,138 @@
+package transfer_test
+
+import (
+	"bytes"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/transfer"
+	"github.com/mimuret/dnsutils/tsig"
+
+	. "github.com/onsi/ginkgo"
+
+	. "github.com/onsi/gomega"
+)
+
+type tsigHandler struct {
+	kr *tsig.KeyRing
+	z  dnsutils.ZoneInterface
+}
+
+func (h *tsigHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	transfer.TransferZoneTSIG(h.kr, h.z, w, r, nil)
+}
+
+type countProvider struct {
+	*tsig.KeyRing
+	verified int
+}
+
+func (p *countProvider) Verify(msg []byte, t *dns.TSIG) error {
+	p.verified++
+	return p.KeyRing.Verify(msg, t)
+}
+
+var _ = Describe("tsig", func() {
+	var (
+		err error
+		kr  *tsig.KeyRing
+		z   *dnsutils.Zone
+		req *dns.Msg
+		key = &tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+	)
+	BeforeEach(func() {
+		kr, err = tsig.NewKeyRing(key)
+		Expect(err).To(Succeed())
+		z = &dnsutils.Zone{}
+		Expect(z.Read(bytes.NewBuffer(testZoneBig))).To(Succeed())
+		req = &dns.Msg{}
+		req.SetAxfr("example.jp.")
+	})
+	Context("CheckTSIG", func() {
+		var w *testtool.ResponseWriter
+		BeforeEach(func() {
+			w = &testtool.ResponseWriter{}
+		})
+		When("request is not signed", func() {
+			BeforeEach(func() {
+				err = transfer.CheckTSIG(kr, w, req)
+			})
+			It("writes REFUSED", func() {
+				Expect(err).To(MatchError(transfer.ErrTSIG))
+				Expect(w.Msg.Rcode).To(Equal(dns.RcodeRefused))
+			})
+		})
+		When("TSIG is out of time", func() {
+			BeforeEach(func() {
+				req.SetTsig(key.Name, key.Algorithm, 300, 0)
+				w.ErrTsigStatus = dns.ErrTime
+				err = transfer.CheckTSIG(kr, w, req)
+			})
+			It("writes NOTAUTH with BADTIME", func() {
+				Expect(err).To(MatchError(transfer.ErrTSIG))
+				Expect(w.Msg.Rcode).To(Equal(dns.RcodeNotAuth))
+				Expect(w.Msg.IsTsig().Error).To(Equal(uint16(dns.RcodeBadTime)))
+			})
+		})
+		When("TSIG is valid", func() {
+			BeforeEach(func() {
+				req.SetTsig(key.Name, key.Algorithm, 300, time.Now().Unix())
+				err = transfer.CheckTSIG(kr, w, testtool.MustSignMsg(req, kr))
+			})
+			It("returns nil", func() {
+				Expect(err).To(Succeed())
+				Expect(w.Msg).To(BeNil())
+			})
+		})
+	})
+	Context("TransferZoneTSIG", func() {
+		var (
+			svc  *dns.Server
+			addr string
+		)
+		BeforeEach(func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).To(Succeed())
+			addr = l.Addr().String()
+			startCh := make(chan struct{})
+			svc = &dns.Server{Listener: l, Net: "tcp", TsigProvider: kr, Handler: &tsigHandler{kr: kr, z: z}, NotifyStartedFunc: func() { close(startCh) }}
+			go svc.ActivateAndServe()
+			<-startCh
+		})
+		AfterEach(func() {
+			svc.Shutdown()
+		})
+		When("request is signed by known key", func() {
+			It("transfers zone with signed messages", func() {
+				req.SetTsig(key.Name, key.Algorithm, 300, time.Now().Unix())
+				p := &countProvider{KeyRing: kr}
+				tr := &dns.Transfer{TsigProvider: p}
+				envCh, err := tr.In(req, addr)
+				Expect(err).To(Succeed())
+				var envs int
+				for env := range envCh {
+					Expect(env.Error).To(Succeed())
+					envs++
+				}
+				Expect(envs).To(BeNumerically(">", 1))
+				Expect(p.verified).To(Equal(envs))
+			})
+		})
+		When("request is signed by unknown key", func() {
+			It("returns NOTAUTH", func() {
+				other, err := tsig.NewKeyRing(&tsig.Key{Name: "other.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})
+				Expect(err).To(Succeed())
+				req.SetTsig("other.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+				c := &dns.Client{Net: "tcp", TsigProvider: other}
+				// BADKEY response is not signed, so client can not verify it.
+				res, _, err := c.Exchange(req, addr)
+				Expect(err).To(Equal(dns.ErrAuth))
+				Expect(res.Rcode).To(Equal(dns.RcodeNotAuth))
+				Expect(res.IsTsig().Error).To(Equal(uint16(dns.RcodeBadKey)))
+			})
+		})
+	})
+})
@@ -0,0 +1,153 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+)
+
+var (
+	// ErrBadSOA returns when transfer stream does not start and end with same SOA.
+	ErrBadSOA = fmt.Errorf("transfer must start and end with same SOA")
+	// ErrZONEMDVerify returns when ZONEMD verification fails.
+	ErrZONEMDVerify = fmt.Errorf("failed to verify ZONEMD")
+)
+
+// InOption is option for inbound xfr.
+type InOption struct {
+	// Transfer is used for request. If nil, new dns.Transfer is used.
+	// TSIG settings of request message and Transfer are used as is.
+	Transfer *dns.Transfer
+	// Generator is used for creating zone. If nil, DefaultGenerator is used.
+	Generator dnsutils.Generator
+	// Class is zone class. If zero, ClassINET is used.
+	Class dns.Class
+	// VerifyZONEMD verifies apex ZONEMD by VerifyAnyZONEMDDigest.
+	// If ZONEMD does not exist, verification is skipped.
+	VerifyZONEMD bool
+	// RequireZONEMD returns error when VerifyZONEMD is true and ZONEMD does not exist.
+	RequireZONEMD bool
+}
+
+func (o *InOption) getTransfer() *dns.Transfer {
+	if o.Transfer == nil {
+		return &dns.Transfer{}
+	}
+	return o.Transfer
+}
+
+func (o *InOption) getClass() dns.Class {
+	if o.Class == 0 {
+		return dns.ClassINET
+	}
+	return o.Class
+}
+
+// AXFRIn requests AXFR of zone to addr and returns transferred zone.
+// If opt is nil, default option is used.
+func AXFRIn(zone, addr string, opt *InOption) (*dnsutils.Zone, error) {
+	if opt == nil {
+		opt = &InOption{}
+	}
+	q := &dns.Msg{}
+	q.SetAxfr(dns.CanonicalName(zone))
+	q.Question[0].Qclass = uint16(opt.getClass())
+	return AXFRInWithMsg(q, addr, opt)
+}
+
+// AXFRInWithMsg requests AXFR by q to addr and returns transferred zone.
+// It is used for TSIG signed request.
+func AXFRInWithMsg(q *dns.Msg, addr string, opt *InOption) (*dnsutils.Zone, error) {
+	if opt == nil {
+		opt = &InOption{}
+	}
+	if len(q.Question) == 0 {
+		return nil, fmt.Errorf("question is empty")
+	}
+	envCh, err := opt.getTransfer().In(q, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request AXFR: %w", err)
+	}
+	o := *opt
+	o.Class = dns.Class(q.Question[0].Qclass)
+	return ReadAXFR(q.Question[0].Name, envCh, &o)
+}
+
+// ReadAXFR reads AXFR stream and returns zone.
+// It checks that the stream starts and ends with same SOA.
+// RRs are imported into zone created by InOption.Generator as they arrive.
+func ReadAXFR(zone string, envCh <-chan *dns.Envelope, opt *InOption) (*dnsutils.Zone, error) {
+	if opt == nil {
+		opt = &InOption{}
+	}
+	z, err := readAXFR(zone, envCh, opt)
+	if err != nil {
+		// drain channel for finishing dns.Transfer.In goroutine
+		go func() {
+			for range envCh {
+			}
+		}()
+		return nil, err
+	}
+	if opt.VerifyZONEMD {
+		ok, err := dnsutils.VerifyAnyZONEMDDigest(z)
+		if errors.Is(err, dnsutils.ErrZONEMDVerifySkip) {
+			if opt.RequireZONEMD {
+				return nil, fmt.Errorf("%w: ZONEMD not found", ErrZONEMDVerify)
+			}
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrZONEMDVerify, err)
+		} else if !ok {
+			return nil, ErrZONEMDVerify
+		}
+	}
+	return z, nil
+}
+
+func readAXFR(zone string, envCh <-chan *dns.Envelope, opt *InOption) (*dnsutils.Zone, error) {
+	z, err := dnsutils.NewZone(zone, opt.getClass(), opt.Generator)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		first *dns.SOA
+		end   bool
+	)
+	for env := range envCh {
+		if env.Error != nil {
+			return nil, fmt.Errorf("failed to transfer: %w", env.Error)
+		}
+		rrs := make([]dns.RR, 0, len(env.RR))
+		for _, rr := range env.RR {
+			if end {
+				return nil, fmt.Errorf("%w: RR exists after last SOA", ErrBadSOA)
+			}
+			soa, isSOA := rr.(*dns.SOA)
+			if isSOA && !dnsutils.Equals(soa.Hdr.Name, z.GetName()) {
+				isSOA = false
+			}
+			if first == nil {
+				if !isSOA {
+					return nil, fmt.Errorf("%w: first RR is not SOA", ErrBadSOA)
+				}
+				first = soa
+			} else if isSOA {
+				if !dns.IsDuplicate(first, soa) {
+					return nil, fmt.Errorf("%w: last SOA is different", ErrBadSOA)
+				}
+				end = true
+				continue
+			}
+			rrs = append(rrs, rr)
+		}
+		if err := z.ImportRRs(rrs); err != nil {
+			return nil, fmt.Errorf("failed to import RRs: %w", err)
+		}
+	}
+	if !end {
+		return nil, fmt.Errorf("%w: last SOA not found", ErrBadSOA)
+	}
+	return z, nil
+}
@@ -0,0 +1,200 @@
+package transfer_test
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/transfer"
+
+	. "github.com/onsi/ginkgo"
+
+	. "github.com/onsi/gomega"
+)
+
+type primaryHandler struct {
+	z   dnsutils.ZoneInterface
+	rrs [][]dns.RR
+}
+
+func (h *primaryHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if h.rrs != nil {
+		ch := make(chan *dns.Envelope)
+		tr := &dns.Transfer{}
+		go func() {
+			for _, rrs := range h.rrs {
+				ch <- &dns.Envelope{RR: rrs}
+			}
+			close(ch)
+		}()
+		tr.Out(w, r, ch)
+		return
+	}
+	transfer.TransferZone(h.z, w, r, nil)
+}
+
+type countGenerator struct {
+	dnsutils.DefaultGenerator
+	nodes int
+}
+
+func (g *countGenerator) NewNameNode(name string, class dns.Class) (dnsutils.NameNodeInterface, error) {
+	g.nodes++
+	return g.DefaultGenerator.NewNameNode(name, class)
+}
+
+var _ = Describe("xfr_in", func() {
+	var (
+		err     error
+		z       *dnsutils.Zone
+		primary *dnsutils.Zone
+		h       *primaryHandler
+		svc     *dns.Server
+		addr    string
+		opt     *transfer.InOption
+		soa     = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 1 3600 900 85400 300")
+		soa2    = testtool.MustNewRR("example.jp. 3600 IN SOA localhost. root.localhost. 2 3600 900 85400 300")
+		a       = testtool.MustNewRR("www.example.jp. 3600 IN A 192.168.0.1")
+	)
+	BeforeEach(func() {
+		primary = &dnsutils.Zone{}
+		Expect(primary.Read(bytes.NewBuffer(testZoneNormal))).To(Succeed())
+		h = &primaryHandler{z: primary}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(Succeed())
+		addr = l.Addr().String()
+		startCh := make(chan struct{})
+		svc = &dns.Server{Listener: l, Net: "tcp", Handler: h, NotifyStartedFunc: func() { close(startCh) }}
+		go svc.ActivateAndServe()
+		<-startCh
+		opt = &transfer.InOption{}
+	})
+	AfterEach(func() {
+		svc.Shutdown()
+	})
+	Context("AXFRIn", func() {
+		When("primary returns valid zone", func() {
+			BeforeEach(func() {
+				z, err = transfer.AXFRIn("example.jp", addr, opt)
+			})
+			It("returns zone", func() {
+				Expect(err).To(Succeed())
+				Expect(z.GetName()).To(Equal("example.jp."))
+				Expect(dnsutils.IsEqualsAllTree(z.GetRootNode(), primary.GetRootNode(), true)).To(BeTrue())
+			})
+		})
+		When("last SOA is different", func() {
+			BeforeEach(func() {
+				h.rrs = [][]dns.RR{{soa, a}, {soa2}}
+				z, err = transfer.AXFRIn("example.jp", addr, opt)
+			})
+			It("returns ErrBadSOA", func() {
+				Expect(err).To(MatchError(transfer.ErrBadSOA))
+			})
+		})
+		When("first RR is not SOA", func() {
+			BeforeEach(func() {
+				h.rrs = [][]dns.RR{{a, soa}, {soa}}
+				z, err = transfer.AXFRIn("example.jp", addr, opt)
+			})
+			It("returns error", func() {
+				Expect(err).To(HaveOccurred())
+			})
+		})
+		When("VerifyZONEMD is true", func() {
+			BeforeEach(func() {
+				opt.VerifyZONEMD = true
+			})
+			When("ZONEMD does not exist", func() {
+				It("skips verification", func() {
+					_, err = transfer.AXFRIn("example.jp", addr, opt)
+					Expect(err).To(Succeed())
+				})
+				It("returns error when RequireZONEMD is true", func() {
+					opt.RequireZONEMD = true
+					_, err = transfer.AXFRIn("example.jp", addr, opt)
+					Expect(err).To(MatchError(transfer.ErrZONEMDVerify))
+				})
+			})
+			When("ZONEMD is valid", func() {
+				BeforeEach(func() {
+					Expect(dnsutils.AddZONEMDPlaceholder(primary, nil, nil)).To(Succeed())
+					Expect(dnsutils.UpdateZONEMDDigest(primary, nil)).To(Succeed())
+					z, err = transfer.AXFRIn("example.jp", addr, opt)
+				})
+				It("returns zone", func() {
+					Expect(err).To(Succeed())
+					Expect(z.GetRootNode().GetRRSet(dns.TypeZONEMD)).NotTo(BeNil())
+				})
+			})
+			When("ZONEMD is invalid", func() {
+				BeforeEach(func() {
+					Expect(dnsutils.AddZONEMDPlaceholder(primary, nil, nil)).To(Succeed())
+					Expect(dnsutils.UpdateZONEMDDigest(primary, nil)).To(Succeed())
+					Expect(primary.ImportRRs([]dns.RR{testtool.MustNewRR("added.example.jp. 3600 IN A 192.168.0.1")})).To(Succeed())
+					z, err = transfer.AXFRIn("example.jp", addr, opt)
+				})
+				It("returns ErrZONEMDVerify", func() {
+					Expect(err).To(MatchError(transfer.ErrZONEMDVerify))
+				})
+			})
+		})
+	})
+	Context("ReadAXFR", func() {
+		var envCh chan *dns.Envelope
+		BeforeEach(func() {
+			envCh = make(chan *dns.Envelope, 3)
+		})
+		When("last SOA not found", func() {
+			BeforeEach(func() {
+				envCh <- &dns.Envelope{RR: []dns.RR{soa, a}}
+				close(envCh)
+				_, err = transfer.ReadAXFR("example.jp.", envCh, nil)
+			})
+			It("returns ErrBadSOA", func() {
+				Expect(err).To(MatchError(transfer.ErrBadSOA))
+			})
+		})
+		When("RR exists after last SOA", func() {
+			BeforeEach(func() {
+				envCh <- &dns.Envelope{RR: []dns.RR{soa, a, soa, a}}
+				close(envCh)
+				_, err = transfer.ReadAXFR("example.jp.", envCh, nil)
+			})
+			It("returns ErrBadSOA", func() {
+				Expect(err).To(MatchError(transfer.ErrBadSOA))
+			})
+		})
+		When("envelope has error", func() {
+			BeforeEach(func() {
+				envCh <- &dns.Envelope{RR: []dns.RR{soa, a}}
+				envCh <- &dns.Envelope{Error: dns.ErrSoa}
+				close(envCh)
+				_, err = transfer.ReadAXFR("example.jp.", envCh, nil)
+			})
+			It("returns error", func() {
+				Expect(err).To(MatchError(dns.ErrSoa))
+			})
+		})
+		When("valid stream", func() {
+			var g *countGenerator
+			BeforeEach(func() {
+				g = &countGenerator{}
+				envCh <- &dns.Envelope{RR: []dns.RR{soa, a}}
+				envCh <- &dns.Envelope{RR: []dns.RR{soa}}
+				close(envCh)
+				z, err = transfer.ReadAXFR("example.jp.", envCh, &transfer.InOption{Generator: g})
+			})
+			It("returns zone", func() {
+				Expect(err).To(Succeed())
+				Expect(z.GetRootNode().GetRRSet(dns.TypeSOA).GetRRs()).To(Equal([]dns.RR{soa}))
+				nn, ok := z.GetRootNode().GetNameNode("www.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(nn.GetRRSet(dns.TypeA).GetRRs()).To(Equal([]dns.RR{a}))
+				Expect(g.nodes).To(BeNumerically(">", 0))
+			})
+		})
+	})
+})
@@ -0,0 +1,215 @@
+package tsig
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	// ErrInvalidKey returns when key is not valid.
+	ErrInvalidKey = fmt.Errorf("invalid TSIG key")
+	// ErrKeyExist returns when key name is already exist.
+	ErrKeyExist = fmt.Errorf("TSIG key already exists")
+)
+
+var _ dns.TsigProvider = &KeyRing{}
+
+// Key is TSIG key.
+type Key struct {
+	// Name is key name
+	Name string `json:"name"`
+	// Algorithm is HMAC algorithm name. e.g. hmac-sha256
+	Algorithm string `json:"algorithm"`
+	// Secret is base64 encoded secret
+	Secret string `json:"secret"`
+}
+
+// Validate checks key and canonicalizes name and algorithm.
+func (k *Key) Validate() error {
+	if _, ok := dns.IsDomainName(k.Name); !ok || k.Name == "" {
+		return fmt.Errorf("%w: invalid name `%s`", ErrInvalidKey, k.Name)
+	}
+	k.Name = dns.CanonicalName(k.Name)
+	k.Algorithm = dns.CanonicalName(k.Algorithm)
+	if newHash(k.Algorithm, nil) == nil {
+		return fmt.Errorf("%w: not supported algorithm `%s`", ErrInvalidKey, k.Algorithm)
+	}
+	if _, err := base64.StdEncoding.DecodeString(k.Secret); err != nil || k.Secret == "" {
+		return fmt.Errorf("%w: invalid secret of `%s`", ErrInvalidKey, k.Name)
+	}
+	return nil
+}
+
+func newHash(alg string, secret []byte) hash.Hash {
+	switch alg {
+	case dns.HmacSHA1:
+		return hmac.New(sha1.New, secret)
+	case dns.HmacSHA224:
+		return hmac.New(sha256.New224, secret)
+	case dns.HmacSHA256:
+		return hmac.New(sha256.New, secret)
+	case dns.HmacSHA384:
+		return hmac.New(sha512.New384, secret)
+	case dns.HmacSHA512:
+		return hmac.New(sha512.New, secret)
+	}
+	return nil
+}
+
+// verifiedLifetime is the time to remember verified MACs.
+const verifiedLifetime = 5 * time.Minute
+
+// KeyRing is set of TSIG keys.
+// It implements dns.TsigProvider, so it can be used for dns.Server, dns.Client and dns.Transfer.
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys map[string]*Key
+
+	// verified has MACs verified by Verify, it is used by CheckRequest.
+	vmu       sync.Mutex
+	verified  map[string]time.Time
+	nextSweep time.Time
+}
+
+// NewKeyRing creates KeyRing.
+func NewKeyRing(keys ...*Key) (*KeyRing, error) {
+	kr := &KeyRing{keys: map[string]*Key{}}
+	for _, key := range keys {
+		if err := kr.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+// Add adds key.
+// If the same name key already exists, it returns ErrKeyExist.
+func (kr *KeyRing) Add(key *Key) error {
+	k := *key
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if kr.keys == nil {
+		kr.keys = map[string]*Key{}
+	}
+	if _, ok := kr.keys[k.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrKeyExist, k.Name)
+	}
+	kr.keys[k.Name] = &k
+	return nil
+}
+
+// Remove removes key by name.
+func (kr *KeyRing) Remove(name string) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	delete(kr.keys, dns.CanonicalName(name))
+}
+
+// Get returns copy of key by name.
+func (kr *KeyRing) Get(name string) (*Key, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	k, ok := kr.keys[dns.CanonicalName(name)]
+	if !ok {
+		return nil, false
+	}
+	c := *k
+	return &c, true
+}
+
+// Names returns sorted key names.
+func (kr *KeyRing) Names() []string {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	names := make([]string, 0, len(kr.keys))
+	for name := range kr.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (kr *KeyRing) mac(msg []byte, t *dns.TSIG) ([]byte, error) {
+	k, ok := kr.Get(t.Hdr.Name)
+	if !ok {
+		return nil, dns.ErrSecret
+	}
+	if k.Algorithm != dns.CanonicalName(t.Algorithm) {
+		return nil, dns.ErrKeyAlg
+	}
+	secret, err := base64.StdEncoding.DecodeString(k.Secret)
+	if err != nil {
+		return nil, err
+	}
+	h := newHash(k.Algorithm, secret)
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// Generate is implement of dns.TsigProvider.
+func (kr *KeyRing) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	return kr.mac(msg, t)
+}
+
+// Verify is implement of dns.TsigProvider.
+func (kr *KeyRing) Verify(msg []byte, t *dns.TSIG) error {
+	b, err := kr.mac(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(b, mac) {
+		return dns.ErrSig
+	}
+	kr.setVerified(t)
+	return nil
+}
+
+func verifiedKey(t *dns.TSIG) string {
+	return dns.CanonicalName(t.Hdr.Name) + " " + strings.ToLower(t.MAC)
+}
+
+// setVerified remembers the MAC of t is verified.
+func (kr *KeyRing) setVerified(t *dns.TSIG) {
+	now := time.Now()
+	kr.vmu.Lock()
+	defer kr.vmu.Unlock()
+	if kr.verified == nil {
+		kr.verified = map[string]time.Time{}
+	}
+	if now.After(kr.nextSweep) {
+		for k, expire := range kr.verified {
+			if now.After(expire) {
+				delete(kr.verified, k)
+			}
+		}
+		kr.nextSweep = now.Add(time.Second)
+	}
+	kr.verified[verifiedKey(t)] = now.Add(verifiedLifetime)
+}
+
+// isVerified returns true when the MAC of t is verified by Verify.
+func (kr *KeyRing) isVerified(t *dns.TSIG) bool {
+	kr.vmu.Lock()
+	defer kr.vmu.Unlock()
+	expire, ok := kr.verified[verifiedKey(t)]
+	return ok && time.Now().Before(expire)
+}
@@ -0,0 +1,76 @@
+package tsig_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils/tsig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTSIG(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "tsig Suite")
+}
+
+var _ = Describe("KeyRing", func() {
+	var (
+		kr  *tsig.KeyRing
+		err error
+	)
+	BeforeEach(func() {
+		kr, err = tsig.NewKeyRing(&tsig.Key{Name: "Key.example.jp", Algorithm: "hmac-sha256", Secret: "c2VjcmV0"})
+		Expect(err).To(Succeed())
+	})
+	Context("Add", func() {
+		It("canonicalizes name and algorithm", func() {
+			k, ok := kr.Get("key.example.jp.")
+			Expect(ok).To(BeTrue())
+			Expect(k).To(Equal(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}))
+		})
+		It("returns ErrKeyExist for duplicate name", func() {
+			err = kr.Add(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA1, Secret: "c2VjcmV0"})
+			Expect(err).To(MatchError(tsig.ErrKeyExist))
+		})
+		It("returns ErrInvalidKey for invalid key", func() {
+			Expect(kr.Add(&tsig.Key{Name: "", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})).To(MatchError(tsig.ErrInvalidKey))
+			Expect(kr.Add(&tsig.Key{Name: "a.example.jp.", Algorithm: dns.HmacMD5, Secret: "c2VjcmV0"})).To(MatchError(tsig.ErrInvalidKey))
+			Expect(kr.Add(&tsig.Key{Name: "a.example.jp.", Algorithm: dns.HmacSHA256, Secret: "!!"})).To(MatchError(tsig.ErrInvalidKey))
+		})
+	})
+	Context("Remove", func() {
+		It("removes key", func() {
+			kr.Remove("KEY.example.jp.")
+			Expect(kr.Names()).To(BeEmpty())
+		})
+	})
+	Context("TsigProvider", func() {
+		var msg *dns.Msg
+		BeforeEach(func() {
+			msg = &dns.Msg{}
+			msg.SetQuestion("example.jp.", dns.TypeSOA)
+		})
+		It("signs and verifies message", func() {
+			msg.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+			bs, _, err := dns.TsigGenerateWithProvider(msg, kr, "", false)
+			Expect(err).To(Succeed())
+			// TsigVerify modifies the buffer.
+			copyBs := func() []byte { return append([]byte(nil), bs...) }
+			Expect(dns.TsigVerifyWithProvider(copyBs(), kr, "", false)).To(Succeed())
+			Expect(dns.TsigVerify(copyBs(), "c2VjcmV0", "", false)).To(Succeed())
+			Expect(dns.TsigVerify(copyBs(), "d3Jvbmc=", "", false)).To(Equal(dns.ErrSig))
+		})
+		It("returns ErrSecret for unknown key", func() {
+			msg.SetTsig("unknown.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+			_, _, err := dns.TsigGenerateWithProvider(msg, kr, "", false)
+			Expect(err).To(Equal(dns.ErrSecret))
+		})
+		It("returns ErrKeyAlg for algorithm mismatch", func() {
+			msg.SetTsig("key.example.jp.", dns.HmacSHA512, 300, time.Now().Unix())
+			_, _, err := dns.TsigGenerateWithProvider(msg, kr, "", false)
+			Expect(err).To(Equal(dns.ErrKeyAlg))
+		})
+	})
+})
@@ -0,0 +1,175 @@
+package tsig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrKeyFormat returns when key file can not be parsed.
+var ErrKeyFormat = fmt.Errorf("invalid key file format")
+
+// Config is JSON format of key ring.
+//
+//	{"keys": [{"name": "key.example.jp.", "algorithm": "hmac-sha256", "secret": "..."}]}
+type Config struct {
+	Keys []*Key `json:"keys"`
+}
+
+// ReadJSON reads keys from JSON.
+func ReadJSON(r io.Reader) (*KeyRing, error) {
+	c := &Config{}
+	if err := json.NewDecoder(r).Decode(c); err != nil {
+		return nil, fmt.Errorf("failed to decode json: %w", err)
+	}
+	return NewKeyRing(c.Keys...)
+}
+
+// ReadBIND reads keys from BIND key file format.
+//
+//	key "key.example.jp" {
+//		algorithm hmac-sha256;
+//		secret "...";
+//	};
+func ReadBIND(r io.Reader) (*KeyRing, error) {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read: %w", err)
+	}
+	tokens, err := tokenize(string(bs))
+	if err != nil {
+		return nil, err
+	}
+	kr, _ := NewKeyRing()
+	for len(tokens) > 0 {
+		var key *Key
+		key, tokens, err = parseKeyStatement(tokens)
+		if err != nil {
+			return nil, err
+		}
+		if err := kr.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+// ReadFile reads keys from file.
+// If the file extension is .json, it is read as JSON. Otherwise it is read as BIND key file.
+func ReadFile(filename string) (*KeyRing, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return ReadJSON(f)
+	}
+	return ReadBIND(f)
+}
+
+func parseKeyStatement(tokens []string) (*Key, []string, error) {
+	next := func() (string, error) {
+		if len(tokens) == 0 {
+			return "", fmt.Errorf("%w: unexpected end of file", ErrKeyFormat)
+		}
+		t := tokens[0]
+		tokens = tokens[1:]
+		return t, nil
+	}
+	expect := func(s string) error {
+		t, err := next()
+		if err != nil {
+			return err
+		}
+		if t != s {
+			return fmt.Errorf("%w: expected `%s`, got `%s`", ErrKeyFormat, s, t)
+		}
+		return nil
+	}
+	if err := expect("key"); err != nil {
+		return nil, nil, err
+	}
+	name, err := next()
+	if err != nil {
+		return nil, nil, err
+	}
+	key := &Key{Name: unquote(name)}
+	if err := expect("{"); err != nil {
+		return nil, nil, err
+	}
+	for {
+		t, err := next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if t == "}" {
+			break
+		}
+		v, err := next()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch t {
+		case "algorithm":
+			key.Algorithm = unquote(v)
+		case "secret":
+			key.Secret = unquote(v)
+		default:
+			return nil, nil, fmt.Errorf("%w: unknown option `%s`", ErrKeyFormat, t)
+		}
+		if err := expect(";"); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := expect(";"); err != nil {
+		return nil, nil, err
+	}
+	return key, tokens, nil
+}
+
+func unquote(s string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(s, `"`), `"`)
+}
+
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#' || strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated comment", ErrKeyFormat)
+			}
+			i += end + 4
+		case c == '{' || c == '}' || c == ';':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated string", ErrKeyFormat)
+			}
+			tokens = append(tokens, s[i:i+end+2])
+			i += end + 2
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\r\n{};\"", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
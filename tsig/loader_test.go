@@ -0,0 +1,60 @@
+package tsig_test
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils/tsig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("loader", func() {
+	expectKeys := func(kr *tsig.KeyRing) {
+		Expect(kr.Names()).To(Equal([]string{"key1.example.jp.", "key2.example.jp."}))
+		k, _ := kr.Get("key1.example.jp.")
+		Expect(k).To(Equal(&tsig.Key{Name: "key1.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0MQ=="}))
+		k, _ = kr.Get("key2.example.jp.")
+		Expect(k).To(Equal(&tsig.Key{Name: "key2.example.jp.", Algorithm: dns.HmacSHA512, Secret: "c2VjcmV0Mg=="}))
+	}
+	Context("ReadFile", func() {
+		It("reads JSON file", func() {
+			kr, err := tsig.ReadFile("testdata/keys.json")
+			Expect(err).To(Succeed())
+			expectKeys(kr)
+		})
+		It("reads BIND key file", func() {
+			kr, err := tsig.ReadFile("testdata/keys.conf")
+			Expect(err).To(Succeed())
+			expectKeys(kr)
+		})
+		It("returns error when file not found", func() {
+			_, err := tsig.ReadFile("testdata/notfound.json")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("ReadJSON", func() {
+		It("returns error for invalid key", func() {
+			_, err := tsig.ReadJSON(strings.NewReader(`{"keys":[{"name":"a.example.jp.","algorithm":"hmac-md4","secret":"c2VjcmV0"}]}`))
+			Expect(err).To(MatchError(tsig.ErrInvalidKey))
+		})
+		It("returns error for invalid json", func() {
+			_, err := tsig.ReadJSON(strings.NewReader(`{`))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("ReadBIND", func() {
+		It("returns ErrKeyFormat for invalid format", func() {
+			for _, s := range []string{
+				`key "a" { algorithm hmac-sha256; secret "c2VjcmV0"; }`,
+				`key "a" { algorithm hmac-sha256; foo bar; };`,
+				`key "a { };`,
+				`/* key "a" { };`,
+				`server 192.168.0.1 { };`,
+			} {
+				_, err := tsig.ReadBIND(strings.NewReader(s))
+				Expect(err).To(MatchError(tsig.ErrKeyFormat), s)
+			}
+		})
+	})
+})
@@ -0,0 +1,109 @@
+package tsig
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultFudge is fudge of TSIG RR in responses.
+const DefaultFudge = 300
+
+// CheckRequest checks TSIG status of request.
+// It returns NOERROR when request has valid TSIG of a key in the key ring.
+// Otherwise it returns rcode and TSIG error of response (rfc8945#section-5.2).
+//   - no TSIG: REFUSED
+//   - unknown key or algorithm: NOTAUTH, BADKEY
+//   - invalid MAC: NOTAUTH, BADSIG
+//   - out of time: NOTAUTH, BADTIME
+//
+// The dns.Server should use the key ring as TsigProvider.
+// When the request is not verified by the server (dns.Server has no TsigProvider, or it uses other provider),
+// TSIG is verified with packed request. It fails when the request was name compressed by the client.
+func (kr *KeyRing) CheckRequest(w dns.ResponseWriter, req *dns.Msg) (int, uint16) {
+	t := req.IsTsig()
+	if t == nil {
+		return dns.RcodeRefused, dns.RcodeSuccess
+	}
+	k, ok := kr.Get(t.Hdr.Name)
+	if !ok || k.Algorithm != dns.CanonicalName(t.Algorithm) {
+		return dns.RcodeNotAuth, dns.RcodeBadKey
+	}
+	if err := w.TsigStatus(); err != nil {
+		return dns.RcodeNotAuth, StatusError(err)
+	}
+	if !kr.isVerified(t) {
+		// dns.ResponseWriter.TsigStatus is nil when the server does not verify TSIG.
+		bs, err := req.Pack()
+		if err != nil {
+			return dns.RcodeNotAuth, dns.RcodeBadSig
+		}
+		if err := dns.TsigVerifyWithProvider(bs, kr, "", false); err != nil {
+			return dns.RcodeNotAuth, StatusError(err)
+		}
+	}
+	return dns.RcodeSuccess, dns.RcodeSuccess
+}
+
+// StatusError returns TSIG error of response for dns.ResponseWriter.TsigStatus error.
+//   - nil: NOERROR
+//   - unknown key or algorithm: BADKEY
+//   - out of time: BADTIME
+//   - others: BADSIG
+func StatusError(err error) uint16 {
+	switch {
+	case err == nil:
+		return dns.RcodeSuccess
+	case errors.Is(err, dns.ErrSecret), errors.Is(err, dns.ErrKeyAlg):
+		return dns.RcodeBadKey
+	case errors.Is(err, dns.ErrTime):
+		return dns.RcodeBadTime
+	}
+	return dns.RcodeBadSig
+}
+
+// KeyName returns verified TSIG key name of request.
+// If request is not signed by a key in the key ring, it returns false.
+func (kr *KeyRing) KeyName(w dns.ResponseWriter, req *dns.Msg) (string, bool) {
+	if rcode, _ := kr.CheckRequest(w, req); rcode != dns.RcodeSuccess {
+		return "", false
+	}
+	return dns.CanonicalName(req.IsTsig().Hdr.Name), true
+}
+
+// SetTSIG adds TSIG RR for response res of request req.
+// If req does not have TSIG, it does nothing.
+// The MAC is calculated by dns.ResponseWriter when the response is written.
+// When tsigErr is BADKEY or BADSIG, the response is not signed (rfc8945#section-5.3.2).
+func SetTSIG(res, req *dns.Msg, tsigErr uint16) {
+	t := req.IsTsig()
+	if t == nil {
+		return
+	}
+	now := time.Now().Unix()
+	rr := &dns.TSIG{
+		Hdr:        dns.RR_Header{Name: t.Hdr.Name, Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
+		Algorithm:  t.Algorithm,
+		Fudge:      DefaultFudge,
+		TimeSigned: uint64(now),
+		OrigId:     res.Id,
+		Error:      tsigErr,
+	}
+	if tsigErr == dns.RcodeBadTime {
+		// Time Signed is copied from request, and Other Data has server time.
+		rr.TimeSigned = t.TimeSigned
+		rr.OtherLen = 6
+		rr.OtherData = fmt.Sprintf("%012x", now)
+	}
+	res.Extra = append(res.Extra, rr)
+}
+
+// NewErrorResponse creates response of request which failed CheckRequest.
+func NewErrorResponse(req *dns.Msg, rcode int, tsigErr uint16) *dns.Msg {
+	res := &dns.Msg{}
+	res.SetRcode(req, rcode)
+	SetTSIG(res, req, tsigErr)
+	return res
+}
@@ -0,0 +1,129 @@
+package tsig_test
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/tsig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("tsig", func() {
+	var (
+		kr  *tsig.KeyRing
+		w   *testtool.ResponseWriter
+		req *dns.Msg
+	)
+	BeforeEach(func() {
+		var err error
+		kr, err = tsig.NewKeyRing(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})
+		Expect(err).To(Succeed())
+		w = &testtool.ResponseWriter{}
+		req = &dns.Msg{}
+		req.SetUpdate("example.jp.")
+	})
+	Context("CheckRequest", func() {
+		It("returns rcode and TSIG error", func() {
+			for _, tc := range []struct {
+				keyName string
+				alg     string
+				status  error
+				rcode   int
+				tsigErr uint16
+			}{
+				{"key.example.jp.", dns.HmacSHA256, nil, dns.RcodeSuccess, dns.RcodeSuccess},
+				{"", "", nil, dns.RcodeRefused, dns.RcodeSuccess},
+				{"unknown.example.jp.", dns.HmacSHA256, nil, dns.RcodeNotAuth, dns.RcodeBadKey},
+				{"key.example.jp.", dns.HmacSHA1, nil, dns.RcodeNotAuth, dns.RcodeBadKey},
+				{"key.example.jp.", dns.HmacSHA256, dns.ErrSig, dns.RcodeNotAuth, dns.RcodeBadSig},
+				{"key.example.jp.", dns.HmacSHA256, dns.ErrTime, dns.RcodeNotAuth, dns.RcodeBadTime},
+			} {
+				m := req.Copy()
+				if tc.keyName != "" {
+					m.SetTsig(tc.keyName, tc.alg, 300, time.Now().Unix())
+					if tc.rcode == dns.RcodeSuccess {
+						m = testtool.MustSignMsg(m, kr)
+					}
+				}
+				w.ErrTsigStatus = tc.status
+				rcode, tsigErr := kr.CheckRequest(w, m)
+				Expect(rcode).To(Equal(tc.rcode), tc.keyName)
+				Expect(tsigErr).To(Equal(tc.tsigErr), tc.keyName)
+			}
+		})
+	})
+	Context("CheckRequest with verification by server", func() {
+		It("accepts name compressed request", func() {
+			req.Insert([]dns.RR{testtool.MustNewRR("www.example.jp. 300 IN A 192.168.0.1"), testtool.MustNewRR("www.example.jp. 300 IN A 192.168.0.2")})
+			req.Compress = true
+			req.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+			bs, _, err := dns.TsigGenerateWithProvider(req, kr, "", false)
+			Expect(err).To(Succeed())
+			m := &dns.Msg{}
+			Expect(m.Unpack(bs)).To(Succeed())
+			repacked, err := m.Pack()
+			Expect(err).To(Succeed())
+			Expect(repacked).NotTo(Equal(bs))
+			// dns.Server verifies TSIG with the key ring.
+			Expect(dns.TsigVerifyWithProvider(bs, kr, "", false)).To(Succeed())
+			rcode, _ := kr.CheckRequest(w, m)
+			Expect(rcode).To(Equal(dns.RcodeSuccess))
+		})
+	})
+	Context("CheckRequest without verification by server", func() {
+		var (
+			other *tsig.KeyRing
+			err   error
+		)
+		BeforeEach(func() {
+			// dns.Server has no TsigProvider, or it uses other provider.
+			other, err = tsig.NewKeyRing(&tsig.Key{Name: "key.example.jp.", Algorithm: dns.HmacSHA256, Secret: "b3RoZXI="})
+			Expect(err).To(Succeed())
+			req.SetTsig("key.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+		})
+		It("rejects forged TSIG", func() {
+			rcode, tsigErr := kr.CheckRequest(w, testtool.MustSignMsg(req, other))
+			Expect(rcode).To(Equal(dns.RcodeNotAuth))
+			Expect(tsigErr).To(Equal(uint16(dns.RcodeBadSig)))
+		})
+		It("rejects TSIG without MAC", func() {
+			rcode, tsigErr := kr.CheckRequest(w, req)
+			Expect(rcode).To(Equal(dns.RcodeNotAuth))
+			Expect(tsigErr).To(Equal(uint16(dns.RcodeBadSig)))
+		})
+		It("rejects TSIG out of time", func() {
+			req.IsTsig().TimeSigned = uint64(time.Now().Unix() - 3600)
+			rcode, tsigErr := kr.CheckRequest(w, testtool.MustSignMsg(req, kr))
+			Expect(rcode).To(Equal(dns.RcodeNotAuth))
+			Expect(tsigErr).To(Equal(uint16(dns.RcodeBadTime)))
+		})
+	})
+	Context("KeyName", func() {
+		It("returns verified key name", func() {
+			_, ok := kr.KeyName(w, req)
+			Expect(ok).To(BeFalse())
+			req.SetTsig("KEY.example.jp.", dns.HmacSHA256, 300, time.Now().Unix())
+			name, ok := kr.KeyName(w, testtool.MustSignMsg(req, kr))
+			Expect(ok).To(BeTrue())
+			Expect(name).To(Equal("key.example.jp."))
+		})
+	})
+	Context("NewErrorResponse", func() {
+		It("returns response with TSIG error", func() {
+			req.SetTsig("key.example.jp.", dns.HmacSHA256, 300, 100)
+			res := tsig.NewErrorResponse(req, dns.RcodeNotAuth, dns.RcodeBadTime)
+			Expect(res.Rcode).To(Equal(dns.RcodeNotAuth))
+			t := res.IsTsig()
+			Expect(t).NotTo(BeNil())
+			Expect(t.Error).To(Equal(uint16(dns.RcodeBadTime)))
+			Expect(t.TimeSigned).To(Equal(uint64(100)))
+			Expect(t.OtherLen).To(Equal(uint16(6)))
+		})
+		It("does not add TSIG when request is not signed", func() {
+			res := tsig.NewErrorResponse(req, dns.RcodeRefused, dns.RcodeSuccess)
+			Expect(res.IsTsig()).To(BeNil())
+		})
+	})
+})
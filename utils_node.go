@@ -1,6 +1,7 @@
 package dnsutils
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
@@ -276,6 +277,51 @@ func RemoveNameNode(n NameNodeInterface, name string) error {
 	return nil
 }
 
+// Compact removes empty non-terminal nodes which have no children from zone.
+// NameNode removes such nodes automatically, so it is for NameNodeInterface implementations
+// which don't remove them.
+func Compact(z ZoneInterface) error {
+	return Walk(context.Background(), z.GetRootNode(), WalkOption{
+		PostOrder: func(nni NameNodeInterface, _ int) error {
+			for name, child := range nni.CopyChildNodes() {
+				if child.RRSetLen() == 0 && len(child.CopyChildNodes()) == 0 {
+					if err := nni.RemoveChildNameNode(name); err != nil {
+						return fmt.Errorf("failed to remove %s: %w", name, err)
+					}
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// CopyNameNodeTree returns deep copy of name node tree.
+// New name nodes are created by generator and rrsets are copied by RRSetInterface.Copy.
+func CopyNameNodeTree(nni NameNodeInterface, generator NameNodeGenerator) (NameNodeInterface, error) {
+	if generator == nil {
+		generator = &DefaultGenerator{}
+	}
+	nn, err := generator.NewNameNode(nni.GetName(), nni.GetClass())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create name node: %w", err)
+	}
+	for _, set := range nni.CopyRRSetMap() {
+		if err := nn.SetRRSet(set.Copy()); err != nil {
+			return nil, fmt.Errorf("failed to set rrset: %w", err)
+		}
+	}
+	for _, child := range nni.CopyChildNodes() {
+		cn, err := CopyNameNodeTree(child, generator)
+		if err != nil {
+			return nil, err
+		}
+		if err := nn.AddChildNameNode(cn); err != nil {
+			return nil, fmt.Errorf("failed to add child node: %w", err)
+		}
+	}
+	return nn, nil
+}
+
 // GetRDATA returns RDATA from dns.RR
 func GetRDATA(rr dns.RR) string {
 	v := strings.SplitN(rr.String(), "\t", 5)
@@ -324,12 +370,8 @@ func MakeRR(r RRSetInterface, rdata string) (dns.RR, error) {
 }
 
 func GetSOA(z ZoneInterface) (*dns.SOA, error) {
-	soaRRSet := z.GetRootNode().GetRRSet(dns.TypeSOA)
-	if soaRRSet == nil {
-		return nil, ErrBadZone
-	}
-	soa, ok := soaRRSet.GetRRs()[0].(*dns.SOA)
-	if !ok {
+	soa, err := GetFirstTyped[*dns.SOA](z.GetRootNode(), dns.TypeSOA)
+	if err != nil {
 		return nil, ErrBadZone
 	}
 	return soa, nil
@@ -57,3 +57,16 @@ func CompareRR(a, b dns.RR) (int, error) {
 		bufB[uint16(offB)-b.Header().Rdlength:offB],
 	), nil
 }
+
+// CompareSerial compares SOA serial numbers using serial number arithmetic (rfc1982).
+// The result will be 0 if a == b, -1 if a < b, and +1 if a > b.
+// If the comparison is undefined (distance is 2^31), it returns -1.
+func CompareSerial(a, b uint32) int {
+	if a == b {
+		return 0
+	}
+	if int32(a-b) < 0 {
+		return -1
+	}
+	return 1
+}
@@ -97,4 +97,14 @@ var _ = Describe("utils", func() {
 			})
 		})
 	})
+	Context("CompareSerial", func() {
+		It("compares serial by rfc1982", func() {
+			Expect(dnsutils.CompareSerial(1, 1)).To(Equal(0))
+			Expect(dnsutils.CompareSerial(1, 2)).To(Equal(-1))
+			Expect(dnsutils.CompareSerial(2, 1)).To(Equal(1))
+			Expect(dnsutils.CompareSerial(0xffffffff, 1)).To(Equal(-1))
+			Expect(dnsutils.CompareSerial(1, 0xffffffff)).To(Equal(1))
+			Expect(dnsutils.CompareSerial(0, 1<<31)).To(Equal(-1))
+		})
+	})
 })
@@ -1,6 +1,7 @@
 package dnsutils_test
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 
@@ -9,8 +10,20 @@ import (
 	. "github.com/mimuret/dnsutils/testtool"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
 )
 
+// BeEquivalentNameNode succeeds when actual has same name, class, rrsets and children as expected.
+// The link to the parent node is ignored.
+func BeEquivalentNameNode(expected dnsutils.NameNodeInterface) types.GomegaMatcher {
+	return SatisfyAll(
+		WithTransform(func(n dnsutils.NameNodeInterface) string { return n.GetName() }, Equal(expected.GetName())),
+		WithTransform(func(n dnsutils.NameNodeInterface) dns.Class { return n.GetClass() }, Equal(expected.GetClass())),
+		WithTransform(func(n dnsutils.NameNodeInterface) map[uint16]dnsutils.RRSetInterface { return n.CopyRRSetMap() }, Equal(expected.CopyRRSetMap())),
+		WithTransform(func(n dnsutils.NameNodeInterface) map[string]dnsutils.NameNodeInterface { return n.CopyChildNodes() }, Equal(expected.CopyChildNodes())),
+	)
+}
+
 var _ dnsutils.NameNodeInterface = &BrokenNode{}
 
 type BrokenNode struct {
@@ -23,6 +36,25 @@ func (n *BrokenNode) GetNameNode(target string) (node dnsutils.NameNodeInterface
 	return nn, ok
 }
 
+var _ dnsutils.NameNodeInterface = &NoPruneNode{}
+
+// NoPruneNode is NameNodeInterface implementation which does not prune empty nodes.
+type NoPruneNode struct {
+	*dnsutils.NameNode
+}
+
+type NoPruneGenerator struct {
+	dnsutils.DefaultGenerator
+}
+
+func (g *NoPruneGenerator) NewNameNode(name string, class dns.Class) (dnsutils.NameNodeInterface, error) {
+	nn, err := dnsutils.NewNameNode(name, class)
+	if err != nil {
+		return nil, err
+	}
+	return &NoPruneNode{NameNode: nn}, nil
+}
+
 var _ = Describe("utils", func() {
 	var (
 		soa = MustNewRR("example.jp. 300 IN SOA localhost. root.localhost. 1 3600 600 86400 900")
@@ -486,7 +518,9 @@ var _ = Describe("utils", func() {
 				Expect(err).To(Succeed())
 				wwwNode.SetRRSet(set)
 				dnsutils.SetNameNode(root, wwwNode, nil)
-				Expect(dnsutils.GetNameNodeOrCreate(root, "www.example.jp", nil)).To(Equal(wwwNode))
+				nameNode, err := dnsutils.GetNameNodeOrCreate(root, "www.example.jp", nil)
+				Expect(err).To(Succeed())
+				Expect(nameNode).To(BeEquivalentNameNode(wwwNode))
 			})
 		})
 		When("not exist node", func() {
@@ -848,6 +882,97 @@ var _ = Describe("utils", func() {
 			})
 		})
 	})
+	Context("Compact", func() {
+		var (
+			z   *dnsutils.Zone
+			err error
+		)
+		BeforeEach(func() {
+			z = MustNewZone("example.jp.", dns.ClassINET)
+			root := z.GetRootNode()
+			www := MustNewNameNode("www.example.jp.", dns.ClassINET)
+			Expect(root.AddChildNameNode(www)).To(Succeed())
+			blue := MustNewNameNode("blue.www.example.jp.", dns.ClassINET)
+			Expect(www.AddChildNameNode(blue)).To(Succeed())
+			red := MustNewNameNode("red.www.example.jp.", dns.ClassINET)
+			Expect(www.AddChildNameNode(red)).To(Succeed())
+			Expect(red.SetRRSet(dnsutils.NewRRSetFromRR(MustNewRR("red.www.example.jp. 300 IN A 192.168.0.1")))).To(Succeed())
+			mail := MustNewNameNode("mail.example.jp.", dns.ClassINET)
+			Expect(root.AddChildNameNode(mail)).To(Succeed())
+			alpha := MustNewNameNode("alpha.mail.example.jp.", dns.ClassINET)
+			Expect(mail.AddChildNameNode(alpha)).To(Succeed())
+			err = dnsutils.Compact(z)
+		})
+		It("removes empty leaf nodes", func() {
+			Expect(err).To(Succeed())
+			_, ok := z.GetRootNode().GetNameNode("blue.www.example.jp.")
+			Expect(ok).To(BeFalse())
+			_, ok = z.GetRootNode().GetNameNode("alpha.mail.example.jp.")
+			Expect(ok).To(BeFalse())
+			_, ok = z.GetRootNode().GetNameNode("mail.example.jp.")
+			Expect(ok).To(BeFalse())
+			_, ok = z.GetRootNode().GetNameNode("www.example.jp.")
+			Expect(ok).To(BeTrue())
+			_, ok = z.GetRootNode().GetNameNode("red.www.example.jp.")
+			Expect(ok).To(BeTrue())
+		})
+		When("name node implementation does not prune", func() {
+			var (
+				nz  *dnsutils.Zone
+				red dnsutils.NameNodeInterface
+			)
+			BeforeEach(func() {
+				g := &NoPruneGenerator{}
+				nz, err = dnsutils.NewZone("example.jp.", dns.ClassINET, g)
+				Expect(err).To(Succeed())
+				red, err = g.NewNameNode("red.www.example.jp.", dns.ClassINET)
+				Expect(err).To(Succeed())
+				Expect(dnsutils.SetNameNode(nz.GetRootNode(), red, g)).To(Succeed())
+				red, _ = nz.GetRootNode().GetNameNode("red.www.example.jp.")
+				Expect(red.SetRRSet(dnsutils.NewRRSetFromRR(MustNewRR("red.www.example.jp. 300 IN A 192.168.0.1")))).To(Succeed())
+				Expect(red.RemoveRRSet(dns.TypeA)).To(Succeed())
+			})
+			It("leaves empty nodes until Compact is called", func() {
+				_, ok := nz.GetRootNode().GetNameNode("red.www.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(dnsutils.Compact(nz)).To(Succeed())
+				_, ok = nz.GetRootNode().GetNameNode("red.www.example.jp.")
+				Expect(ok).To(BeFalse())
+				_, ok = nz.GetRootNode().GetNameNode("www.example.jp.")
+				Expect(ok).To(BeFalse())
+			})
+		})
+	})
+	Context("CopyNameNodeTree", func() {
+		var (
+			z   *dnsutils.Zone
+			cp  dnsutils.NameNodeInterface
+			err error
+		)
+		BeforeEach(func() {
+			z = &dnsutils.Zone{}
+			Expect(z.Read(bytes.NewBuffer(testZoneNormal))).To(Succeed())
+			cp, err = dnsutils.CopyNameNodeTree(z.GetRootNode(), nil)
+		})
+		It("returns same tree", func() {
+			Expect(err).To(Succeed())
+			Expect(dnsutils.IsEqualsAllTree(z.GetRootNode(), cp, true)).To(BeTrue())
+		})
+		It("does not share nodes", func() {
+			Expect(err).To(Succeed())
+			Expect(dnsutils.RemoveNameNode(cp, "www.example.jp.")).To(Succeed())
+			_, ok := z.GetRootNode().GetNameNode("www.example.jp.")
+			Expect(ok).To(BeTrue())
+		})
+		When("generator returns error", func() {
+			BeforeEach(func() {
+				cp, err = dnsutils.CopyNameNodeTree(z.GetRootNode(), &TestGenerator{NewNewNameNodeErr: fmt.Errorf("error")})
+			})
+			It("returns error", func() {
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
 	Context("Test SetNameNode", func() {
 		var (
 			g    *TestGenerator
@@ -870,7 +995,7 @@ var _ = Describe("utils", func() {
 			Expect(err).To(Succeed())
 			nameNode, ok := root.GetNameNode("www5.example.jp")
 			Expect(ok).To(BeTrue())
-			Expect(nameNode).To(Equal(www5))
+			Expect(nameNode).To(BeEquivalentNameNode(www5))
 		})
 		It("can set not directly child node", func() {
 			red := MustNewNameNode("red.www5.example.jp", dns.ClassINET)
@@ -878,7 +1003,7 @@ var _ = Describe("utils", func() {
 			Expect(err).To(Succeed())
 			nameNode, ok := root.GetNameNode("red.www5.example.jp")
 			Expect(ok).To(BeTrue())
-			Expect(nameNode).To(Equal(red))
+			Expect(nameNode).To(BeEquivalentNameNode(red))
 		})
 		It("can replace exist node", func() {
 			newwww1 := MustNewNameNode("www1.example.jp", dns.ClassINET)
@@ -890,7 +1015,7 @@ var _ = Describe("utils", func() {
 			Expect(err).To(Succeed())
 			nameNode, ok := root.GetNameNode("www1.example.jp")
 			Expect(ok).To(BeTrue())
-			Expect(nameNode).To(Equal(newwww1))
+			Expect(nameNode).To(BeEquivalentNameNode(newwww1))
 		})
 		When("failed to create name node", func() {
 			var (
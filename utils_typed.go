@@ -0,0 +1,76 @@
+package dnsutils
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/miekg/dns"
+)
+
+// RRsOf returns rrset's RRs as T.
+// If rrset is nil, returns nil.
+// It returns ErrInvalid when rrset includes RR which is not T.
+func RRsOf[T dns.RR](set RRSetInterface) ([]T, error) {
+	if set == nil {
+		return nil, nil
+	}
+	rrs := set.GetRRs()
+	res := make([]T, 0, len(rrs))
+	for _, rr := range rrs {
+		t, ok := rr.(T)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not %T", ErrInvalid, rr.String(), t)
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// GetTyped returns RRs of name node's rrset as T.
+// If rrset does not exist, returns nil.
+// It returns ErrInvalid when rrset includes RR which is not T.
+func GetTyped[T dns.RR](n NameNodeInterface, rrtype uint16) ([]T, error) {
+	return RRsOf[T](n.GetRRSet(rrtype))
+}
+
+// GetFirstTyped returns first RR of name node's rrset as T.
+// It returns ErrEmptyRRs when rrset does not exist or is empty.
+// It returns ErrInvalid when rrset includes RR which is not T.
+func GetFirstTyped[T dns.RR](n NameNodeInterface, rrtype uint16) (T, error) {
+	var t T
+	rrs, err := GetTyped[T](n, rrtype)
+	if err != nil {
+		return t, err
+	}
+	if len(rrs) == 0 {
+		return t, ErrEmptyRRs
+	}
+	return rrs[0], nil
+}
+
+// NewTypedRR returns new RR whose header is set by rrset.
+// It returns ErrRRTypeNotEqual when T is not rrset's rrtype.
+//
+//	a, err := NewTypedRR[dns.A](set)
+//	a.A = net.ParseIP("192.0.2.1")
+//	set.AddRR(a)
+func NewTypedRR[T any, PT interface {
+	*T
+	dns.RR
+}](set RRSetInterface) (PT, error) {
+	rr := PT(new(T))
+	if newFunc, ok := dns.TypeToRR[set.GetRRtype()]; ok {
+		if reflect.TypeOf(newFunc()) != reflect.TypeOf(rr) {
+			return nil, ErrRRTypeNotEqual
+		}
+	} else if _, ok := any(rr).(*dns.RFC3597); !ok {
+		return nil, ErrRRTypeNotEqual
+	}
+	*rr.Header() = dns.RR_Header{
+		Name:   set.GetName(),
+		Rrtype: set.GetRRtype(),
+		Class:  uint16(set.GetClass()),
+		Ttl:    set.GetTTL(),
+	}
+	return rr, nil
+}
@@ -0,0 +1,126 @@
+package dnsutils_test
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	. "github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils_typed.go", func() {
+	var (
+		err   error
+		aSet  *dnsutils.RRSet
+		root  *dnsutils.NameNode
+		a1    = MustNewRR("example.jp. 300 IN A 192.168.0.1")
+		a2    = MustNewRR("example.jp. 300 IN A 192.168.0.2")
+		txt   = MustNewRR(`example.jp. 300 IN TXT "hoge"`)
+		as    []*dns.A
+		soa   *dns.SOA
+		newRR *dns.A
+	)
+	BeforeEach(func() {
+		aSet = MustNewRRSet("example.jp.", 300, dns.ClassINET, dns.TypeA, []dns.RR{a1, a2})
+		root = MustNewNameNode("example.jp.", dns.ClassINET)
+		Expect(root.SetRRSet(aSet)).To(Succeed())
+	})
+	Context("RRsOf", func() {
+		When("rrset is nil", func() {
+			BeforeEach(func() {
+				as, err = dnsutils.RRsOf[*dns.A](nil)
+			})
+			It("returns nil", func() {
+				Expect(err).To(Succeed())
+				Expect(as).To(BeNil())
+			})
+		})
+		When("all RRs are T", func() {
+			BeforeEach(func() {
+				as, err = dnsutils.RRsOf[*dns.A](aSet)
+			})
+			It("returns typed RRs", func() {
+				Expect(err).To(Succeed())
+				Expect(as).To(HaveLen(2))
+				Expect(as[0].A.String()).To(Equal("192.168.0.1"))
+			})
+		})
+		When("rrset includes RR which is not T", func() {
+			BeforeEach(func() {
+				set := MustNewRRSet("example.jp.", 300, dns.ClassINET, dns.TypeA, []dns.RR{a1, txt})
+				as, err = dnsutils.RRsOf[*dns.A](set)
+			})
+			It("returns ErrInvalid", func() {
+				Expect(err).To(MatchError(dnsutils.ErrInvalid))
+			})
+		})
+	})
+	Context("GetTyped", func() {
+		When("rrset exists", func() {
+			BeforeEach(func() {
+				as, err = dnsutils.GetTyped[*dns.A](root, dns.TypeA)
+			})
+			It("returns typed RRs", func() {
+				Expect(err).To(Succeed())
+				Expect(as).To(HaveLen(2))
+			})
+		})
+		When("rrset does not exist", func() {
+			BeforeEach(func() {
+				as, err = dnsutils.GetTyped[*dns.A](root, dns.TypeAAAA)
+			})
+			It("returns nil", func() {
+				Expect(err).To(Succeed())
+				Expect(as).To(BeNil())
+			})
+		})
+	})
+	Context("GetFirstTyped", func() {
+		When("rrset does not exist", func() {
+			BeforeEach(func() {
+				soa, err = dnsutils.GetFirstTyped[*dns.SOA](root, dns.TypeSOA)
+			})
+			It("returns ErrEmptyRRs", func() {
+				Expect(err).To(Equal(dnsutils.ErrEmptyRRs))
+				Expect(soa).To(BeNil())
+			})
+		})
+		When("rrset exists", func() {
+			BeforeEach(func() {
+				Expect(root.SetRRSet(dnsutils.NewRRSetFromRR(MustNewRR("example.jp. 300 IN SOA localhost. root.localhost. 1 3600 900 85400 300")))).To(Succeed())
+				soa, err = dnsutils.GetFirstTyped[*dns.SOA](root, dns.TypeSOA)
+			})
+			It("returns first RR", func() {
+				Expect(err).To(Succeed())
+				Expect(soa.Serial).To(Equal(uint32(1)))
+			})
+		})
+	})
+	Context("NewTypedRR", func() {
+		When("type matches", func() {
+			BeforeEach(func() {
+				newRR, err = dnsutils.NewTypedRR[dns.A](aSet)
+			})
+			It("returns RR whose header is set", func() {
+				Expect(err).To(Succeed())
+				Expect(newRR.Hdr.Name).To(Equal("example.jp."))
+				Expect(newRR.Hdr.Ttl).To(Equal(uint32(300)))
+				Expect(newRR.Hdr.Class).To(Equal(uint16(dns.ClassINET)))
+				Expect(newRR.Hdr.Rrtype).To(Equal(dns.TypeA))
+				newRR.A = net.ParseIP("192.168.0.3")
+				Expect(aSet.AddRR(newRR)).To(Succeed())
+				Expect(aSet.Len()).To(Equal(3))
+			})
+		})
+		When("type does not match", func() {
+			BeforeEach(func() {
+				_, err = dnsutils.NewTypedRR[dns.AAAA](aSet)
+			})
+			It("returns ErrRRTypeNotEqual", func() {
+				Expect(err).To(Equal(dnsutils.ErrRRTypeNotEqual))
+			})
+		})
+	})
+})
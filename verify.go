@@ -0,0 +1,509 @@
+package dnsutils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	ErrVerifyNoDNSKEY        = fmt.Errorf("apex DNSKEY not found")
+	ErrVerifyTrustAnchor     = fmt.Errorf("DNSKEY is not signed by trust anchor")
+	ErrVerifyNoRRSIG         = fmt.Errorf("valid RRSIG not found")
+	ErrVerifyRRSIG           = fmt.Errorf("invalid RRSIG")
+	ErrVerifyValidityPeriod  = fmt.Errorf("RRSIG is out of validity period")
+	ErrVerifyUnknownKey      = fmt.Errorf("RRSIG key not found in DNSKEY")
+	ErrVerifyAlgorithm       = fmt.Errorf("rrset is not signed by all algorithms")
+	ErrVerifyUnexpectedRRSIG = fmt.Errorf("unexpected RRSIG")
+	ErrVerifyDS              = fmt.Errorf("DS exists at non delegation")
+	ErrVerifyNoDoE           = fmt.Errorf("NSEC or NSEC3 not found")
+	ErrVerifyMissingNSEC     = fmt.Errorf("NSEC not found")
+	ErrVerifyUnexpectedNSEC  = fmt.Errorf("unexpected NSEC")
+	ErrVerifyNSECChain       = fmt.Errorf("NSEC chain is broken")
+	ErrVerifyTypeBitMap      = fmt.Errorf("type bitmap mismatch")
+	ErrVerifyNSEC3PARAM      = fmt.Errorf("invalid NSEC3PARAM")
+	ErrVerifyMissingNSEC3    = fmt.Errorf("NSEC3 not found")
+	ErrVerifyUnexpectedNSEC3 = fmt.Errorf("unexpected NSEC3")
+	ErrVerifyNSEC3Chain      = fmt.Errorf("NSEC3 chain is broken")
+)
+
+// VerifyProblem is a problem found by VerifyZone.
+type VerifyProblem struct {
+	Name   string
+	Rrtype uint16
+	Err    error
+}
+
+func (p *VerifyProblem) Error() string {
+	return fmt.Sprintf("%s %s: %s", p.Name, dns.TypeToString[p.Rrtype], p.Err)
+}
+
+func (p *VerifyProblem) Unwrap() error {
+	return p.Err
+}
+
+// VerifyReport is result of VerifyZone.
+type VerifyReport struct {
+	Zone string
+	// DoEMethod is NSEC or NSEC3. It is empty if zone has no denial of existence records.
+	DoEMethod DenialOfExistenceMethod
+	// Algorithms is algorithms of apex DNSKEYs.
+	Algorithms []uint8
+	// RRSets is number of verified rrsets.
+	RRSets int
+	// Signatures is number of valid RRSIGs.
+	Signatures          int
+	SecureDelegations   []string
+	InsecureDelegations []string
+	Problems            []*VerifyProblem
+}
+
+// OK returns true if there are no problems.
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Err returns all problems joined, or nil.
+func (r *VerifyReport) Err() error {
+	errs := make([]error, 0, len(r.Problems))
+	for _, p := range r.Problems {
+		errs = append(errs, p)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *VerifyReport) addProblem(name string, rrtype uint16, err error) {
+	r.Problems = append(r.Problems, &VerifyProblem{Name: name, Rrtype: rrtype, Err: err})
+}
+
+type verifyNodeKind int
+
+const (
+	verifyNodeApex verifyNodeKind = iota
+	verifyNodeAuth
+	verifyNodeDelegation
+	verifyNodeGlue
+	verifyNodeNSEC3
+)
+
+type verifyNode struct {
+	nni  NameNodeInterface
+	kind verifyNodeKind
+}
+
+type zoneVerifier struct {
+	z          ZoneInterface
+	now        time.Time
+	keys       []*dns.DNSKEY
+	algorithms map[uint8]struct{}
+	nodes      []*verifyNode
+	report     *VerifyReport
+}
+
+// VerifyZone verifies DNSSEC signed zone like ldns-verify-zone.
+// It checks RRSIGs of all authoritative rrsets by apex DNSKEYs, their validity periods,
+// algorithm coverage, NSEC or NSEC3 chain and delegations.
+// Like dnssec-verify, RRSIGs by keys which are not in DNSKEY rrset are ignored
+// when the rrset has valid RRSIGs of all algorithms.
+// trustAnchors are DS or DNSKEY RRs of the zone. If they are not empty,
+// the DNSKEY rrset must be signed by a key matching one of them.
+// Problems are reported by VerifyReport, and error is returned only if zone is not valid.
+func VerifyZone(z ZoneInterface, trustAnchors []dns.RR) (*VerifyReport, error) {
+	if _, err := GetSOA(z); err != nil {
+		return nil, fmt.Errorf("invalid zone: %w", err)
+	}
+	v := &zoneVerifier{
+		z:          z,
+		now:        time.Now(),
+		algorithms: map[uint8]struct{}{},
+		report:     &VerifyReport{Zone: z.GetName()},
+	}
+	dnskeys, err := GetTyped[*dns.DNSKEY](z.GetRootNode(), dns.TypeDNSKEY)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNSKEY: %w", err)
+	}
+	for _, key := range dnskeys {
+		if key.Flags&dns.ZONE == 0 || key.Protocol != 3 {
+			continue
+		}
+		v.keys = append(v.keys, key)
+		if _, ok := v.algorithms[key.Algorithm]; !ok {
+			v.algorithms[key.Algorithm] = struct{}{}
+			v.report.Algorithms = append(v.report.Algorithms, key.Algorithm)
+		}
+	}
+	if len(v.keys) == 0 {
+		v.report.addProblem(z.GetName(), dns.TypeDNSKEY, ErrVerifyNoDNSKEY)
+		return v.report, nil
+	}
+	sort.Slice(v.report.Algorithms, func(i, j int) bool { return v.report.Algorithms[i] < v.report.Algorithms[j] })
+	if len(trustAnchors) > 0 {
+		v.verifyTrustAnchors(trustAnchors)
+	}
+	if err := v.collectNodes(); err != nil {
+		return nil, fmt.Errorf("failed to iterate name nodes: %w", err)
+	}
+	for _, n := range v.nodes {
+		v.verifyNode(n)
+	}
+	switch {
+	case !IsEmptyRRSet(z.GetRootNode().GetRRSet(dns.TypeNSEC)):
+		v.report.DoEMethod = DenialOfExistenceMethodNSEC
+		v.verifyNSEC()
+	case !IsEmptyRRSet(z.GetRootNode().GetRRSet(dns.TypeNSEC3PARAM)):
+		v.report.DoEMethod = DenialOfExistenceMethodNSEC3
+		v.verifyNSEC3()
+	default:
+		v.report.addProblem(z.GetName(), dns.TypeNSEC, ErrVerifyNoDoE)
+	}
+	return v.report, nil
+}
+
+func (v *zoneVerifier) verifyTrustAnchors(trustAnchors []dns.RR) {
+	rrsigs := coveredRRSIGs(v.z.GetRootNode(), dns.TypeDNSKEY)
+	set := v.z.GetRootNode().GetRRSet(dns.TypeDNSKEY)
+	for _, key := range v.keys {
+		if !matchTrustAnchor(key, trustAnchors) {
+			continue
+		}
+		for _, rrsig := range rrsigs {
+			if rrsig.KeyTag != key.KeyTag() || rrsig.Algorithm != key.Algorithm {
+				continue
+			}
+			if rrsig.ValidityPeriod(v.now) && rrsig.Verify(key, set.GetRRs()) == nil {
+				return
+			}
+		}
+	}
+	v.report.addProblem(v.z.GetName(), dns.TypeDNSKEY, ErrVerifyTrustAnchor)
+}
+
+func matchTrustAnchor(key *dns.DNSKEY, trustAnchors []dns.RR) bool {
+	for _, ta := range trustAnchors {
+		switch ta := ta.(type) {
+		case *dns.DS:
+			if ds := key.ToDS(ta.DigestType); ds != nil && ds.KeyTag == ta.KeyTag &&
+				ds.Algorithm == ta.Algorithm && strings.EqualFold(ds.Digest, ta.Digest) {
+				return true
+			}
+		case *dns.DNSKEY:
+			if ta.Flags == key.Flags && ta.Algorithm == key.Algorithm && ta.PublicKey == key.PublicKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collectNodes classifies name nodes in canonical order.
+func (v *zoneVerifier) collectNodes() error {
+	apex := v.z.GetRootNode()
+	return apex.IterateNameNodeWithValue(func(nni NameNodeInterface, a any) (any, error) {
+		auth := a.(bool)
+		n := &verifyNode{nni: nni, kind: verifyNodeAuth}
+		switch {
+		case nni == apex:
+			n.kind = verifyNodeApex
+		case !auth:
+			n.kind = verifyNodeGlue
+		case !IsEmptyRRSet(nni.GetRRSet(dns.TypeNS)):
+			n.kind = verifyNodeDelegation
+			auth = false
+		case isNSEC3Owner(nni):
+			n.kind = verifyNodeNSEC3
+		}
+		v.nodes = append(v.nodes, n)
+		return auth, nil
+	}, true)
+}
+
+func isNSEC3Owner(nni NameNodeInterface) bool {
+	types := dataTypes(nni)
+	if len(types) == 0 || IsEmptyRRSet(nni.GetRRSet(dns.TypeNSEC3)) {
+		return false
+	}
+	for _, t := range types {
+		if t != dns.TypeNSEC3 && t != dns.TypeRRSIG {
+			return false
+		}
+	}
+	return true
+}
+
+// dataTypes returns sorted types of non empty rrsets.
+func dataTypes(nni NameNodeInterface) []uint16 {
+	var types []uint16
+	for rrtype, set := range nni.CopyRRSetMap() {
+		if set.Len() > 0 {
+			types = append(types, rrtype)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+func coveredRRSIGs(nni NameNodeInterface, rrtype uint16) []*dns.RRSIG {
+	rrsigs, _ := GetTyped[*dns.RRSIG](nni, dns.TypeRRSIG)
+	var res []*dns.RRSIG
+	for _, rrsig := range rrsigs {
+		if rrsig.TypeCovered == rrtype {
+			res = append(res, rrsig)
+		}
+	}
+	return res
+}
+
+func (v *zoneVerifier) verifyNode(n *verifyNode) {
+	nni := n.nni
+	var signed func(rrtype uint16) bool
+	switch n.kind {
+	case verifyNodeApex, verifyNodeAuth:
+		signed = func(rrtype uint16) bool { return rrtype != dns.TypeRRSIG }
+		if !IsEmptyRRSet(nni.GetRRSet(dns.TypeDS)) {
+			v.report.addProblem(nni.GetName(), dns.TypeDS, ErrVerifyDS)
+		}
+	case verifyNodeDelegation:
+		signed = func(rrtype uint16) bool { return rrtype == dns.TypeDS || rrtype == dns.TypeNSEC }
+		if IsEmptyRRSet(nni.GetRRSet(dns.TypeDS)) {
+			v.report.InsecureDelegations = append(v.report.InsecureDelegations, nni.GetName())
+		} else {
+			v.report.SecureDelegations = append(v.report.SecureDelegations, nni.GetName())
+		}
+	case verifyNodeGlue:
+		signed = func(uint16) bool { return false }
+		if !IsEmptyRRSet(nni.GetRRSet(dns.TypeNSEC)) {
+			v.report.addProblem(nni.GetName(), dns.TypeNSEC, ErrVerifyUnexpectedNSEC)
+		}
+	case verifyNodeNSEC3:
+		signed = func(rrtype uint16) bool { return rrtype == dns.TypeNSEC3 }
+	}
+	types := dataTypes(nni)
+	for _, rrtype := range types {
+		if signed(rrtype) {
+			v.verifyRRSet(nni.GetRRSet(rrtype), coveredRRSIGs(nni, rrtype))
+		}
+	}
+	rrsigs, _ := GetTyped[*dns.RRSIG](nni, dns.TypeRRSIG)
+	reported := map[uint16]struct{}{}
+	for _, rrsig := range rrsigs {
+		if _, ok := reported[rrsig.TypeCovered]; ok {
+			continue
+		}
+		if !signed(rrsig.TypeCovered) || IsEmptyRRSet(nni.GetRRSet(rrsig.TypeCovered)) {
+			v.report.addProblem(nni.GetName(), rrsig.TypeCovered, ErrVerifyUnexpectedRRSIG)
+			reported[rrsig.TypeCovered] = struct{}{}
+		}
+	}
+}
+
+func (v *zoneVerifier) findKey(rrsig *dns.RRSIG) *dns.DNSKEY {
+	if !Equals(rrsig.SignerName, v.z.GetName()) {
+		return nil
+	}
+	for _, key := range v.keys {
+		if key.KeyTag() == rrsig.KeyTag && key.Algorithm == rrsig.Algorithm {
+			return key
+		}
+	}
+	return nil
+}
+
+func (v *zoneVerifier) verifyRRSet(set RRSetInterface, rrsigs []*dns.RRSIG) {
+	v.report.RRSets++
+	name, rrtype := set.GetName(), set.GetRRtype()
+	valid := map[uint8]struct{}{}
+	var unknown []*dns.RRSIG
+	for _, rrsig := range rrsigs {
+		key := v.findKey(rrsig)
+		if key == nil {
+			unknown = append(unknown, rrsig)
+			continue
+		}
+		if !rrsig.ValidityPeriod(v.now) {
+			v.report.addProblem(name, rrtype, fmt.Errorf("%w: key tag %d", ErrVerifyValidityPeriod, rrsig.KeyTag))
+			continue
+		}
+		if err := rrsig.Verify(key, set.GetRRs()); err != nil {
+			v.report.addProblem(name, rrtype, fmt.Errorf("%w: key tag %d: %w", ErrVerifyRRSIG, rrsig.KeyTag, err))
+			continue
+		}
+		v.report.Signatures++
+		valid[rrsig.Algorithm] = struct{}{}
+	}
+	var missing []uint8
+	for _, alg := range v.report.Algorithms {
+		if _, ok := valid[alg]; !ok {
+			missing = append(missing, alg)
+		}
+	}
+	// RRSIGs by keys which are not in DNSKEY rrset are ignored if rrset is signed by all algorithms,
+	// e.g. keys which are not published yet in algorithm rollover.
+	if len(valid) == 0 || len(missing) > 0 {
+		for _, rrsig := range unknown {
+			v.report.addProblem(name, rrtype, fmt.Errorf("%w: key tag %d", ErrVerifyUnknownKey, rrsig.KeyTag))
+		}
+	}
+	if len(valid) == 0 {
+		v.report.addProblem(name, rrtype, ErrVerifyNoRRSIG)
+		return
+	}
+	for _, alg := range missing {
+		v.report.addProblem(name, rrtype, fmt.Errorf("%w: %s", ErrVerifyAlgorithm, dns.AlgorithmToString[alg]))
+	}
+}
+
+func checkTypeBitMap(nni NameNodeInterface, bitmap []uint16) error {
+	expected := dataTypes(nni)
+	actual := append([]uint16{}, bitmap...)
+	sort.Slice(actual, func(i, j int) bool { return actual[i] < actual[j] })
+	if typesString(expected) != typesString(actual) {
+		return fmt.Errorf("%w: expected [%s], got [%s]", ErrVerifyTypeBitMap, typesString(expected), typesString(actual))
+	}
+	return nil
+}
+
+func typesString(types []uint16) string {
+	s := make([]string, 0, len(types))
+	for _, t := range types {
+		s = append(s, dns.TypeToString[t])
+	}
+	return strings.Join(s, " ")
+}
+
+func (v *zoneVerifier) verifyNSEC() {
+	var names []NameNodeInterface
+	for _, n := range v.nodes {
+		switch n.kind {
+		case verifyNodeApex, verifyNodeDelegation:
+			names = append(names, n.nni)
+		case verifyNodeAuth:
+			if !IsENT(n.nni) {
+				names = append(names, n.nni)
+			}
+		}
+	}
+	for i, nni := range names {
+		nsec, err := GetFirstTyped[*dns.NSEC](nni, dns.TypeNSEC)
+		if err != nil {
+			v.report.addProblem(nni.GetName(), dns.TypeNSEC, ErrVerifyMissingNSEC)
+			continue
+		}
+		next := names[(i+1)%len(names)].GetName()
+		if !Equals(nsec.NextDomain, next) {
+			v.report.addProblem(nni.GetName(), dns.TypeNSEC, fmt.Errorf("%w: next %s, expected %s", ErrVerifyNSECChain, nsec.NextDomain, next))
+		}
+		if err := checkTypeBitMap(nni, nsec.TypeBitMap); err != nil {
+			v.report.addProblem(nni.GetName(), dns.TypeNSEC, err)
+		}
+	}
+}
+
+// optOutRequiredNames returns names which need NSEC3 RR even if opt-out is set.
+// They are names other than ENTs and insecure delegations, and their ancestors.
+// nodes must not include glue and occluded names.
+func optOutRequiredNames(zoneName string, nodes []NameNodeInterface) map[string]struct{} {
+	level := uint(dns.CountLabel(zoneName))
+	required := map[string]struct{}{}
+	for _, nni := range nodes {
+		if IsENT(nni) {
+			continue
+		}
+		if !Equals(nni.GetName(), zoneName) && !IsEmptyRRSet(nni.GetRRSet(dns.TypeNS)) && IsEmptyRRSet(nni.GetRRSet(dns.TypeDS)) {
+			continue
+		}
+		parents, _ := GetAllParentNames(nni.GetName(), level)
+		for _, parent := range parents {
+			required[parent] = struct{}{}
+		}
+	}
+	return required
+}
+
+func (v *zoneVerifier) verifyNSEC3() {
+	apex := v.z.GetRootNode()
+	param, err := GetFirstTyped[*dns.NSEC3PARAM](apex, dns.TypeNSEC3PARAM)
+	if err != nil {
+		v.report.addProblem(apex.GetName(), dns.TypeNSEC3PARAM, ErrVerifyNSEC3PARAM)
+		return
+	}
+	// NSEC3 RRs by hash
+	nsec3s := map[string]*dns.NSEC3{}
+	owners := map[string]string{}
+	var hashes []string
+	for _, n := range v.nodes {
+		if n.kind != verifyNodeNSEC3 {
+			continue
+		}
+		nsec3, err := GetFirstTyped[*dns.NSEC3](n.nni, dns.TypeNSEC3)
+		if err != nil {
+			continue
+		}
+		if nsec3.Hash != param.Hash || nsec3.Iterations != param.Iterations || !strings.EqualFold(nsec3.Salt, param.Salt) {
+			v.report.addProblem(n.nni.GetName(), dns.TypeNSEC3, fmt.Errorf("%w: parameters mismatch", ErrVerifyNSEC3PARAM))
+			continue
+		}
+		hash := strings.ToLower(dns.SplitDomainName(n.nni.GetName())[0])
+		nsec3s[hash] = nsec3
+		owners[hash] = n.nni.GetName()
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	for i, hash := range hashes {
+		next := hashes[(i+1)%len(hashes)]
+		if !strings.EqualFold(nsec3s[hash].NextDomain, next) {
+			v.report.addProblem(owners[hash], dns.TypeNSEC3, fmt.Errorf("%w: next %s, expected %s", ErrVerifyNSEC3Chain, nsec3s[hash].NextDomain, next))
+		}
+	}
+	covering := func(hash string) *dns.NSEC3 {
+		if len(hashes) == 0 {
+			return nil
+		}
+		i := sort.SearchStrings(hashes, hash)
+		if i == 0 {
+			i = len(hashes)
+		}
+		return nsec3s[hashes[i-1]]
+	}
+
+	// names which must have NSEC3 even if opt-out is set.
+	var nodes []NameNodeInterface
+	for _, n := range v.nodes {
+		switch n.kind {
+		case verifyNodeApex, verifyNodeAuth, verifyNodeDelegation:
+			nodes = append(nodes, n.nni)
+		}
+	}
+	required := optOutRequiredNames(v.z.GetName(), nodes)
+	used := map[string]struct{}{}
+	for _, n := range v.nodes {
+		switch n.kind {
+		case verifyNodeApex, verifyNodeAuth, verifyNodeDelegation:
+		default:
+			continue
+		}
+		name := n.nni.GetName()
+		hash := strings.ToLower(dns.HashName(name, param.Hash, param.Iterations, param.Salt))
+		if nsec3, ok := nsec3s[hash]; ok {
+			used[hash] = struct{}{}
+			if err := checkTypeBitMap(n.nni, nsec3.TypeBitMap); err != nil {
+				v.report.addProblem(name, dns.TypeNSEC3, err)
+			}
+			continue
+		}
+		if _, ok := required[dns.CanonicalName(name)]; !ok && n.kind != verifyNodeApex {
+			if c := covering(hash); c != nil && c.Flags&0x01 != 0 {
+				continue
+			}
+		}
+		v.report.addProblem(name, dns.TypeNSEC3, ErrVerifyMissingNSEC3)
+	}
+	for _, hash := range hashes {
+		if _, ok := used[hash]; !ok {
+			v.report.addProblem(owners[hash], dns.TypeNSEC3, ErrVerifyUnexpectedNSEC3)
+		}
+	}
+}
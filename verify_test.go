@@ -0,0 +1,227 @@
+package dnsutils_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test verify.go", func() {
+	var (
+		z          *dnsutils.Zone
+		ksk, zsk   *dnsutils.DNSKEY
+		inception  = uint32(1704067200)
+		expiration = uint32(1893456000)
+		opt        dnsutils.SignOption
+	)
+	readZone := func(data []byte) *dnsutils.Zone {
+		z := &dnsutils.Zone{}
+		Expect(z.Read(bytes.NewBuffer(data))).To(Succeed())
+		return z
+	}
+	hasProblem := func(report *dnsutils.VerifyReport, name string, rrtype uint16, target error) bool {
+		for _, p := range report.Problems {
+			if dnsutils.Equals(p.Name, name) && p.Rrtype == rrtype && errors.Is(p, target) {
+				return true
+			}
+		}
+		return false
+	}
+	BeforeEach(func() {
+		var err error
+		ksk, err = dnsutils.ReadDNSKEY(bytes.NewBuffer(testDnskeyED25519KSKPriv), bytes.NewBuffer(testDnskeyED25519KSKPub))
+		Expect(err).To(Succeed())
+		zsk, err = dnsutils.ReadDNSKEY(bytes.NewBuffer(testDnskeyED25519ZSKPriv), bytes.NewBuffer(testDnskeyED25519ZSKPub))
+		Expect(err).To(Succeed())
+		opt = dnsutils.SignOption{
+			DoEMethod:     dnsutils.DenialOfExistenceMethodNSEC,
+			Inception:     &inception,
+			Expiration:    &expiration,
+			ZONEMDEnabled: &False,
+			CDSEnabled:    &False,
+		}
+	})
+	Context("VerifyZone", func() {
+		When("zone is signed by BIND", func() {
+			It("returns no problems with NSEC", func() {
+				report, err := dnsutils.VerifyZone(readZone(testNsecSignedZone), nil)
+				Expect(err).To(Succeed())
+				Expect(report.Err()).To(Succeed())
+				Expect(report.OK()).To(BeTrue())
+				Expect(report.DoEMethod).To(Equal(dnsutils.DenialOfExistenceMethod(dnsutils.DenialOfExistenceMethodNSEC)))
+				Expect(report.Algorithms).To(Equal([]uint8{dns.ED25519}))
+				Expect(report.SecureDelegations).To(Equal([]string{"sub1.example.jp."}))
+				Expect(report.InsecureDelegations).To(Equal([]string{"sub2.example.jp."}))
+				Expect(report.RRSets).To(BeNumerically(">", 0))
+				Expect(report.Signatures).To(Equal(report.RRSets))
+			})
+			It("returns no problems with NSEC3", func() {
+				report, err := dnsutils.VerifyZone(readZone(testNsec3SignedZone), nil)
+				Expect(err).To(Succeed())
+				Expect(report.Err()).To(Succeed())
+				Expect(report.DoEMethod).To(Equal(dnsutils.DenialOfExistenceMethod(dnsutils.DenialOfExistenceMethodNSEC3)))
+			})
+		})
+		When("zone is signed by Sign", func() {
+			It("returns no problems", func() {
+				for _, method := range []dnsutils.DenialOfExistenceMethod{dnsutils.DenialOfExistenceMethodNSEC, dnsutils.DenialOfExistenceMethodNSEC3} {
+					opt.DoEMethod = method
+					opt.ZONEMDEnabled = &True
+					z = readZone(testSignZone)
+					Expect(dnsutils.Sign(z, opt, []*dnsutils.DNSKEY{ksk, zsk}, nil)).To(Succeed())
+					report, err := dnsutils.VerifyZone(z, nil)
+					Expect(err).To(Succeed())
+					Expect(report.Err()).To(Succeed(), string(method))
+				}
+			})
+		})
+		When("trust anchors are specified", func() {
+			BeforeEach(func() {
+				z = readZone(testNsecSignedZone)
+			})
+			It("checks DNSKEY is signed by trust anchor", func() {
+				report, err := dnsutils.VerifyZone(z, []dns.RR{ksk.GetRR().ToDS(dns.SHA256)})
+				Expect(err).To(Succeed())
+				Expect(report.Err()).To(Succeed())
+				report, err = dnsutils.VerifyZone(z, []dns.RR{ksk.GetRR()})
+				Expect(err).To(Succeed())
+				Expect(report.Err()).To(Succeed())
+				report, err = dnsutils.VerifyZone(z, []dns.RR{zsk.GetRR().ToDS(dns.SHA256)})
+				Expect(err).To(Succeed())
+				Expect(hasProblem(report, "example.jp.", dns.TypeDNSKEY, dnsutils.ErrVerifyTrustAnchor)).To(BeTrue())
+			})
+		})
+		When("zone is signed by keys which are not published", func() {
+			var ecdsaZSK *dnsutils.DNSKEY
+			BeforeEach(func() {
+				var err error
+				ecdsaZSK, err = dnsutils.GenerateDNSKEY("example.jp.", dns.ClassINET, dns.ECDSAP256SHA256, dnsutils.KeyRoleZSK, 3600, 0)
+				Expect(err).To(Succeed())
+				z = readZone(testSignZone)
+			})
+			It("ignores their RRSIGs if all algorithms sign rrsets", func() {
+				p := &dnsutils.SigningPlan{Published: []*dnsutils.DNSKEY{ksk, zsk}, Signing: []*dnsutils.DNSKEY{ksk, zsk, ecdsaZSK}}
+				Expect(p.Sign(z, opt, nil)).To(Succeed())
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(report.Err()).To(Succeed())
+			})
+			It("reports their RRSIGs if rrsets are not signed by published keys", func() {
+				p := &dnsutils.SigningPlan{Published: []*dnsutils.DNSKEY{ksk}, Signing: []*dnsutils.DNSKEY{ksk, ecdsaZSK}}
+				Expect(p.Sign(z, opt, nil)).To(Succeed())
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(hasProblem(report, "example.jp.", dns.TypeSOA, dnsutils.ErrVerifyUnknownKey)).To(BeTrue())
+				Expect(hasProblem(report, "example.jp.", dns.TypeSOA, dnsutils.ErrVerifyNoRRSIG)).To(BeTrue())
+			})
+		})
+		When("zone is broken", func() {
+			BeforeEach(func() {
+				z = readZone(testSignZone)
+			})
+			It("detects changed rrset", func() {
+				Expect(dnsutils.Sign(z, opt, []*dnsutils.DNSKEY{ksk, zsk}, nil)).To(Succeed())
+				nn, ok := z.GetRootNode().GetNameNode("test.hoge.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(nn.SetRRSet(dnsutils.NewRRSetFromRR(testtool.MustNewRR("test.hoge.example.jp. 3600 IN A 192.168.2.3")))).To(Succeed())
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(hasProblem(report, "test.hoge.example.jp.", dns.TypeA, dnsutils.ErrVerifyRRSIG)).To(BeTrue())
+				Expect(hasProblem(report, "test.hoge.example.jp.", dns.TypeA, dnsutils.ErrVerifyNoRRSIG)).To(BeTrue())
+				Expect(report.Problems).To(HaveLen(2))
+			})
+			It("detects expired RRSIG", func() {
+				expired := uint32(1704153600)
+				opt.Expiration = &expired
+				Expect(dnsutils.Sign(z, opt, []*dnsutils.DNSKEY{ksk, zsk}, nil)).To(Succeed())
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(hasProblem(report, "example.jp.", dns.TypeSOA, dnsutils.ErrVerifyValidityPeriod)).To(BeTrue())
+				Expect(report.Signatures).To(Equal(0))
+			})
+			It("detects algorithm which doesn't sign all rrsets", func() {
+				key := &dns.DNSKEY{
+					Hdr:       dns.RR_Header{Name: "example.jp.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+					Flags:     256,
+					Protocol:  3,
+					Algorithm: dns.ECDSAP256SHA256,
+				}
+				priv, err := key.Generate(256)
+				Expect(err).To(Succeed())
+				ecdsaZSK, err := dnsutils.ReadDNSKEY(strings.NewReader(key.PrivateKeyString(priv)), strings.NewReader(key.String()))
+				Expect(err).To(Succeed())
+				Expect(dnsutils.Sign(z, opt, []*dnsutils.DNSKEY{ksk, zsk, ecdsaZSK}, nil)).To(Succeed())
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(report.Algorithms).To(Equal([]uint8{dns.ECDSAP256SHA256, dns.ED25519}))
+				Expect(hasProblem(report, "example.jp.", dns.TypeDNSKEY, dnsutils.ErrVerifyAlgorithm)).To(BeTrue())
+				Expect(report.Problems).To(HaveLen(1))
+			})
+			It("detects broken NSEC chain", func() {
+				Expect(dnsutils.Sign(z, opt, []*dnsutils.DNSKEY{ksk, zsk}, nil)).To(Succeed())
+				nn, ok := z.GetRootNode().GetNameNode("test.hoge.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(nn.RemoveRRSet(dns.TypeNSEC)).To(Succeed())
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(hasProblem(report, "test.hoge.example.jp.", dns.TypeNSEC, dnsutils.ErrVerifyMissingNSEC)).To(BeTrue())
+				Expect(hasProblem(report, "test.hoge.example.jp.", dns.TypeNSEC, dnsutils.ErrVerifyUnexpectedRRSIG)).To(BeTrue())
+			})
+			It("detects type bitmap mismatch", func() {
+				Expect(dnsutils.Sign(z, opt, []*dnsutils.DNSKEY{ksk, zsk}, nil)).To(Succeed())
+				nn, ok := z.GetRootNode().GetNameNode("test.hoge.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(nn.SetRRSet(dnsutils.NewRRSetFromRR(testtool.MustNewRR("test.hoge.example.jp. 3600 IN TXT \"hoge\"")))).To(Succeed())
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(hasProblem(report, "test.hoge.example.jp.", dns.TypeNSEC, dnsutils.ErrVerifyTypeBitMap)).To(BeTrue())
+				Expect(hasProblem(report, "test.hoge.example.jp.", dns.TypeTXT, dnsutils.ErrVerifyNoRRSIG)).To(BeTrue())
+			})
+			It("detects missing NSEC3 of ENT", func() {
+				opt.DoEMethod = dnsutils.DenialOfExistenceMethodNSEC3
+				Expect(dnsutils.Sign(z, opt, []*dnsutils.DNSKEY{ksk, zsk}, nil)).To(Succeed())
+				hash := strings.ToLower(dns.HashName("hoge.example.jp.", dns.SHA1, 0, ""))
+				Expect(dnsutils.RemoveNameNode(z.GetRootNode(), hash+".example.jp.")).To(Succeed())
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(hasProblem(report, "hoge.example.jp.", dns.TypeNSEC3, dnsutils.ErrVerifyMissingNSEC3)).To(BeTrue())
+				Expect(report.Err()).To(MatchError(dnsutils.ErrVerifyNSEC3Chain))
+			})
+			It("detects missing NSEC3 of insecure delegation without opt-out", func() {
+				opt.DoEMethod = dnsutils.DenialOfExistenceMethodNSEC3
+				Expect(dnsutils.Sign(z, opt, []*dnsutils.DNSKEY{ksk, zsk}, nil)).To(Succeed())
+				hash := strings.ToLower(dns.HashName("sub2.example.jp.", dns.SHA1, 0, ""))
+				Expect(dnsutils.RemoveNameNode(z.GetRootNode(), hash+".example.jp.")).To(Succeed())
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(hasProblem(report, "sub2.example.jp.", dns.TypeNSEC3, dnsutils.ErrVerifyMissingNSEC3)).To(BeTrue())
+			})
+			It("detects DS at non delegation", func() {
+				Expect(z.GetRootNode().SetRRSet(dnsutils.NewRRSetFromRR(testtool.MustNewRR("example.jp. 3600 IN DS 1 8 2 41AD6EC23454A202D05BD75D9C323825C9822B9850CB1793CAB2DA2814C74140")))).To(Succeed())
+				Expect(dnsutils.Sign(z, opt, []*dnsutils.DNSKEY{ksk, zsk}, nil)).To(Succeed())
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(hasProblem(report, "example.jp.", dns.TypeDS, dnsutils.ErrVerifyDS)).To(BeTrue())
+			})
+			It("reports unsigned zone", func() {
+				report, err := dnsutils.VerifyZone(z, nil)
+				Expect(err).To(Succeed())
+				Expect(hasProblem(report, "example.jp.", dns.TypeDNSKEY, dnsutils.ErrVerifyNoDNSKEY)).To(BeTrue())
+			})
+		})
+		When("zone has no SOA", func() {
+			It("returns error", func() {
+				z, err := dnsutils.NewZone("example.jp.", dns.ClassINET, nil)
+				Expect(err).To(Succeed())
+				_, err = dnsutils.VerifyZone(z, nil)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
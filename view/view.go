@@ -0,0 +1,308 @@
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/matcher"
+	"github.com/mimuret/dnsutils/tsig"
+)
+
+var (
+	// ErrNoQuestion returns when msg has no question.
+	ErrNoQuestion = fmt.Errorf("question is empty")
+	// ErrNotFoundView returns when no view matches.
+	ErrNotFoundView = fmt.Errorf("view not found")
+	// ErrNotFoundZone returns when matched view has no zone for qname.
+	ErrNotFoundZone = fmt.Errorf("zone not found")
+	// ErrZoneExist returns when the view already has same zone.
+	ErrZoneExist = fmt.Errorf("zone is exist")
+)
+
+// View is a set of zones selected by MatcherSet.
+type View struct {
+	name    string
+	matcher *matcher.MatcherSet
+	mu      sync.RWMutex
+	zones   map[string]dnsutils.ZoneInterface
+}
+
+// NewView creates View.
+// If set is nil, the view matches all clients.
+func NewView(name string, set *matcher.MatcherSet) *View {
+	return &View{
+		name:    name,
+		matcher: set,
+		zones:   map[string]dnsutils.ZoneInterface{},
+	}
+}
+
+// GetName returns view name
+func (v *View) GetName() string { return v.name }
+
+// AddZone adds zone into view.
+// It returns ErrZoneExist when same name zone exists.
+func (v *View) AddZone(z dnsutils.ZoneInterface) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.zones[z.GetName()]; ok {
+		return ErrZoneExist
+	}
+	v.zones[z.GetName()] = z
+	return nil
+}
+
+// SetZone adds or replaces zone in view.
+func (v *View) SetZone(z dnsutils.ZoneInterface) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.zones[z.GetName()] = z
+}
+
+// RemoveZone removes zone from view.
+func (v *View) RemoveZone(name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.zones, dns.CanonicalName(name))
+}
+
+// GetZone returns zone by zone name.
+func (v *View) GetZone(name string) (dnsutils.ZoneInterface, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	z, ok := v.zones[dns.CanonicalName(name)]
+	return z, ok
+}
+
+// FindZone returns the most specific zone which contains qname.
+func (v *View) FindZone(qname string) (dnsutils.ZoneInterface, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	names, ok := dnsutils.GetAllParentNames(dns.CanonicalName(qname), 0)
+	if !ok {
+		return nil, false
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		if z, ok := v.zones[names[i]]; ok {
+			return z, true
+		}
+	}
+	if z, ok := v.zones["."]; ok {
+		return z, true
+	}
+	return nil, false
+}
+
+// Match checks msg and client address by MatcherSet.
+// Client address is given to DNSTAP matchers as query address, port, family and protocol.
+// tsigVerified must be true only when TSIG of msg is verified, otherwise TSIG is hidden from DNS matchers.
+func (v *View) Match(msg *dns.Msg, addr net.Addr, tsigVerified bool) bool {
+	if v.matcher == nil {
+		return true
+	}
+	if !tsigVerified {
+		msg = withoutTSIG(msg)
+	}
+	return v.match(NewDnstap(msg, addr), msg)
+}
+
+func (v *View) match(dt *dnstap.Dnstap, msg *dns.Msg) bool {
+	if v.matcher == nil {
+		return true
+	}
+	return v.matcher.Match(dt, msg)
+}
+
+// withoutTSIG returns shallow copy of msg which has no TSIG RR.
+func withoutTSIG(msg *dns.Msg) *dns.Msg {
+	if msg.IsTsig() == nil {
+		return msg
+	}
+	m := *msg
+	m.Extra = append([]dns.RR(nil), msg.Extra[:len(msg.Extra)-1]...)
+	return &m
+}
+
+// NewDnstap returns AUTH_QUERY dnstap message which has client address information.
+func NewDnstap(msg *dns.Msg, addr net.Addr) *dnstap.Dnstap {
+	m := &dnstap.Message{
+		Type: dnstap.Message_AUTH_QUERY.Enum(),
+	}
+	if msg != nil {
+		if bs, err := msg.Pack(); err == nil {
+			m.QueryMessage = bs
+		}
+	}
+	var (
+		ip   net.IP
+		port int
+	)
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip, port = a.IP, a.Port
+		m.SocketProtocol = dnstap.SocketProtocol_UDP.Enum()
+	case *net.TCPAddr:
+		ip, port = a.IP, a.Port
+		m.SocketProtocol = dnstap.SocketProtocol_TCP.Enum()
+	}
+	if ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			m.SocketFamily = dnstap.SocketFamily_INET.Enum()
+			m.QueryAddress = ip4
+		} else {
+			m.SocketFamily = dnstap.SocketFamily_INET6.Enum()
+			m.QueryAddress = ip.To16()
+		}
+		p := uint32(port)
+		m.QueryPort = &p
+	}
+	return &dnstap.Dnstap{
+		Type:    dnstap.Dnstap_MESSAGE.Enum(),
+		Message: m,
+	}
+}
+
+// Views is the ordered list of View.
+// It is safe for concurrent use.
+type Views struct {
+	mu      sync.RWMutex
+	views   []*View
+	keyRing *tsig.KeyRing
+}
+
+// NewViews creates Views.
+func NewViews(views ...*View) *Views {
+	return &Views{views: views}
+}
+
+// GetViews returns copy of view list.
+func (v *Views) GetViews() []*View {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return append([]*View(nil), v.views...)
+}
+
+// SetViews replaces view list.
+func (v *Views) SetViews(views []*View) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.views = append([]*View(nil), views...)
+}
+
+// SetKeyRing sets key ring for verifying TSIG of msg.
+// If key ring is not set, TSIG is not used for matching.
+func (v *Views) SetKeyRing(kr *tsig.KeyRing) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keyRing = kr
+}
+
+// Select returns the first view which matches msg and client address of w.
+// TSIG of msg is used for matching only when it is verified by key ring.
+func (v *Views) Select(w dns.ResponseWriter, msg *dns.Msg) (*View, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.keyRing == nil {
+		msg = withoutTSIG(msg)
+	} else if _, ok := v.keyRing.KeyName(w, msg); !ok {
+		msg = withoutTSIG(msg)
+	}
+	dt := NewDnstap(msg, w.RemoteAddr())
+	for _, view := range v.views {
+		if view.match(dt, msg) {
+			return view, nil
+		}
+	}
+	return nil, ErrNotFoundView
+}
+
+// Lookup returns the zone for question name from the first view which matches msg and client address of w.
+// It does not fall through to next views when matched view has no zone.
+func (v *Views) Lookup(w dns.ResponseWriter, msg *dns.Msg) (*View, dnsutils.ZoneInterface, error) {
+	if len(msg.Question) == 0 {
+		return nil, nil, ErrNoQuestion
+	}
+	view, err := v.Select(w, msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	z, ok := view.FindZone(msg.Question[0].Name)
+	if !ok {
+		return view, nil, ErrNotFoundZone
+	}
+	return view, z, nil
+}
+
+// Config is the JSON config of Views.
+type Config struct {
+	Views []ViewConfig
+}
+
+// ViewConfig is the JSON config of View.
+type ViewConfig struct {
+	Name string
+	// Matcher is matcher config. If nil, the view matches all clients.
+	Matcher *matcher.Config
+	// Zones is the zone names of view.
+	Zones []string
+}
+
+// ZoneProvider provides zones for view.
+type ZoneProvider interface {
+	GetZone(view, name string) (dnsutils.ZoneInterface, error)
+}
+
+// ZoneProviderFunc is function implement of ZoneProvider.
+type ZoneProviderFunc func(view, name string) (dnsutils.ZoneInterface, error)
+
+// GetZone calls f(view, name).
+func (f ZoneProviderFunc) GetZone(view, name string) (dnsutils.ZoneInterface, error) {
+	return f(view, name)
+}
+
+// NewViewsFromConfig creates view list by Config.
+func NewViewsFromConfig(c *Config, zp ZoneProvider) ([]*View, error) {
+	var views []*View
+	for _, vc := range c.Views {
+		var set *matcher.MatcherSet
+		if vc.Matcher != nil {
+			var err error
+			set, err = matcher.BuilderMatchSet(vc.Matcher)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create matcher of view %s: %w", vc.Name, err)
+			}
+		}
+		view := NewView(vc.Name, set)
+		for _, name := range vc.Zones {
+			z, err := zp.GetZone(vc.Name, dns.CanonicalName(name))
+			if err != nil {
+				return nil, fmt.Errorf("failed to get zone %s of view %s: %w", name, vc.Name, err)
+			}
+			if err := view.AddZone(z); err != nil {
+				return nil, fmt.Errorf("failed to add zone %s to view %s: %w", name, vc.Name, err)
+			}
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// Reconfigure replaces view list by JSON config.
+// When it returns error, view list is not changed.
+func (v *Views) Reconfigure(bs []byte, zp ZoneProvider) error {
+	c := &Config{}
+	if err := json.Unmarshal(bs, c); err != nil {
+		return fmt.Errorf("failed to parse json: %w", err)
+	}
+	views, err := NewViewsFromConfig(c, zp)
+	if err != nil {
+		return err
+	}
+	v.SetViews(views)
+	return nil
+}
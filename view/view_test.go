@@ -0,0 +1,308 @@
+package view_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	"github.com/mimuret/dnsutils/matcher"
+	. "github.com/mimuret/dnsutils/testtool"
+	"github.com/mimuret/dnsutils/tsig"
+	"github.com/mimuret/dnsutils/view"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestView(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "view Suite")
+}
+
+func mustNewZone(name string) *dnsutils.Zone {
+	z, err := dnsutils.NewZone(name, dns.ClassINET, nil)
+	Expect(err).To(Succeed())
+	return z
+}
+
+func mustNewMatcherSet(c *matcher.Config) *matcher.MatcherSet {
+	set, err := matcher.BuilderMatchSet(c)
+	Expect(err).To(Succeed())
+	return set
+}
+
+var testViewConfig = []byte(`{
+  "Views": [
+    {
+      "Name": "internal",
+      "Matcher": {
+        "Op": "OR",
+        "Matchers": [
+          {"Type": "DNSTAP", "Name": "QueryAddress", "Arg": "192.168.0.0/16"},
+          {"Type": "DNS", "Name": "ECS", "Arg": "10.0.0.0/8"},
+          {"Type": "DNS", "Name": "TSIGName", "Arg": "internal.key."}
+        ]
+      },
+      "Zones": ["example.jp", "sub.example.jp."]
+    },
+    {
+      "Name": "external",
+      "Zones": ["example.jp."]
+    }
+  ]
+}`)
+
+var _ = Describe("view", func() {
+	var (
+		err      error
+		msg      *dns.Msg
+		internal = &net.UDPAddr{IP: net.ParseIP("192.168.0.1"), Port: 53}
+		external = &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53}
+	)
+	BeforeEach(func() {
+		msg = &dns.Msg{}
+		msg.SetQuestion("www.sub.example.jp.", dns.TypeA)
+	})
+	Context("View", func() {
+		var (
+			v  *view.View
+			z  dnsutils.ZoneInterface
+			ok bool
+		)
+		BeforeEach(func() {
+			v = view.NewView("test", nil)
+			Expect(v.AddZone(mustNewZone("example.jp."))).To(Succeed())
+			Expect(v.AddZone(mustNewZone("sub.example.jp."))).To(Succeed())
+		})
+		It("returns name", func() {
+			Expect(v.GetName()).To(Equal("test"))
+		})
+		Context("AddZone", func() {
+			It("returns ErrZoneExist for same zone", func() {
+				Expect(v.AddZone(mustNewZone("example.jp."))).To(Equal(view.ErrZoneExist))
+			})
+		})
+		Context("SetZone/GetZone/RemoveZone", func() {
+			It("replaces and removes zone", func() {
+				nz := mustNewZone("example.jp.")
+				v.SetZone(nz)
+				z, ok = v.GetZone("Example.JP")
+				Expect(ok).To(BeTrue())
+				Expect(z).To(BeIdenticalTo(nz))
+				v.RemoveZone("example.jp")
+				_, ok = v.GetZone("example.jp.")
+				Expect(ok).To(BeFalse())
+			})
+		})
+		Context("FindZone", func() {
+			It("returns most specific zone", func() {
+				z, ok = v.FindZone("www.sub.example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(z.GetName()).To(Equal("sub.example.jp."))
+				z, ok = v.FindZone("example.jp.")
+				Expect(ok).To(BeTrue())
+				Expect(z.GetName()).To(Equal("example.jp."))
+				_, ok = v.FindZone("example.com.")
+				Expect(ok).To(BeFalse())
+			})
+			It("returns root zone", func() {
+				v.SetZone(mustNewZone("."))
+				z, ok = v.FindZone("example.com.")
+				Expect(ok).To(BeTrue())
+				Expect(z.GetName()).To(Equal("."))
+			})
+		})
+		Context("Match", func() {
+			It("matches all when matcher is nil", func() {
+				Expect(v.Match(msg, nil, false)).To(BeTrue())
+			})
+			It("matches by TSIG name only when TSIG is verified", func() {
+				v = view.NewView("test", mustNewMatcherSet(&matcher.Config{
+					Op: matcher.MatchOpAND,
+					Matchers: []matcher.MatcherConfig{
+						{Type: matcher.MatcherTypeDnsMsg, Name: matcher.DNSMatcherTSIGName, Arg: "internal.key."},
+					},
+				}))
+				msg.SetTsig("internal.key.", dns.HmacSHA256, 300, time.Now().Unix())
+				Expect(v.Match(msg, external, true)).To(BeTrue())
+				Expect(v.Match(msg, external, false)).To(BeFalse())
+				Expect(msg.IsTsig()).NotTo(BeNil())
+			})
+			It("matches by source address", func() {
+				v = view.NewView("test", mustNewMatcherSet(&matcher.Config{
+					Op: matcher.MatchOpAND,
+					Matchers: []matcher.MatcherConfig{
+						{Type: matcher.MatcherTypeDnstap, Name: matcher.DNSTAPMatcherQueryAddress, Arg: "192.168.0.0/16"},
+						{Type: matcher.MatcherTypeDnstap, Name: matcher.DNSTAPMatcherMessageProtocol, Arg: "UDP"},
+					},
+				}))
+				Expect(v.Match(msg, internal, false)).To(BeTrue())
+				Expect(v.Match(msg, external, false)).To(BeFalse())
+				Expect(v.Match(msg, nil, false)).To(BeFalse())
+			})
+		})
+	})
+	Context("NewDnstap", func() {
+		It("sets client address", func() {
+			dt := view.NewDnstap(msg, external)
+			Expect(dt.GetMessage().GetQueryAddress()).To(BeEquivalentTo(net.ParseIP("2001:db8::1")))
+			Expect(dt.GetMessage().GetQueryPort()).To(Equal(uint32(53)))
+			Expect(dt.GetMessage().GetSocketProtocol().String()).To(Equal("TCP"))
+			Expect(dt.GetMessage().GetSocketFamily().String()).To(Equal("INET6"))
+		})
+	})
+	Context("Views", func() {
+		var (
+			views   *view.Views
+			zp      view.ZoneProvider
+			v       *view.View
+			z       dnsutils.ZoneInterface
+			zoneMap map[string]dnsutils.ZoneInterface
+		)
+		BeforeEach(func() {
+			zoneMap = map[string]dnsutils.ZoneInterface{}
+			zp = view.ZoneProviderFunc(func(viewName, name string) (dnsutils.ZoneInterface, error) {
+				z := mustNewZone(name)
+				zoneMap[viewName+"/"+name] = z
+				return z, nil
+			})
+			views = view.NewViews()
+			err = views.Reconfigure(testViewConfig, zp)
+			Expect(err).To(Succeed())
+		})
+		It("has views by config", func() {
+			Expect(views.GetViews()).To(HaveLen(2))
+			Expect(zoneMap).To(HaveLen(3))
+		})
+		When("client is internal address", func() {
+			BeforeEach(func() {
+				v, z, err = views.Lookup(&ResponseWriter{RemoteAddress: internal}, msg)
+			})
+			It("returns internal zone", func() {
+				Expect(err).To(Succeed())
+				Expect(v.GetName()).To(Equal("internal"))
+				Expect(z).To(BeIdenticalTo(zoneMap["internal/sub.example.jp."]))
+			})
+		})
+		When("client is external address", func() {
+			BeforeEach(func() {
+				v, z, err = views.Lookup(&ResponseWriter{RemoteAddress: external}, msg)
+			})
+			It("returns external zone", func() {
+				Expect(err).To(Succeed())
+				Expect(v.GetName()).To(Equal("external"))
+				Expect(z).To(BeIdenticalTo(zoneMap["external/example.jp."]))
+			})
+		})
+		When("msg has internal ECS", func() {
+			BeforeEach(func() {
+				msg.SetEdns0(1232, false)
+				msg.IsEdns0().Option = append(msg.IsEdns0().Option, &dns.EDNS0_SUBNET{
+					Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("10.0.0.0"),
+				})
+				v, _, err = views.Lookup(&ResponseWriter{RemoteAddress: external}, msg)
+			})
+			It("returns internal view", func() {
+				Expect(err).To(Succeed())
+				Expect(v.GetName()).To(Equal("internal"))
+			})
+		})
+		When("msg has internal TSIG key", func() {
+			var kr *tsig.KeyRing
+			BeforeEach(func() {
+				kr, err = tsig.NewKeyRing(&tsig.Key{Name: "internal.key.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})
+				Expect(err).To(Succeed())
+				msg.SetTsig("internal.key.", dns.HmacSHA256, 300, time.Now().Unix())
+			})
+			When("TSIG is verified", func() {
+				BeforeEach(func() {
+					views.SetKeyRing(kr)
+					v, _, err = views.Lookup(&ResponseWriter{RemoteAddress: external}, MustSignMsg(msg, kr))
+				})
+				It("returns internal view", func() {
+					Expect(err).To(Succeed())
+					Expect(v.GetName()).To(Equal("internal"))
+				})
+			})
+			When("TSIG is forged", func() {
+				BeforeEach(func() {
+					forged, err := tsig.NewKeyRing(&tsig.Key{Name: "internal.key.", Algorithm: dns.HmacSHA256, Secret: "Zm9yZ2Vk"})
+					Expect(err).To(Succeed())
+					views.SetKeyRing(kr)
+					v, _, err = views.Lookup(&ResponseWriter{RemoteAddress: external}, MustSignMsg(msg, forged))
+				})
+				It("does not select internal view", func() {
+					Expect(err).To(Succeed())
+					Expect(v.GetName()).To(Equal("external"))
+				})
+			})
+			When("key ring is not set", func() {
+				BeforeEach(func() {
+					v, _, err = views.Lookup(&ResponseWriter{RemoteAddress: external}, MustSignMsg(msg, kr))
+				})
+				It("does not select internal view", func() {
+					Expect(err).To(Succeed())
+					Expect(v.GetName()).To(Equal("external"))
+				})
+			})
+		})
+		When("matched view has no zone", func() {
+			BeforeEach(func() {
+				msg.SetQuestion("example.com.", dns.TypeA)
+				v, _, err = views.Lookup(&ResponseWriter{RemoteAddress: internal}, msg)
+			})
+			It("returns ErrNotFoundZone", func() {
+				Expect(err).To(Equal(view.ErrNotFoundZone))
+				Expect(v.GetName()).To(Equal("internal"))
+			})
+		})
+		When("no view matches", func() {
+			BeforeEach(func() {
+				views.SetViews(views.GetViews()[:1])
+				_, _, err = views.Lookup(&ResponseWriter{RemoteAddress: external}, msg)
+			})
+			It("returns ErrNotFoundView", func() {
+				Expect(err).To(Equal(view.ErrNotFoundView))
+			})
+		})
+		When("msg has no question", func() {
+			BeforeEach(func() {
+				_, _, err = views.Lookup(&ResponseWriter{RemoteAddress: internal}, &dns.Msg{})
+			})
+			It("returns ErrNoQuestion", func() {
+				Expect(err).To(Equal(view.ErrNoQuestion))
+			})
+		})
+		Context("Reconfigure", func() {
+			When("zone provider returns error", func() {
+				BeforeEach(func() {
+					err = views.Reconfigure([]byte(`{"Views":[{"Name":"a","Zones":["example.jp."]}]}`), view.ZoneProviderFunc(func(_, _ string) (dnsutils.ZoneInterface, error) {
+						return nil, fmt.Errorf("error")
+					}))
+				})
+				It("returns error and keeps views", func() {
+					Expect(err).To(HaveOccurred())
+					Expect(views.GetViews()).To(HaveLen(2))
+				})
+			})
+			When("invalid matcher", func() {
+				BeforeEach(func() {
+					err = views.Reconfigure([]byte(`{"Views":[{"Name":"a","Matcher":{"Op":"XOR"}}]}`), zp)
+				})
+				It("returns error", func() {
+					Expect(err).To(HaveOccurred())
+				})
+			})
+			When("invalid json", func() {
+				BeforeEach(func() {
+					err = views.Reconfigure([]byte(`{`), zp)
+				})
+				It("returns error", func() {
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,92 @@
+package dnsutils
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// SkipSubtree is used as a return value from WalkFunc to indicate that
+	// the children of the node are skipped.
+	// When it is returned by PreOrder, PostOrder of the node is not called.
+	SkipSubtree = errors.New("skip this subtree")
+	// SkipAll is used as a return value from WalkFunc to indicate that
+	// all remaining nodes are skipped.
+	SkipAll = errors.New("skip everything and stop the walk")
+)
+
+// WalkFunc is the type of the function called by Walk to visit each NameNode.
+// depth is the number of labels from the start node. (start node is 0)
+type WalkFunc func(nni NameNodeInterface, depth int) error
+
+// WalkOption is option for Walk
+type WalkOption struct {
+	// PreOrder is called before visiting children.
+	PreOrder WalkFunc
+	// PostOrder is called after visiting children.
+	PostOrder WalkFunc
+	// MaxDepth limits the depth of walk.
+	// If nil, depth is unlimited.
+	MaxDepth *int
+}
+
+// GetMaxDepth returns MaxDepth.
+// If MaxDepth is nil, returns -1 (unlimited).
+func (o *WalkOption) GetMaxDepth() int {
+	if o.MaxDepth == nil {
+		return -1
+	}
+	return *o.MaxDepth
+}
+
+// Walk walks the name tree rooted at nni.
+// children are visited in canonical order (rfc4034#section6-1).
+// It works only using NameNodeInterface methods, so it can be used for any implementation.
+//
+// If WalkFunc returns SkipSubtree, children of the node are skipped.
+// If WalkFunc returns SkipAll, the walk stops and Walk returns nil.
+// If WalkFunc returns other error, the walk stops and Walk returns it.
+// If ctx is canceled, the walk stops and Walk returns ctx.Err().
+func Walk(ctx context.Context, nni NameNodeInterface, opt WalkOption) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	err := walk(ctx, nni, 0, &opt)
+	if errors.Is(err, SkipAll) || errors.Is(err, SkipSubtree) {
+		return nil
+	}
+	return err
+}
+
+func walk(ctx context.Context, nni NameNodeInterface, depth int, opt *WalkOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if opt.PreOrder != nil {
+		if err := opt.PreOrder(nni, depth); err != nil {
+			return err
+		}
+	}
+	if maxDepth := opt.GetMaxDepth(); maxDepth < 0 || depth < maxDepth {
+		children := nni.CopyChildNodes()
+		names := make([]string, 0, len(children))
+		for name := range children {
+			names = append(names, name)
+		}
+		SortNames(names)
+		for _, name := range names {
+			if err := walk(ctx, children[name], depth+1, opt); err != nil {
+				if errors.Is(err, SkipSubtree) {
+					continue
+				}
+				return err
+			}
+		}
+	}
+	if opt.PostOrder != nil {
+		if err := opt.PostOrder(nni, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package dnsutils_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	. "github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Walk", func() {
+	var (
+		err      error
+		root     *dnsutils.NameNode
+		pre      []string
+		post     []string
+		depths   map[string]int
+		opt      dnsutils.WalkOption
+		ctx      context.Context
+		maxDepth int
+	)
+	BeforeEach(func() {
+		root = MustNewNameNode("example.jp", dns.ClassINET)
+		www := MustNewNameNode("www.example.jp", dns.ClassINET)
+		blue := MustNewNameNode("blue.www.example.jp", dns.ClassINET)
+		red := MustNewNameNode("red.www.example.jp", dns.ClassINET)
+		alpha := MustNewNameNode("alpha.red.www.example.jp", dns.ClassINET)
+		mail := MustNewNameNode("mail.example.jp", dns.ClassINET)
+		Expect(root.AddChildNameNode(www)).To(Succeed())
+		Expect(root.AddChildNameNode(mail)).To(Succeed())
+		Expect(www.AddChildNameNode(red)).To(Succeed())
+		Expect(www.AddChildNameNode(blue)).To(Succeed())
+		Expect(red.AddChildNameNode(alpha)).To(Succeed())
+		pre = nil
+		post = nil
+		depths = map[string]int{}
+		ctx = context.Background()
+		opt = dnsutils.WalkOption{
+			PreOrder: func(nni dnsutils.NameNodeInterface, depth int) error {
+				pre = append(pre, nni.GetName())
+				depths[nni.GetName()] = depth
+				return nil
+			},
+			PostOrder: func(nni dnsutils.NameNodeInterface, depth int) error {
+				post = append(post, nni.GetName())
+				return nil
+			},
+		}
+	})
+	JustBeforeEach(func() {
+		err = dnsutils.Walk(ctx, root, opt)
+	})
+	When("default", func() {
+		It("visits all nodes by canonical order", func() {
+			Expect(err).To(Succeed())
+			Expect(pre).To(Equal([]string{
+				"example.jp.",
+				"mail.example.jp.",
+				"www.example.jp.",
+				"blue.www.example.jp.",
+				"red.www.example.jp.",
+				"alpha.red.www.example.jp.",
+			}))
+			Expect(post).To(Equal([]string{
+				"mail.example.jp.",
+				"blue.www.example.jp.",
+				"alpha.red.www.example.jp.",
+				"red.www.example.jp.",
+				"www.example.jp.",
+				"example.jp.",
+			}))
+			Expect(depths["example.jp."]).To(Equal(0))
+			Expect(depths["www.example.jp."]).To(Equal(1))
+			Expect(depths["alpha.red.www.example.jp."]).To(Equal(3))
+		})
+	})
+	When("PreOrder returns SkipSubtree", func() {
+		BeforeEach(func() {
+			f := opt.PreOrder
+			opt.PreOrder = func(nni dnsutils.NameNodeInterface, depth int) error {
+				f(nni, depth)
+				if nni.GetName() == "www.example.jp." {
+					return dnsutils.SkipSubtree
+				}
+				return nil
+			}
+		})
+		It("skips children", func() {
+			Expect(err).To(Succeed())
+			Expect(pre).To(Equal([]string{"example.jp.", "mail.example.jp.", "www.example.jp."}))
+			Expect(post).To(Equal([]string{"mail.example.jp.", "example.jp."}))
+		})
+	})
+	When("PreOrder returns SkipAll", func() {
+		BeforeEach(func() {
+			f := opt.PreOrder
+			opt.PreOrder = func(nni dnsutils.NameNodeInterface, depth int) error {
+				f(nni, depth)
+				if nni.GetName() == "blue.www.example.jp." {
+					return dnsutils.SkipAll
+				}
+				return nil
+			}
+		})
+		It("stops walk", func() {
+			Expect(err).To(Succeed())
+			Expect(pre).To(Equal([]string{"example.jp.", "mail.example.jp.", "www.example.jp.", "blue.www.example.jp."}))
+			Expect(post).To(Equal([]string{"mail.example.jp."}))
+		})
+	})
+	When("PostOrder returns SkipAll", func() {
+		BeforeEach(func() {
+			f := opt.PostOrder
+			opt.PostOrder = func(nni dnsutils.NameNodeInterface, depth int) error {
+				f(nni, depth)
+				if nni.GetName() == "mail.example.jp." {
+					return dnsutils.SkipAll
+				}
+				return nil
+			}
+		})
+		It("stops walk", func() {
+			Expect(err).To(Succeed())
+			Expect(pre).To(Equal([]string{"example.jp.", "mail.example.jp."}))
+			Expect(post).To(Equal([]string{"mail.example.jp."}))
+		})
+	})
+	When("WalkFunc returns wrapped SkipSubtree and SkipAll", func() {
+		BeforeEach(func() {
+			f := opt.PreOrder
+			opt.PreOrder = func(nni dnsutils.NameNodeInterface, depth int) error {
+				f(nni, depth)
+				switch nni.GetName() {
+				case "mail.example.jp.":
+					return fmt.Errorf("skip mail: %w", dnsutils.SkipSubtree)
+				case "blue.www.example.jp.":
+					return fmt.Errorf("stop: %w", dnsutils.SkipAll)
+				}
+				return nil
+			}
+		})
+		It("handles them as sentinels", func() {
+			Expect(err).To(Succeed())
+			Expect(pre).To(Equal([]string{"example.jp.", "mail.example.jp.", "www.example.jp.", "blue.www.example.jp."}))
+			Expect(post).To(BeEmpty())
+		})
+	})
+	When("WalkFunc returns error", func() {
+		BeforeEach(func() {
+			opt.PreOrder = func(nni dnsutils.NameNodeInterface, depth int) error {
+				if nni.GetName() == "red.www.example.jp." {
+					return fmt.Errorf("error")
+				}
+				return nil
+			}
+		})
+		It("returns error", func() {
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	When("MaxDepth is set", func() {
+		BeforeEach(func() {
+			maxDepth = 1
+			opt.MaxDepth = &maxDepth
+		})
+		It("does not visit deeper nodes", func() {
+			Expect(err).To(Succeed())
+			Expect(pre).To(Equal([]string{"example.jp.", "mail.example.jp.", "www.example.jp."}))
+			Expect(post).To(Equal([]string{"mail.example.jp.", "www.example.jp.", "example.jp."}))
+		})
+	})
+	When("context is canceled", func() {
+		BeforeEach(func() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(context.Background())
+			f := opt.PreOrder
+			opt.PreOrder = func(nni dnsutils.NameNodeInterface, depth int) error {
+				f(nni, depth)
+				if nni.GetName() == "www.example.jp." {
+					cancel()
+				}
+				return nil
+			}
+		})
+		It("returns context error", func() {
+			Expect(err).To(Equal(context.Canceled))
+			Expect(pre).To(Equal([]string{"example.jp.", "mail.example.jp.", "www.example.jp."}))
+		})
+	})
+})
@@ -1,6 +1,7 @@
 package dnsutils
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -53,32 +54,8 @@ func (z *Zone) GetGenerator() Generator { return z.generator }
 // Read reads zone data from zonefile (RFC1035)
 // It overrides zone's name and class when root node not exist.
 func (z *Zone) Read(r io.Reader) error {
-	zp := dns.NewZoneParser(r, z.GetName(), "")
-	var (
-		soa dns.RR
-		rrs []dns.RR
-	)
-	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
-		if rr.Header().Rrtype == dns.TypeSOA {
-			soa = rr
-		}
-		rrs = append(rrs, rr)
-	}
-	if zp.Err() != nil {
-		return fmt.Errorf("failed to parse zone data %w", zp.Err())
-	}
-	if soa == nil {
-		return fmt.Errorf("not found SOA record")
-	}
-	if z.generator == nil {
-		z.generator = &DefaultGenerator{}
-	}
-	if z.root == nil {
-		z.class = dns.Class(soa.Header().Class)
-		z.name = dns.CanonicalName(soa.Header().Name)
-		z.root, _ = z.generator.NewNameNode(z.name, z.class)
-	}
-	return z.ImportRRs(rrs)
+	_, err := z.ReadWithOption(r, ImportOption{})
+	return err
 }
 
 func (z *Zone) ImportRRs(rrs []dns.RR) error {
@@ -206,28 +183,29 @@ func ZoneNormalize(z ZoneInterface) error {
 func GetZoneCuts(rootNode NameNodeInterface) (NameNodeInterface, map[string]struct{}, error) {
 	delegateNS := map[string]struct{}{}
 	zoneCuts, _ := NewNameNode(rootNode.GetName(), rootNode.GetClass())
-	err := rootNode.IterateNameNodeWithValue(func(nni NameNodeInterface, v any) (any, error) {
-		aa := v.(bool)
-		if !aa {
-			return aa, nil
-		}
-		if nni.GetName() != rootNode.GetName() {
-			if nsRRSet := nni.GetRRSet(dns.TypeNS); nsRRSet != nil {
-				for _, rr := range nsRRSet.GetRRs() {
-					if ns, ok := rr.(*dns.NS); ok {
-						delegateNS[dns.CanonicalName(ns.Ns)] = struct{}{}
-					} else {
-						return aa, ErrInvalid
-					}
-				}
-				zoneCut, _ := NewNameNode(nni.GetName(), rootNode.GetClass())
-				zoneCut.SetRRSet(nsRRSet)
-				zoneCuts.AddChildNameNode(zoneCut)
-				aa = false
+	err := Walk(context.Background(), rootNode, WalkOption{
+		PreOrder: func(nni NameNodeInterface, _ int) error {
+			if nni.GetName() == rootNode.GetName() {
+				return nil
 			}
-		}
-		return aa, nil
-	}, true)
+			nsRRSet := nni.GetRRSet(dns.TypeNS)
+			if nsRRSet == nil {
+				return nil
+			}
+			nss, err := RRsOf[*dns.NS](nsRRSet)
+			if err != nil {
+				return ErrInvalid
+			}
+			for _, ns := range nss {
+				delegateNS[dns.CanonicalName(ns.Ns)] = struct{}{}
+			}
+			zoneCut, _ := NewNameNode(nni.GetName(), rootNode.GetClass())
+			zoneCut.SetRRSet(nsRRSet)
+			zoneCuts.AddChildNameNode(zoneCut)
+			// occluded data
+			return SkipSubtree
+		},
+	})
 	if err != nil {
 		return nil, nil, err
 	}
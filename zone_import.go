@@ -0,0 +1,378 @@
+package dnsutils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/miekg/dns"
+)
+
+// TTLNormalizeMode is the way to normalize TTLs of RRs in the same RRSet.
+type TTLNormalizeMode string
+
+const (
+	// TTLNormalizeNone does not normalize TTL. Importing returns ErrTTLNotEqual when TTLs differ.
+	TTLNormalizeNone TTLNormalizeMode = ""
+	// TTLNormalizeMinimum uses the lowest TTL in the RRSet (same as BIND and NSD).
+	TTLNormalizeMinimum TTLNormalizeMode = "minimum"
+	// TTLNormalizeFirst uses the TTL of the first RR in the RRSet.
+	TTLNormalizeFirst TTLNormalizeMode = "first"
+)
+
+// TTLAdjustReason is the reason of TTLAdjustment.
+type TTLAdjustReason string
+
+const (
+	TTLAdjustReasonDefault   TTLAdjustReason = "default"
+	TTLAdjustReasonMin       TTLAdjustReason = "min"
+	TTLAdjustReasonMax       TTLAdjustReason = "max"
+	TTLAdjustReasonNormalize TTLAdjustReason = "normalize"
+)
+
+// missingTTLProbes are the default TTLs set to zone parser for detecting RR without TTL.
+// Any uint32 can be explicit TTL, so RR whose TTL follows the default TTL of the parser is treated as RR without TTL.
+var missingTTLProbes = [2]uint32{0, 1}
+
+var (
+	// ErrMissingTTL returns when TTL of RR is not defined and it can not be defaulted.
+	ErrMissingTTL = fmt.Errorf("missing TTL")
+)
+
+// ImportOption is option for ReadWithOption and ImportRRsWithOption.
+type ImportOption struct {
+	// TTLNormalize is the way to normalize TTLs in the same RRSet.
+	// TTL of RRSIG is set to the TTL of the covered RRSet (rfc4034#section-3).
+	TTLNormalize TTLNormalizeMode
+	// MinTTL is the minimum TTL. Lower TTL is raised to MinTTL.
+	MinTTL *uint32
+	// MaxTTL is the maximum TTL. Higher TTL is lowered to MaxTTL.
+	MaxTTL *uint32
+	// DefaultTTLFromSOA uses SOA MINIMUM for the RRs without TTL, when zone file has neither $TTL nor previous TTL.
+	// It is used only by ReadWithOption.
+	DefaultTTLFromSOA bool
+}
+
+// TTLAdjustment reports a TTL change by import option.
+type TTLAdjustment struct {
+	// RR is adjusted RR
+	RR     dns.RR
+	From   uint32
+	To     uint32
+	Reason TTLAdjustReason
+}
+
+func (a TTLAdjustment) String() string {
+	return fmt.Sprintf("%s %s: TTL %d -> %d (%s)", a.RR.Header().Name, ConvertTypeToString(a.RR.Header().Rrtype), a.From, a.To, a.Reason)
+}
+
+type rrsetKey struct {
+	name   string
+	rrtype uint16
+}
+
+func newRRSetKey(rr dns.RR) rrsetKey {
+	return rrsetKey{name: dns.CanonicalName(rr.Header().Name), rrtype: rr.Header().Rrtype}
+}
+
+// NormalizeTTL returns copies of RRs whose TTL are adjusted by ImportOption and the adjustments.
+func NormalizeTTL(rrs []dns.RR, opt ImportOption) ([]dns.RR, []TTLAdjustment, error) {
+	return normalizeTTL(rrs, opt, nil, nil)
+}
+
+// normalizeTTL adjusts TTLs of copies of rrs.
+// missing is the set of indexes of RRs without TTL.
+func normalizeTTL(rrs []dns.RR, opt ImportOption, base map[rrsetKey]uint32, missing map[int]struct{}) ([]dns.RR, []TTLAdjustment, error) {
+	var (
+		res         = make([]dns.RR, 0, len(rrs))
+		adjustments []TTLAdjustment
+		soa         *dns.SOA
+	)
+	adjust := func(rr dns.RR, ttl uint32, reason TTLAdjustReason) {
+		if rr.Header().Ttl == ttl {
+			return
+		}
+		adjustments = append(adjustments, TTLAdjustment{RR: rr, From: rr.Header().Ttl, To: ttl, Reason: reason})
+		rr.Header().Ttl = ttl
+	}
+	for _, rr := range rrs {
+		rr = dns.Copy(rr)
+		if s, ok := rr.(*dns.SOA); ok {
+			soa = s
+		}
+		res = append(res, rr)
+	}
+
+	// default
+	for i, rr := range res {
+		if _, ok := missing[i]; !ok {
+			continue
+		}
+		if !opt.DefaultTTLFromSOA || soa == nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrMissingTTL, rr.Header().Name)
+		}
+		adjust(rr, soa.Minttl, TTLAdjustReasonDefault)
+	}
+
+	// clamp
+	for _, rr := range res {
+		if opt.MinTTL != nil && rr.Header().Ttl < *opt.MinTTL {
+			adjust(rr, *opt.MinTTL, TTLAdjustReasonMin)
+		}
+		if opt.MaxTTL != nil && rr.Header().Ttl > *opt.MaxTTL {
+			adjust(rr, *opt.MaxTTL, TTLAdjustReasonMax)
+		}
+	}
+
+	// normalize
+	if opt.TTLNormalize == TTLNormalizeNone {
+		return res, adjustments, nil
+	}
+	targets := map[rrsetKey]uint32{}
+	for key, ttl := range base {
+		targets[key] = ttl
+	}
+	for _, rr := range res {
+		if rr.Header().Rrtype == dns.TypeRRSIG {
+			continue
+		}
+		key := newRRSetKey(rr)
+		ttl, exist := targets[key]
+		switch opt.TTLNormalize {
+		case TTLNormalizeFirst:
+			if !exist {
+				targets[key] = rr.Header().Ttl
+			}
+		case TTLNormalizeMinimum:
+			if !exist || rr.Header().Ttl < ttl {
+				targets[key] = rr.Header().Ttl
+			}
+		default:
+			return nil, nil, fmt.Errorf("not support TTL normalize mode: %s", opt.TTLNormalize)
+		}
+	}
+	for _, rr := range res {
+		key := newRRSetKey(rr)
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			key.rrtype = sig.TypeCovered
+			if _, exist := targets[key]; !exist {
+				continue
+			}
+		}
+		adjust(rr, targets[key], TTLAdjustReasonNormalize)
+	}
+	// existing rrsets
+	for key, ttl := range base {
+		if targets[key] != ttl {
+			base[key] = targets[key]
+		}
+	}
+	return res, adjustments, nil
+}
+
+// ReadWithOption reads zone data from zonefile (RFC1035) like Read.
+// TTLs are adjusted by ImportOption, and it returns the adjustments.
+func (z *Zone) ReadWithOption(r io.Reader, opt ImportOption) ([]TTLAdjustment, error) {
+	var (
+		rrs     []dns.RR
+		missing map[int]struct{}
+		err     error
+	)
+	if opt.DefaultTTLFromSOA {
+		rrs, missing, err = z.parseWithMissingTTL(r)
+	} else {
+		rrs, err = z.parse(r, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var soa dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			soa = rr
+		}
+	}
+	if soa == nil {
+		return nil, fmt.Errorf("not found SOA record")
+	}
+	if z.generator == nil {
+		z.generator = &DefaultGenerator{}
+	}
+	if z.root == nil {
+		z.class = dns.Class(soa.Header().Class)
+		z.name = dns.CanonicalName(soa.Header().Name)
+		z.root, _ = z.generator.NewNameNode(z.name, z.class)
+	}
+	return z.importRRsWithOption(rrs, opt, missing)
+}
+
+func (z *Zone) parse(r io.Reader, defaultTTL *uint32) ([]dns.RR, error) {
+	zp := dns.NewZoneParser(r, z.GetName(), "")
+	if defaultTTL != nil {
+		zp.SetDefaultTTL(*defaultTTL)
+	}
+	var rrs []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if zp.Err() != nil {
+		return nil, fmt.Errorf("failed to parse zone data %w", zp.Err())
+	}
+	return rrs, nil
+}
+
+// parseWithMissingTTL parses zone data and returns the indexes of RRs without TTL.
+// Zone data is parsed with different default TTLs, and RRs whose TTL differ are RRs without TTL.
+// The second parsing is done only when RR which may not have TTL exists.
+func (z *Zone) parseWithMissingTTL(r io.Reader) ([]dns.RR, map[int]struct{}, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read zone data: %w", err)
+	}
+	rrs, err := z.parse(bytes.NewReader(data), &missingTTLProbes[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	missing := map[int]struct{}{}
+	var candidates []int
+	for i, rr := range rrs {
+		if rr.Header().Ttl == missingTTLProbes[0] {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return rrs, missing, nil
+	}
+	probes, err := z.parse(bytes.NewReader(data), &missingTTLProbes[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(probes) != len(rrs) {
+		return nil, nil, fmt.Errorf("failed to parse zone data: number of RRs differs")
+	}
+	for _, i := range candidates {
+		if probes[i].Header().Ttl == missingTTLProbes[1] {
+			missing[i] = struct{}{}
+		}
+	}
+	return rrs, missing, nil
+}
+
+// ImportRRsWithOption imports RRs like ImportRRs.
+// TTLs are adjusted by ImportOption, and it returns the adjustments.
+// When TTLNormalize is enabled, RRSets which already exist in the zone are also normalized.
+// TTLs of existing RRSets are changed only when all RRs are imported.
+func (z *Zone) ImportRRsWithOption(rrs []dns.RR, opt ImportOption) ([]TTLAdjustment, error) {
+	return z.importRRsWithOption(rrs, opt, nil)
+}
+
+func (z *Zone) importRRsWithOption(rrs []dns.RR, opt ImportOption, missing map[int]struct{}) ([]TTLAdjustment, error) {
+	base := map[rrsetKey]uint32{}
+	if opt.TTLNormalize != TTLNormalizeNone {
+		for _, rr := range rrs {
+			key := newRRSetKey(rr)
+			if _, exist := base[key]; exist || key.rrtype == dns.TypeRRSIG {
+				continue
+			}
+			if nn, ok := z.GetRootNode().GetNameNode(key.name); ok {
+				if set := nn.GetRRSet(key.rrtype); !IsEmptyRRSet(set) {
+					base[key] = set.GetTTL()
+				}
+			}
+		}
+	}
+	normalized, adjustments, err := normalizeTTL(rrs, opt, base, missing)
+	if err != nil {
+		return nil, err
+	}
+	changed := map[rrsetKey]uint32{}
+	for key, ttl := range base {
+		nn, _ := z.GetRootNode().GetNameNode(key.name)
+		set := nn.GetRRSet(key.rrtype)
+		if set.GetTTL() == ttl {
+			continue
+		}
+		for _, rr := range append(set.GetRRs(), coveringRRSIGs(nn, key.rrtype)...) {
+			if rr.Header().Ttl == ttl {
+				continue
+			}
+			rr = dns.Copy(rr)
+			adjustments = append(adjustments, TTLAdjustment{RR: rr, From: rr.Header().Ttl, To: ttl, Reason: TTLAdjustReasonNormalize})
+			rr.Header().Ttl = ttl
+		}
+		changed[key] = ttl
+	}
+	if len(changed) == 0 {
+		if err := z.ImportRRs(normalized); err != nil {
+			return nil, err
+		}
+		return adjustments, nil
+	}
+	// existing rrsets are changed on copy of zone tree, and the tree is replaced when import succeeds.
+	root, err := CopyNameNodeTree(z.GetRootNode(), z.generator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy zone: %w", err)
+	}
+	for key, ttl := range changed {
+		nn, _ := root.GetNameNode(key.name)
+		set := nn.GetRRSet(key.rrtype)
+		if err := set.SetTTL(ttl); err != nil {
+			return nil, fmt.Errorf("failed to set TTL: %w", err)
+		}
+		if err := nn.SetRRSet(set); err != nil {
+			return nil, fmt.Errorf("failed to set rrset: %w", err)
+		}
+		if err := setCoveringRRSIGTTL(nn, key.rrtype, ttl, z.generator); err != nil {
+			return nil, err
+		}
+	}
+	work := &Zone{name: z.name, root: root, class: z.class, generator: z.generator}
+	if err := work.ImportRRs(normalized); err != nil {
+		return nil, err
+	}
+	if err := z.GetRootNode().SetValue(root); err != nil {
+		return nil, fmt.Errorf("failed to replace zone: %w", err)
+	}
+	return adjustments, nil
+}
+
+// coveringRRSIGs returns RRSIGs of the node which cover rrtype.
+func coveringRRSIGs(nn NameNodeInterface, rrtype uint16) []dns.RR {
+	var rrs []dns.RR
+	if set := nn.GetRRSet(dns.TypeRRSIG); set != nil {
+		for _, rr := range set.GetRRs() {
+			if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == rrtype {
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+	return rrs
+}
+
+// setCoveringRRSIGTTL sets TTL of RRSIGs which cover rrtype.
+func setCoveringRRSIGTTL(nn NameNodeInterface, rrtype uint16, ttl uint32, generator RRSetGenerator) error {
+	if generator == nil {
+		generator = &DefaultGenerator{}
+	}
+	set := nn.GetRRSet(dns.TypeRRSIG)
+	if IsEmptyRRSet(set) || len(coveringRRSIGs(nn, rrtype)) == 0 {
+		return nil
+	}
+	sigs, err := generator.NewRRSet(nn.GetName(), set.GetTTL(), set.GetClass(), dns.TypeRRSIG)
+	if err != nil {
+		return fmt.Errorf("failed to create rrset: %w", err)
+	}
+	for _, rr := range set.GetRRs() {
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == rrtype {
+			rr = dns.Copy(rr)
+			rr.Header().Ttl = ttl
+		}
+		if err := sigs.AddRR(rr); err != nil {
+			return fmt.Errorf("failed to add RR %s: %w", rr.String(), err)
+		}
+	}
+	if err := nn.SetRRSet(sigs); err != nil {
+		return fmt.Errorf("failed to set rrset: %w", err)
+	}
+	return nil
+}
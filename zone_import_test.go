@@ -0,0 +1,268 @@
+package dnsutils_test
+
+import (
+	"bytes"
+
+	"github.com/miekg/dns"
+	"github.com/mimuret/dnsutils"
+	. "github.com/mimuret/dnsutils/testtool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var testImportZone = []byte(`example.jp. 3600 IN SOA localhost. root.localhost. 1 3600 900 85400 300
+example.jp. 3600 IN NS ns1.example.jp.
+ns1.example.jp. 3600 IN A 192.168.0.1
+www.example.jp. 600 IN A 192.168.0.2
+www.example.jp. 300 IN A 192.168.0.3
+www.example.jp. 900 IN A 192.168.0.4
+long.example.jp. 604800 IN TXT "long"
+short.example.jp. 1 IN TXT "short"
+`)
+
+var testImportNoTTLZone = []byte(`$ORIGIN example.jp.
+@ IN SOA localhost. root.localhost. 1 3600 900 85400 300
+@ IN NS ns1.example.jp.
+ns1 IN A 192.168.0.1
+www 60 IN A 192.168.0.2
+`)
+
+var testImportExplicitTTLZone = []byte(`$ORIGIN example.jp.
+@ 0 IN SOA localhost. root.localhost. 1 3600 900 85400 300
+@ 2147483648 IN NS ns1.example.jp.
+ns1 1 IN A 192.168.0.1
+`)
+
+var _ = Describe("zone_import.go", func() {
+	var (
+		err         error
+		z           *dnsutils.Zone
+		opt         dnsutils.ImportOption
+		adjustments []dnsutils.TTLAdjustment
+		minTTL      = uint32(60)
+		maxTTL      = uint32(86400)
+	)
+	BeforeEach(func() {
+		z = &dnsutils.Zone{}
+		opt = dnsutils.ImportOption{}
+	})
+	getTTL := func(name string, rrtype uint16) uint32 {
+		nn, ok := z.GetRootNode().GetNameNode(name)
+		Expect(ok).To(BeTrue())
+		set := nn.GetRRSet(rrtype)
+		Expect(set).NotTo(BeNil())
+		for _, rr := range set.GetRRs() {
+			Expect(rr.Header().Ttl).To(Equal(set.GetTTL()))
+		}
+		return set.GetTTL()
+	}
+	Context("ReadWithOption", func() {
+		When("TTLNormalize is none", func() {
+			BeforeEach(func() {
+				adjustments, err = z.ReadWithOption(bytes.NewBuffer(testImportZone), opt)
+			})
+			It("returns ErrTTLNotEqual", func() {
+				Expect(err).To(MatchError(dnsutils.ErrTTLNotEqual))
+			})
+		})
+		When("TTLNormalize is minimum", func() {
+			BeforeEach(func() {
+				opt.TTLNormalize = dnsutils.TTLNormalizeMinimum
+				adjustments, err = z.ReadWithOption(bytes.NewBuffer(testImportZone), opt)
+			})
+			It("uses the lowest TTL", func() {
+				Expect(err).To(Succeed())
+				Expect(getTTL("www.example.jp.", dns.TypeA)).To(Equal(uint32(300)))
+				Expect(adjustments).To(HaveLen(2))
+				for _, a := range adjustments {
+					Expect(a.Reason).To(Equal(dnsutils.TTLAdjustReasonNormalize))
+					Expect(a.To).To(Equal(uint32(300)))
+				}
+			})
+		})
+		When("TTLNormalize is first", func() {
+			BeforeEach(func() {
+				opt.TTLNormalize = dnsutils.TTLNormalizeFirst
+				adjustments, err = z.ReadWithOption(bytes.NewBuffer(testImportZone), opt)
+			})
+			It("uses the first TTL", func() {
+				Expect(err).To(Succeed())
+				Expect(getTTL("www.example.jp.", dns.TypeA)).To(Equal(uint32(600)))
+				Expect(adjustments).To(HaveLen(2))
+			})
+		})
+		When("TTLNormalize is unknown", func() {
+			BeforeEach(func() {
+				opt.TTLNormalize = "unknown"
+				adjustments, err = z.ReadWithOption(bytes.NewBuffer(testImportZone), opt)
+			})
+			It("returns error", func() {
+				Expect(err).To(HaveOccurred())
+			})
+		})
+		When("MinTTL and MaxTTL are set", func() {
+			BeforeEach(func() {
+				opt.TTLNormalize = dnsutils.TTLNormalizeMinimum
+				opt.MinTTL = &minTTL
+				opt.MaxTTL = &maxTTL
+				adjustments, err = z.ReadWithOption(bytes.NewBuffer(testImportZone), opt)
+			})
+			It("clamps TTL", func() {
+				Expect(err).To(Succeed())
+				Expect(getTTL("long.example.jp.", dns.TypeTXT)).To(Equal(maxTTL))
+				Expect(getTTL("short.example.jp.", dns.TypeTXT)).To(Equal(minTTL))
+				Expect(adjustments).To(ContainElement(dnsutils.TTLAdjustment{
+					RR:     MustNewRR(`long.example.jp. 86400 IN TXT "long"`),
+					From:   604800,
+					To:     86400,
+					Reason: dnsutils.TTLAdjustReasonMax,
+				}))
+				Expect(adjustments).To(ContainElement(dnsutils.TTLAdjustment{
+					RR:     MustNewRR(`short.example.jp. 60 IN TXT "short"`),
+					From:   1,
+					To:     60,
+					Reason: dnsutils.TTLAdjustReasonMin,
+				}))
+				Expect(adjustments).To(HaveLen(4))
+			})
+		})
+		When("TTL is missing", func() {
+			When("DefaultTTLFromSOA is false", func() {
+				BeforeEach(func() {
+					adjustments, err = z.ReadWithOption(bytes.NewBuffer(testImportNoTTLZone), opt)
+				})
+				It("keeps zone parser behavior", func() {
+					Expect(err).To(Succeed())
+					Expect(getTTL("example.jp.", dns.TypeSOA)).To(Equal(uint32(0)))
+					Expect(adjustments).To(BeEmpty())
+				})
+			})
+			When("DefaultTTLFromSOA is true", func() {
+				BeforeEach(func() {
+					opt.DefaultTTLFromSOA = true
+					adjustments, err = z.ReadWithOption(bytes.NewBuffer(testImportNoTTLZone), opt)
+				})
+				It("uses SOA MINIMUM", func() {
+					Expect(err).To(Succeed())
+					Expect(getTTL("example.jp.", dns.TypeSOA)).To(Equal(uint32(300)))
+					Expect(getTTL("example.jp.", dns.TypeNS)).To(Equal(uint32(300)))
+					Expect(getTTL("www.example.jp.", dns.TypeA)).To(Equal(uint32(60)))
+					Expect(adjustments).To(HaveLen(3))
+					Expect(adjustments[0].Reason).To(Equal(dnsutils.TTLAdjustReasonDefault))
+				})
+			})
+			When("TTL is explicit", func() {
+				BeforeEach(func() {
+					opt.DefaultTTLFromSOA = true
+					adjustments, err = z.ReadWithOption(bytes.NewBuffer(testImportExplicitTTLZone), opt)
+				})
+				It("keeps TTL even if it is the same as the default TTL of the parser", func() {
+					Expect(err).To(Succeed())
+					Expect(getTTL("example.jp.", dns.TypeSOA)).To(Equal(uint32(0)))
+					Expect(getTTL("example.jp.", dns.TypeNS)).To(Equal(uint32(2147483648)))
+					Expect(getTTL("ns1.example.jp.", dns.TypeA)).To(Equal(uint32(1)))
+					Expect(adjustments).To(BeEmpty())
+				})
+			})
+		})
+	})
+	Context("ImportRRsWithOption", func() {
+		BeforeEach(func() {
+			Expect(z.Read(bytes.NewBuffer(testZoneNormal))).To(Succeed())
+		})
+		When("rrset exists in zone", func() {
+			When("TTLNormalize is first", func() {
+				BeforeEach(func() {
+					opt.TTLNormalize = dnsutils.TTLNormalizeFirst
+					adjustments, err = z.ImportRRsWithOption([]dns.RR{
+						MustNewRR("mail.example.jp. 300 IN A 192.168.1.4"),
+					}, opt)
+				})
+				It("uses existing TTL", func() {
+					Expect(err).To(Succeed())
+					Expect(getTTL("mail.example.jp.", dns.TypeA)).To(Equal(uint32(3600)))
+					Expect(adjustments).To(HaveLen(1))
+				})
+			})
+			When("TTLNormalize is minimum", func() {
+				BeforeEach(func() {
+					opt.TTLNormalize = dnsutils.TTLNormalizeMinimum
+					adjustments, err = z.ImportRRsWithOption([]dns.RR{
+						MustNewRR("mail.example.jp. 300 IN A 192.168.1.4"),
+					}, opt)
+				})
+				It("changes existing TTL", func() {
+					Expect(err).To(Succeed())
+					Expect(getTTL("mail.example.jp.", dns.TypeA)).To(Equal(uint32(300)))
+					Expect(adjustments).To(HaveLen(3))
+					for _, a := range adjustments[1:] {
+						Expect(a.From).To(Equal(uint32(3600)))
+						Expect(a.RR.Header().Ttl).To(Equal(uint32(300)))
+					}
+				})
+			})
+			When("RRSIG of existing rrset exists", func() {
+				BeforeEach(func() {
+					Expect(z.ImportRRs([]dns.RR{
+						MustNewRR("mail.example.jp. 3600 IN RRSIG A 15 3 3600 20300101000000 20240101000000 30075 example.jp. AAAA"),
+					})).To(Succeed())
+					opt.TTLNormalize = dnsutils.TTLNormalizeMinimum
+					adjustments, err = z.ImportRRsWithOption([]dns.RR{
+						MustNewRR("mail.example.jp. 300 IN A 192.168.1.4"),
+					}, opt)
+				})
+				It("changes TTL of RRSIG", func() {
+					Expect(err).To(Succeed())
+					nn, ok := z.GetRootNode().GetNameNode("mail.example.jp.")
+					Expect(ok).To(BeTrue())
+					sigs := nn.GetRRSet(dns.TypeRRSIG)
+					Expect(sigs.GetRRs()).To(HaveLen(1))
+					Expect(sigs.GetRRs()[0].Header().Ttl).To(Equal(uint32(300)))
+					Expect(adjustments).To(HaveLen(4))
+				})
+			})
+			When("import fails", func() {
+				BeforeEach(func() {
+					opt.TTLNormalize = dnsutils.TTLNormalizeMinimum
+					adjustments, err = z.ImportRRsWithOption([]dns.RR{
+						MustNewRR("mail.example.jp. 300 IN A 192.168.1.4"),
+						MustNewRR("www.example.com. 300 IN A 192.168.1.5"),
+					}, opt)
+				})
+				It("does not change existing TTL", func() {
+					Expect(err).To(HaveOccurred())
+					Expect(getTTL("mail.example.jp.", dns.TypeA)).To(Equal(uint32(3600)))
+					nn, ok := z.GetRootNode().GetNameNode("mail.example.jp.")
+					Expect(ok).To(BeTrue())
+					Expect(nn.GetRRSet(dns.TypeA).Len()).To(Equal(3))
+				})
+			})
+		})
+	})
+	Context("NormalizeTTL", func() {
+		var (
+			rrs []dns.RR
+			res []dns.RR
+		)
+		BeforeEach(func() {
+			rrs = []dns.RR{
+				MustNewRR("www.example.jp. 600 IN A 192.168.0.2"),
+				MustNewRR("www.example.jp. 300 IN A 192.168.0.3"),
+				MustNewRR("www.example.jp. 600 IN RRSIG A 15 3 600 20300101000000 20240101000000 30075 example.jp. AAAA"),
+			}
+			opt.TTLNormalize = dnsutils.TTLNormalizeMinimum
+			res, adjustments, err = dnsutils.NormalizeTTL(rrs, opt)
+		})
+		It("does not change input RRs", func() {
+			Expect(err).To(Succeed())
+			Expect(rrs[0].Header().Ttl).To(Equal(uint32(600)))
+			Expect(res[0].Header().Ttl).To(Equal(uint32(300)))
+			Expect(adjustments).To(HaveLen(2))
+			Expect(adjustments[0].String()).To(Equal("www.example.jp. A: TTL 600 -> 300 (normalize)"))
+		})
+		It("sets TTL of RRSIG to TTL of covered rrset", func() {
+			Expect(res[2].Header().Ttl).To(Equal(uint32(300)))
+			Expect(adjustments[1].String()).To(Equal("www.example.jp. RRSIG: TTL 600 -> 300 (normalize)"))
+		})
+	})
+})